@@ -2,92 +2,317 @@ package fastreq
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/base64"
-	"math/rand"
+	"errors"
+	"fmt"
+	"hash"
+	mathrand "math/rand"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/valyala/fasthttp"
 )
 
+// Oauth1SignatureMethod is the method an OAuth1 request is signed with.
+type Oauth1SignatureMethod string
+
+// Signature methods of OAuth1, see RFC 5849 section 3.4.
+const (
+	Oauth1HMACSHA1   Oauth1SignatureMethod = "HMAC-SHA1"
+	Oauth1HMACSHA256 Oauth1SignatureMethod = "HMAC-SHA256"
+	Oauth1RSASHA1    Oauth1SignatureMethod = "RSA-SHA1"
+	Oauth1Plaintext  Oauth1SignatureMethod = "PLAINTEXT"
+)
+
 type Oauth1 struct {
 	ConsumerKey    string
 	ConsumerSecret string
 	AccessToken    string
 	AccessSecret   string
+
+	// SignatureMethod is HMAC-SHA1 by default.
+	SignatureMethod Oauth1SignatureMethod
+	// PrivateKey is the key of the consumer for RSA-SHA1.
+	PrivateKey *rsa.PrivateKey
+	// Realm is sent in the Authorization header if set.
+	Realm string
+	// Callback is sent as oauth_callback, used when requesting a request token.
+	Callback string
+	// Verifier is sent as oauth_verifier, used when requesting an access token.
+	Verifier string
+}
+
+// oauthParam is a parameter of the signature base string.
+type oauthParam struct {
+	key, value string
 }
 
 // GenHeader generates an OAuth1 header based on a given Request.
-// It returns the header as a byte array.
+// It returns the header as a byte array, or nil if the request can not be
+// signed, see Sign.
 func (o Oauth1) GenHeader(req *Request) []byte {
-	args := fasthttp.AcquireArgs()
+	header, err := o.sign(req, o.params(string(genNonce()), time.Now().Unix()))
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+// Sign sets the OAuth1 Authorization header of req. The signature covers the
+// query and, for form requests, the body parameters, see RFC 5849 section 3.4.1.
+func (o Oauth1) Sign(req *Request) error {
+	header, err := o.sign(req, o.params(string(genNonce()), time.Now().Unix()))
+	if err != nil {
+		return err
+	}
+	req.Header.SetBytesV(fasthttp.HeaderAuthorization, header)
+	return nil
+}
+
+// params returns the protocol parameters of a request without the signature.
+func (o Oauth1) params(nonce string, timestamp int64) []oauthParam {
+	params := []oauthParam{
+		{"oauth_consumer_key", o.ConsumerKey},
+		{"oauth_nonce", nonce},
+		{"oauth_signature_method", string(o.method())},
+		{"oauth_timestamp", strconv.FormatInt(timestamp, 10)},
+		{"oauth_version", "1.0"},
+	}
+	if o.AccessToken != "" {
+		params = append(params, oauthParam{"oauth_token", o.AccessToken})
+	}
+	if o.Callback != "" {
+		params = append(params, oauthParam{"oauth_callback", o.Callback})
+	}
+	if o.Verifier != "" {
+		params = append(params, oauthParam{"oauth_verifier", o.Verifier})
+	}
+	return params
+}
 
-	args.Add("oauth_consumer_key", o.ConsumerKey)
-	args.AddBytesV("oauth_nonce", genNonce())
-	args.Add("oauth_signature_method", "HMAC-SHA1")
-	args.Add("oauth_timestamp", strconv.FormatInt(time.Now().Unix(), 10))
-	args.Add("oauth_token", o.AccessToken)
-	args.Add("oauth_version", "1.0")
+func (o Oauth1) method() Oauth1SignatureMethod {
+	if o.SignatureMethod == "" {
+		return Oauth1HMACSHA1
+	}
+	return o.SignatureMethod
+}
+
+// sign signs the request with the given protocol parameters and returns the
+// Authorization header.
+func (o Oauth1) sign(req *Request, params []oauthParam) ([]byte, error) {
+	signature, err := o.signature(req, params)
+	if err != nil {
+		return nil, err
+	}
+	params = append(params, oauthParam{"oauth_signature", signature})
+	sort.Slice(params, func(i, j int) bool { return params[i].key < params[j].key })
+
+	header := bytes.NewBufferString("OAuth ")
+	if o.Realm != "" {
+		// the realm is a quoted-string, see RFC 5849 section 3.5.1
+		header.WriteString("realm=")
+		header.WriteString(quoteString(o.Realm))
+		header.WriteString(", ")
+	}
+	for i, p := range params {
+		if i > 0 {
+			header.WriteString(", ")
+		}
+		header.WriteString(p.key)
+		header.WriteString(`="`)
+		header.WriteString(escapeRFC3986(p.value))
+		header.WriteString(`"`)
+	}
+	return header.Bytes(), nil
+}
+
+// signature returns the signature of a request, see RFC 5849 section 3.4.
+func (o Oauth1) signature(req *Request, params []oauthParam) (string, error) {
+	key := escapeRFC3986(o.ConsumerSecret) + "&" + escapeRFC3986(o.AccessSecret)
 
-	req.URI().QueryArgs().VisitAll(func(key, value []byte) {
-		args.AddBytesKV(key, value)
+	var h func() hash.Hash
+	switch o.method() {
+	case Oauth1Plaintext:
+		return key, nil
+	case Oauth1HMACSHA1:
+		h = sha1.New
+	case Oauth1HMACSHA256:
+		h = sha256.New
+	case Oauth1RSASHA1:
+		if o.PrivateKey == nil {
+			return "", errors.New("fastreq: RSA-SHA1 needs a private key")
+		}
+		digest := sha1.Sum([]byte(o.baseString(req, params)))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, o.PrivateKey, crypto.SHA1, digest[:])
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(sig), nil
+	default:
+		return "", fmt.Errorf("fastreq: unsupported OAuth1 signature method %q", o.SignatureMethod)
+	}
+
+	mac := hmac.New(h, []byte(key))
+	mac.Write([]byte(o.baseString(req, params)))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// baseString returns the signature base string of a request, see RFC 5849
+// section 3.4.1.
+func (o Oauth1) baseString(req *Request, params []oauthParam) string {
+	var all []oauthParam
+	for _, p := range params {
+		all = append(all, oauthParam{escapeRFC3986(p.key), escapeRFC3986(p.value)})
+	}
+	add := func(key, value []byte) {
+		all = append(all, oauthParam{escapeRFC3986(string(key)), escapeRFC3986(string(value))})
+	}
+	req.URI().QueryArgs().VisitAll(add)
+	if bytes.HasPrefix(req.Header.ContentType(), []byte(MIMEApplicationForm)) {
+		args := fasthttp.AcquireArgs()
+		args.ParseBytes(req.Body())
+		args.VisitAll(add)
+		fasthttp.ReleaseArgs(args)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].key != all[j].key {
+			return all[i].key < all[j].key
+		}
+		return all[i].value < all[j].value
 	})
 
-	signature := o.signature(req, args)
-	return o.header(args, signature)
-}
-
-// signature Generates an encoded signature for an OAuth1 request.
-func (o Oauth1) signature(req *Request, args *fasthttp.Args) []byte {
-	args.Sort(bytes.Compare)
-	queryString := args.String()
-
-	signatureBase := bytes.Buffer{}
-	signatureBase.Grow(len(queryString))
-	signatureBase.Write(req.Header.Method())
-	signatureBase.WriteString("&")
-	signatureBase.WriteString(url.QueryEscape(string(req.URI().Scheme())))
-	signatureBase.WriteString(url.QueryEscape("://"))
-	signatureBase.WriteString(url.QueryEscape(string(req.URI().Host())))
-	signatureBase.WriteString(url.QueryEscape(string(req.URI().Path())))
-	signatureBase.WriteString("&")
-	signatureBase.WriteString(url.QueryEscape(queryString))
-
-	signatureKey := bytes.Buffer{}
-	signatureKey.Grow(len(o.ConsumerSecret) + len(o.AccessSecret) + 1)
-	signatureKey.WriteString(o.ConsumerSecret)
-	signatureKey.WriteString("&")
-	signatureKey.WriteString(o.AccessSecret)
-
-	h := hmac.New(sha1.New, signatureKey.Bytes())
-	h.Write(signatureBase.Bytes())
-	signature := h.Sum(nil)
-	encodedSignature := make([]byte, base64.StdEncoding.EncodedLen(len(signature)))
-	base64.StdEncoding.Encode(encodedSignature, signature)
-	return encodedSignature
-}
-
-func (o Oauth1) header(args *fasthttp.Args, signature []byte) []byte {
-	header := bytes.NewBuffer([]byte(`OAuth oauth_consumer_key="`))
-	header.WriteString(url.QueryEscape(unsafeB2S(args.Peek("oauth_consumer_key"))))
-	header.WriteString(`", oauth_nonce="`)
-	header.WriteString(url.QueryEscape(unsafeB2S(args.Peek("oauth_nonce"))))
-	header.WriteString(`", oauth_signature="`)
-	header.WriteString(url.QueryEscape(unsafeB2S(signature)))
-	header.WriteString(`", oauth_signature_method="`)
-	header.WriteString(url.QueryEscape(unsafeB2S(args.Peek("oauth_signature_method"))))
-	header.WriteString(`", oauth_timestamp="`)
-	header.WriteString(url.QueryEscape(unsafeB2S(args.Peek("oauth_timestamp"))))
-	header.WriteString(`", oauth_token="`)
-	header.WriteString(url.QueryEscape(unsafeB2S(args.Peek("oauth_token"))))
-	header.WriteString(`", oauth_version="`)
-	header.WriteString(url.QueryEscape(unsafeB2S(args.Peek("oauth_version"))))
-	header.WriteString(`"`)
-
-	return header.Bytes()
+	var normalized strings.Builder
+	for i, p := range all {
+		if i > 0 {
+			normalized.WriteByte('&')
+		}
+		normalized.WriteString(p.key)
+		normalized.WriteByte('=')
+		normalized.WriteString(p.value)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToUpper(string(req.Header.Method())))
+	b.WriteByte('&')
+	b.WriteString(escapeRFC3986(oauthBaseURI(req.URI())))
+	b.WriteByte('&')
+	b.WriteString(escapeRFC3986(normalized.String()))
+	return b.String()
+}
+
+// oauthBaseURI returns the base string URI of a request, which has no query and
+// no default port, see RFC 5849 section 3.4.1.2.
+func oauthBaseURI(uri *fasthttp.URI) string {
+	scheme := strings.ToLower(string(uri.Scheme()))
+	host := strings.ToLower(string(uri.Host()))
+	if scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	} else if scheme == "https" {
+		host = strings.TrimSuffix(host, ":443")
+	}
+
+	path := uri.Path()
+	escaped := make([]string, 0, bytes.Count(path, []byte("/"))+1)
+	for _, segment := range strings.Split(string(path), "/") {
+		escaped = append(escaped, escapeRFC3986(segment))
+	}
+	return scheme + "://" + host + strings.Join(escaped, "/")
+}
+
+// escapeRFC3986 percent-encodes all characters but the unreserved ones, see RFC
+// 5849 section 3.6.
+func escapeRFC3986(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// Oauth1Token is a token with its secret, as returned by the endpoints of the
+// OAuth1 authorization flow.
+type Oauth1Token struct {
+	Token  string
+	Secret string
+	// CallbackConfirmed is set by the server for request tokens.
+	CallbackConfirmed bool
+	// Params are all parameters of the response, including provider specific
+	// ones such as a user id.
+	Params url.Values
+}
+
+// RequestToken requests a temporary token from the given endpoint, which starts
+// the authorization flow of RFC 5849 section 2. The Callback of o is sent, "oob"
+// by default. The user then authorizes the token at the URL returned by
+// Oauth1Token.AuthorizeURL.
+func (o Oauth1) RequestToken(c *Client, endpoint string) (*Oauth1Token, error) {
+	o.AccessToken, o.AccessSecret, o.Verifier = "", "", ""
+	if o.Callback == "" {
+		o.Callback = "oob"
+	}
+	return o.requestToken(c, endpoint)
+}
+
+// RequestAccessToken exchanges a request token and the verifier, which the
+// server passed to the callback, for an access token. The AccessToken and
+// AccessSecret of o can be set to the returned token to sign requests.
+func (o Oauth1) RequestAccessToken(c *Client, endpoint string, requestToken *Oauth1Token, verifier string) (*Oauth1Token, error) {
+	o.AccessToken, o.AccessSecret = requestToken.Token, requestToken.Secret
+	o.Callback, o.Verifier = "", verifier
+	return o.requestToken(c, endpoint)
+}
+
+// AuthorizeURL returns the URL of the given authorization endpoint the user is
+// sent to for authorizing the token.
+func (t *Oauth1Token) AuthorizeURL(endpoint string) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + "oauth_token=" + url.QueryEscape(t.Token)
+}
+
+// requestToken posts a signed request to a token endpoint and parses the token
+// in the response. The Oauth1 middleware of the Client is skipped.
+func (o Oauth1) requestToken(c *Client, endpoint string) (*Oauth1Token, error) {
+	resp, err := c.Post(endpoint, NewMiddlewares(MiddlewareOauth1(&o)).Skip(MiddlewareNameOauth1))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Release()
+
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return nil, fmt.Errorf("fastreq: token request failed with status %d: %s", resp.StatusCode(), resp.Body())
+	}
+	params, err := url.ParseQuery(string(resp.Body()))
+	if err != nil {
+		return nil, fmt.Errorf("fastreq: invalid token response: %w", err)
+	}
+	if params.Get("oauth_token") == "" {
+		return nil, errors.New("fastreq: no oauth_token in the token response")
+	}
+	return &Oauth1Token{
+		Token:             params.Get("oauth_token"),
+		Secret:            params.Get("oauth_token_secret"),
+		CallbackConfirmed: params.Get("oauth_callback_confirmed") == "true",
+		Params:            params,
+	}, nil
 }
 
 const allowed = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -95,7 +320,331 @@ const allowed = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 func genNonce() []byte {
 	b := make([]byte, 48)
 	for i := range b {
-		b[i] = allowed[rand.Intn(len(allowed))]
+		b[i] = allowed[mathrand.Intn(len(allowed))]
 	}
 	return b
 }
+
+// Oauth2Grant is the grant type an Oauth2 obtains its tokens with.
+type Oauth2Grant string
+
+// Grant types of OAuth2, see RFC 6749 and RFC 8628.
+const (
+	Oauth2GrantClientCredentials Oauth2Grant = "client_credentials"
+	Oauth2GrantRefreshToken      Oauth2Grant = "refresh_token"
+	Oauth2GrantPassword          Oauth2Grant = "password"
+	Oauth2GrantDeviceCode        Oauth2Grant = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// oauth2ExpiryDelta is the default Oauth2.ExpiryDelta.
+const oauth2ExpiryDelta = 10 * time.Second
+
+// Oauth2Token is a token issued by the token endpoint of an OAuth2 server.
+type Oauth2Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	// Expiry is the time the token expires, it never expires if Expiry is zero.
+	Expiry time.Time `json:"expiry,omitempty"`
+}
+
+// valid reports whether the token can be used for at least delta.
+func (t *Oauth2Token) valid(delta time.Duration) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry))
+}
+
+// Oauth2Error is an error response of an OAuth2 token endpoint, see RFC 6749
+// section 5.2.
+type Oauth2Error struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+func (e *Oauth2Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("fastreq: oauth2: %s: %s", e.Code, e.Description)
+	}
+	return fmt.Sprintf("fastreq: oauth2: %s (status %d)", e.Code, e.StatusCode)
+}
+
+// Oauth2DeviceCode is the response of a device authorization endpoint, see RFC
+// 8628 section 3.2.
+type Oauth2DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// Oauth2TokenStore stores the token of an Oauth2, e.g. to share it between
+// processes or keep it across restarts. The calls are never concurrent for the
+// same Oauth2.
+type Oauth2TokenStore interface {
+	// Load returns the stored token, or nil if there is none.
+	Load() (*Oauth2Token, error)
+	Save(token *Oauth2Token) error
+}
+
+// oauth2MemoryStore is the default Oauth2TokenStore.
+type oauth2MemoryStore struct {
+	token *Oauth2Token
+}
+
+func (s *oauth2MemoryStore) Load() (*Oauth2Token, error) {
+	return s.token, nil
+}
+
+func (s *oauth2MemoryStore) Save(token *Oauth2Token) error {
+	s.token = token
+	return nil
+}
+
+// Oauth2 obtains tokens from an OAuth2 server and caches them until they
+// expire, see MiddlewareOauth2. It must not be copied after first use.
+type Oauth2 struct {
+	ClientID     string
+	ClientSecret string
+	TokenURL     string
+	Scopes       []string
+	// Grant is Oauth2GrantClientCredentials by default. Once a token with a refresh
+	// token was issued, it is refreshed with the refresh token grant first.
+	Grant Oauth2Grant
+	// ClientAuthInBody sends the client credentials as form parameters instead
+	// of HTTP basic auth.
+	ClientAuthInBody bool
+	// ClientAssertion authenticates the client with a JWT of the signer
+	// instead of the client secret, see RFC 7523. The audience of the JWT is
+	// the TokenURL.
+	ClientAssertion *JWTSigner
+
+	// Username and Password are the credentials for Oauth2GrantPassword.
+	Username string
+	Password string
+	// RefreshToken is the initial refresh token for Oauth2GrantRefreshToken.
+	RefreshToken string
+
+	// DeviceAuthURL is the device authorization endpoint for Oauth2GrantDeviceCode.
+	DeviceAuthURL string
+	// DeviceCodeHandler shows the user code to the user, who then authorizes
+	// the device at the verification URI. The token endpoint is polled until
+	// the user did so. Required for Oauth2GrantDeviceCode.
+	DeviceCodeHandler func(code *Oauth2DeviceCode)
+
+	// Store stores the token, in memory by default.
+	Store Oauth2TokenStore
+	// ExpiryDelta is how long before their expiry tokens are refreshed, 10
+	// seconds by default.
+	ExpiryDelta time.Duration
+	// Client sends the token requests, a new Client by default. Its Oauth2
+	// middleware is skipped for them.
+	Client *Client
+
+	mu sync.Mutex
+}
+
+// Token returns a valid token, which is requested from the token endpoint if
+// the stored one expired. Concurrent calls wait for a single token request.
+func (o *Oauth2) Token() (*Oauth2Token, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.Store == nil {
+		o.Store = &oauth2MemoryStore{}
+	}
+	if o.Client == nil {
+		o.Client = NewClient()
+	}
+	delta := o.ExpiryDelta
+	if delta <= 0 {
+		delta = oauth2ExpiryDelta
+	}
+
+	token, err := o.Store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if token.valid(delta) {
+		return token, nil
+	}
+
+	token, err = o.fetch(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.Store.Save(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// invalidate marks the token as expired, unless it was already replaced.
+func (o *Oauth2) invalidate(token *Oauth2Token) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	current, err := o.Store.Load()
+	if err != nil || current == nil || current.AccessToken != token.AccessToken {
+		return
+	}
+	expired := *current
+	expired.Expiry = time.Now().Add(-time.Second)
+	_ = o.Store.Save(&expired)
+}
+
+// fetch requests a new token, using the refresh token of the old one if any.
+func (o *Oauth2) fetch(old *Oauth2Token) (*Oauth2Token, error) {
+	refresh := o.RefreshToken
+	if old != nil && old.RefreshToken != "" {
+		refresh = old.RefreshToken
+	}
+	if refresh != "" {
+		token, err := o.exchange(o.TokenURL, url.Values{
+			"grant_type":    {string(Oauth2GrantRefreshToken)},
+			"refresh_token": {refresh},
+		})
+		if err == nil {
+			if token.RefreshToken == "" {
+				token.RefreshToken = refresh
+			}
+			return token, nil
+		}
+		if o.Grant == Oauth2GrantRefreshToken {
+			return nil, err
+		}
+		// the refresh token may have expired, start over with the grant
+	}
+
+	switch o.Grant {
+	case Oauth2GrantClientCredentials, "":
+		return o.exchange(o.TokenURL, o.withScope(url.Values{
+			"grant_type": {string(Oauth2GrantClientCredentials)},
+		}))
+	case Oauth2GrantPassword:
+		return o.exchange(o.TokenURL, o.withScope(url.Values{
+			"grant_type": {string(Oauth2GrantPassword)},
+			"username":   {o.Username},
+			"password":   {o.Password},
+		}))
+	case Oauth2GrantDeviceCode:
+		return o.deviceToken()
+	case Oauth2GrantRefreshToken:
+		return nil, errors.New("fastreq: oauth2: no refresh token")
+	}
+	return nil, fmt.Errorf("fastreq: oauth2: unsupported grant %q", o.Grant)
+}
+
+func (o *Oauth2) withScope(form url.Values) url.Values {
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+	return form
+}
+
+// deviceToken runs the device authorization grant, see RFC 8628.
+func (o *Oauth2) deviceToken() (*Oauth2Token, error) {
+	if o.DeviceAuthURL == "" || o.DeviceCodeHandler == nil {
+		return nil, errors.New("fastreq: oauth2: the device code grant needs DeviceAuthURL and DeviceCodeHandler")
+	}
+
+	code := &Oauth2DeviceCode{}
+	if err := o.post(o.DeviceAuthURL, o.withScope(url.Values{}), code); err != nil {
+		return nil, err
+	}
+	o.DeviceCodeHandler(code)
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+	for {
+		time.Sleep(interval)
+		token, err := o.exchange(o.TokenURL, url.Values{
+			"grant_type":  {string(Oauth2GrantDeviceCode)},
+			"device_code": {code.DeviceCode},
+		})
+		var oerr *Oauth2Error
+		if !errors.As(err, &oerr) {
+			return token, err
+		}
+		switch oerr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, err
+		}
+		if code.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, err
+		}
+	}
+}
+
+// exchange requests a token from the given endpoint.
+func (o *Oauth2) exchange(endpoint string, form url.Values) (*Oauth2Token, error) {
+	token := &Oauth2Token{}
+	if err := o.post(endpoint, form, token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("fastreq: oauth2: no access_token in the token response")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// post posts the form with the client credentials to an endpoint of the OAuth2
+// server and decodes the JSON response into v.
+func (o *Oauth2) post(endpoint string, form url.Values, v any) error {
+	req := NewRequest(POST, endpoint)
+	defer req.Release()
+
+	switch {
+	case o.ClientAssertion != nil:
+		assertion, err := o.ClientAssertion.Sign(o.TokenURL, time.Now())
+		if err != nil {
+			return err
+		}
+		form.Set("client_id", o.ClientID)
+		form.Set("client_assertion_type", JWTClientAssertionType)
+		form.Set("client_assertion", assertion)
+	case o.ClientSecret == "" || o.ClientAuthInBody:
+		form.Set("client_id", o.ClientID)
+		if o.ClientSecret != "" {
+			form.Set("client_secret", o.ClientSecret)
+		}
+	default:
+		credentials := url.QueryEscape(o.ClientID) + ":" + url.QueryEscape(o.ClientSecret)
+		req.Header.Set(fasthttp.HeaderAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	req.Header.SetContentType(MIMEApplicationForm)
+	req.Header.Set(fasthttp.HeaderAccept, "application/json")
+	req.SetBodyString(form.Encode())
+
+	resp, err := o.Client.Do(req, NewMiddlewares().Skip(MiddlewareNameOauth2))
+	if err != nil {
+		return err
+	}
+	defer resp.Release()
+
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		oerr := &Oauth2Error{}
+		if err := resp.Json(oerr); err != nil || oerr.Code == "" {
+			return fmt.Errorf("fastreq: oauth2: %s failed with status %d: %s", endpoint, resp.StatusCode(), resp.Body())
+		}
+		oerr.StatusCode = resp.StatusCode()
+		return oerr
+	}
+	if err := resp.Json(v); err != nil {
+		return fmt.Errorf("fastreq: oauth2: invalid response of %s: %w", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package fastreq_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"github.com/wnanbei/fastreq/fastreqtest"
+)
+
+func Test_Oauth1_PostForm(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/status").Handle(func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.SetBytesV("Authorization", ctx.Request.Header.Peek("Authorization"))
+	})
+
+	client := srv.Client()
+	o := &fastreq.Oauth1{ConsumerKey: "key", ConsumerSecret: "secret", AccessToken: "token", AccessSecret: "token secret"}
+	client.SetOauth1(o)
+
+	resp, err := client.Post("http://make.fasthttp.great:80/status", fastreq.NewPostForm("status", "hello world"))
+	require.NoError(t, err)
+	params := fastreq.ParseOauthHeader(t, string(resp.Header.Peek("Authorization")))
+	resp.Release()
+
+	// the body parameters are signed, the default port is not
+	expected := make(map[string]string, len(params))
+	for _, key := range []string{"oauth_consumer_key", "oauth_nonce", "oauth_signature_method", "oauth_timestamp", "oauth_token", "oauth_version"} {
+		expected[key] = params[key]
+	}
+	req := fastreq.NewRequest(fastreq.POST, "http://make.fasthttp.great/status")
+	defer req.Release()
+	signature, err := fastreq.Oauth1Signature(o, req, expected)
+	require.NoError(t, err)
+	require.NotEqual(t, params["oauth_signature"], signature)
+
+	form := fastreq.NewPostForm("status", "hello world")
+	defer form.Release()
+	req.SetPostForm(form)
+	signature, err = fastreq.Oauth1Signature(o, req, expected)
+	require.NoError(t, err)
+	require.Equal(t, params["oauth_signature"], signature)
+}
+
+func Test_Oauth1_ThreeLegged(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/request_token").Once().Handle(func(ctx *fasthttp.RequestCtx) {
+		params := fastreq.ParseOauthHeader(t, string(ctx.Request.Header.Peek("Authorization")))
+		if params["oauth_callback"] != "http://printer.example.com/ready" || params["oauth_token"] != "" {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			return
+		}
+		ctx.SetBodyString("oauth_token=hh5s93j4hdidpola&oauth_token_secret=hdhd0244k9j7ao03&oauth_callback_confirmed=true")
+	})
+	srv.On(fastreq.POST, "/token").Times(2).Handle(func(ctx *fasthttp.RequestCtx) {
+		params := fastreq.ParseOauthHeader(t, string(ctx.Request.Header.Peek("Authorization")))
+		if params["oauth_token"] != "hh5s93j4hdidpola" || params["oauth_verifier"] != "hfdp7dh39dks9884" || params["oauth_callback"] != "" {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			ctx.SetBodyString("invalid verifier")
+			return
+		}
+		ctx.SetBodyString("oauth_token=nnch734d00sl2jdk&oauth_token_secret=pfkkdhi9sl3r4s00&user_id=42")
+	})
+
+	client := srv.Client()
+	// the Oauth1 middleware of the client does not interfere
+	client.SetOauth1(&fastreq.Oauth1{ConsumerKey: "other"})
+
+	o := fastreq.Oauth1{
+		ConsumerKey:    "dpf43f3p2l4k3l03",
+		ConsumerSecret: "kd94hf93k423kf44",
+		Callback:       "http://printer.example.com/ready",
+	}
+	temp, err := o.RequestToken(client, "http://photos.example.net/request_token")
+	require.NoError(t, err)
+	require.Equal(t, "hh5s93j4hdidpola", temp.Token)
+	require.Equal(t, "hdhd0244k9j7ao03", temp.Secret)
+	require.True(t, temp.CallbackConfirmed)
+	require.Equal(t, "https://photos.example.net/authorize?oauth_token=hh5s93j4hdidpola",
+		temp.AuthorizeURL("https://photos.example.net/authorize"))
+
+	_, err = o.RequestAccessToken(client, "http://photos.example.net/token", temp, "wrong")
+	require.ErrorContains(t, err, "status 401: invalid verifier")
+
+	token, err := o.RequestAccessToken(client, "http://photos.example.net/token", temp, "hfdp7dh39dks9884")
+	require.NoError(t, err)
+	require.Equal(t, "nnch734d00sl2jdk", token.Token)
+	require.Equal(t, "pfkkdhi9sl3r4s00", token.Secret)
+	require.Equal(t, "42", token.Params.Get("user_id"))
+}
+
+// oauth2Store is an Oauth2TokenStore which counts the saved tokens.
+type oauth2Store struct {
+	token *fastreq.Oauth2Token
+	saved int
+}
+
+func (s *oauth2Store) Load() (*fastreq.Oauth2Token, error) {
+	return s.token, nil
+}
+
+func (s *oauth2Store) Save(token *fastreq.Oauth2Token) error {
+	s.token = token
+	s.saved++
+	return nil
+}
+
+func Test_Oauth2_ClientCredentials(t *testing.T) {
+	var issued atomic.Int64
+	auth := fastreqtest.NewServer(t)
+	auth.On(fastreq.POST, "/token").Once().Handle(func(ctx *fasthttp.RequestCtx) {
+		user, password, _ := strings.Cut(string(ctx.Request.Header.Peek("Authorization")), " ")
+		require.Equal(t, "Basic", user)
+		require.Equal(t, base64.StdEncoding.EncodeToString([]byte("client:s%26cret")), password)
+		require.Equal(t, "client_credentials", string(ctx.PostArgs().Peek("grant_type")))
+		require.Equal(t, "read write", string(ctx.PostArgs().Peek("scope")))
+		// slow enough for the concurrent requests to wait for it
+		time.Sleep(20 * time.Millisecond)
+		ctx.SetContentType("application/json")
+		fmt.Fprintf(ctx, `{"access_token":"t%d","token_type":"bearer","expires_in":3600}`, issued.Add(1))
+	})
+
+	o := &fastreq.Oauth2{
+		ClientID:     "client",
+		ClientSecret: "s&cret",
+		TokenURL:     "http://auth.fasthttp.great/token",
+		Scopes:       []string{"read", "write"},
+		Client:       auth.Client(),
+	}
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.GET, "/").Times(10).Handle(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.Request.Header.Peek("Authorization"))
+	})
+	api := srv.Client()
+	api.SetOauth2(o)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := api.Get("http://api.fasthttp.great/")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "Bearer t1", string(resp.Body()))
+				resp.Release()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int64(1), issued.Load())
+
+	token, err := o.Token()
+	require.NoError(t, err)
+	require.Equal(t, "t1", token.AccessToken)
+	require.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+}
+
+func Test_Oauth2_Refresh(t *testing.T) {
+	var grants []string
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/token").Times(4).Handle(func(ctx *fasthttp.RequestCtx) {
+		grant := string(ctx.PostArgs().Peek("grant_type"))
+		grants = append(grants, grant)
+		ctx.SetContentType("application/json")
+		switch {
+		case grant == "refresh_token" && string(ctx.PostArgs().Peek("refresh_token")) == "r1":
+			ctx.SetBodyString(`{"access_token":"t2","expires_in":3600}`)
+		case grant == "refresh_token":
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.SetBodyString(`{"error":"invalid_grant","error_description":"refresh token expired"}`)
+		case grant == "password":
+			require.Equal(t, "alice", string(ctx.PostArgs().Peek("username")))
+			require.Equal(t, "secret", string(ctx.PostArgs().Peek("password")))
+			// public clients send their id in the body
+			require.Equal(t, "client", string(ctx.PostArgs().Peek("client_id")))
+			ctx.SetBodyString(`{"access_token":"t3","refresh_token":"r3","expires_in":3600}`)
+		}
+	})
+
+	// the refresh token is kept if the server does not issue a new one
+	store := &oauth2Store{token: &fastreq.Oauth2Token{AccessToken: "t1", RefreshToken: "r1", Expiry: time.Now().Add(5 * time.Second)}}
+	o := &fastreq.Oauth2{
+		ClientID: "client",
+		TokenURL: "http://auth.fasthttp.great/token",
+		Grant:    fastreq.Oauth2GrantPassword,
+		Username: "alice",
+		Password: "secret",
+		Store:    store,
+		Client:   srv.Client(),
+	}
+	token, err := o.Token()
+	require.NoError(t, err)
+	require.Equal(t, "t2", token.AccessToken)
+	require.Equal(t, "r1", token.RefreshToken)
+	require.Equal(t, 1, store.saved)
+
+	// an expired refresh token falls back to the grant
+	store.token = &fastreq.Oauth2Token{AccessToken: "t2", RefreshToken: "expired", Expiry: time.Now().Add(-time.Second)}
+	token, err = o.Token()
+	require.NoError(t, err)
+	require.Equal(t, "t3", token.AccessToken)
+	require.Equal(t, []string{"refresh_token", "refresh_token", "password"}, grants)
+
+	o = &fastreq.Oauth2{
+		TokenURL:     "http://auth.fasthttp.great/token",
+		Grant:        fastreq.Oauth2GrantRefreshToken,
+		RefreshToken: "expired",
+		Client:       srv.Client(),
+	}
+	_, err = o.Token()
+	var oerr *fastreq.Oauth2Error
+	require.ErrorAs(t, err, &oerr)
+	require.Equal(t, "invalid_grant", oerr.Code)
+	require.Equal(t, fasthttp.StatusBadRequest, oerr.StatusCode)
+}
+
+func Test_Oauth2_Unauthorized(t *testing.T) {
+	var issued atomic.Int64
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/token").Times(2).Handle(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetContentType("application/json")
+		fmt.Fprintf(ctx, `{"access_token":"t%d"}`, issued.Add(1))
+	})
+	srv.On(fastreq.POST, "/").Times(2).Handle(func(ctx *fasthttp.RequestCtx) {
+		// the first token was revoked
+		if string(ctx.Request.Header.Peek("Authorization")) == "Bearer t1" {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			return
+		}
+		ctx.SetBody(ctx.Request.Header.Peek("Authorization"))
+	})
+	client := srv.Client()
+	o := &fastreq.Oauth2{ClientID: "client", ClientSecret: "secret", TokenURL: "http://auth.fasthttp.great/token", Client: client}
+	client.SetOauth2(o)
+
+	resp, err := client.Post("http://api.fasthttp.great/", fastreq.NewBody([]byte("body")))
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Equal(t, "Bearer t2", string(resp.Body()))
+	resp.Release()
+	require.Equal(t, int64(2), issued.Load())
+}
+
+func Test_Oauth2_DeviceCode(t *testing.T) {
+	var polls atomic.Int64
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/device").Once().Handle(func(ctx *fasthttp.RequestCtx) {
+		require.Equal(t, "client", string(ctx.PostArgs().Peek("client_id")))
+		ctx.SetContentType("application/json")
+		ctx.SetBodyString(`{"device_code":"GmRhmhcxhwAzkoEqiMEg_DnyEysNkuNhszIySk9eS","user_code":"WDJB-MJHT",` +
+			`"verification_uri":"https://example.com/device","expires_in":1800,"interval":1}`)
+	})
+	srv.On(fastreq.POST, "/token").Times(2).Handle(func(ctx *fasthttp.RequestCtx) {
+		require.Equal(t, "urn:ietf:params:oauth:grant-type:device_code", string(ctx.PostArgs().Peek("grant_type")))
+		require.Equal(t, "GmRhmhcxhwAzkoEqiMEg_DnyEysNkuNhszIySk9eS", string(ctx.PostArgs().Peek("device_code")))
+		ctx.SetContentType("application/json")
+		if polls.Add(1) == 1 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			ctx.SetBodyString(`{"error":"authorization_pending"}`)
+			return
+		}
+		ctx.SetBodyString(`{"access_token":"t1"}`)
+	})
+
+	var userCode string
+	o := &fastreq.Oauth2{
+		ClientID:      "client",
+		TokenURL:      "http://auth.fasthttp.great/token",
+		DeviceAuthURL: "http://auth.fasthttp.great/device",
+		Grant:         fastreq.Oauth2GrantDeviceCode,
+		DeviceCodeHandler: func(code *fastreq.Oauth2DeviceCode) {
+			userCode = code.UserCode
+		},
+		Client: srv.Client(),
+	}
+	token, err := o.Token()
+	require.NoError(t, err)
+	require.Equal(t, "t1", token.AccessToken)
+	require.Equal(t, "WDJB-MJHT", userCode)
+	require.Equal(t, int64(2), polls.Load())
+}
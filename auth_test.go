@@ -0,0 +1,122 @@
+package fastreq
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// parseOauthHeader returns the parameters of an OAuth Authorization header.
+func parseOauthHeader(t *testing.T, header string) map[string]string {
+	require.True(t, strings.HasPrefix(header, "OAuth "), header)
+	params := make(map[string]string)
+	for _, p := range strings.Split(strings.TrimPrefix(header, "OAuth "), ", ") {
+		key, value, ok := strings.Cut(p, "=")
+		require.True(t, ok, p)
+		value, err := url.PathUnescape(strings.Trim(value, `"`))
+		require.NoError(t, err)
+		params[key] = value
+	}
+	return params
+}
+
+func Test_Oauth1_BaseString(t *testing.T) {
+	// RFC 5849 section 3.4.1.1
+	req := NewRequest(POST, "http://example.com/request?b5=%3D%253D&a3=a&c%40=&a2=r%20b")
+	defer req.Release()
+	req.Header.SetContentType(MIMEApplicationForm)
+	req.SetBodyString("c2&a3=2+q")
+
+	o := Oauth1{ConsumerKey: "9djdj82h48djs9d2", AccessToken: "kkk9d7dh3k39sjv7"}
+	params := []oauthParam{
+		{"oauth_consumer_key", "9djdj82h48djs9d2"},
+		{"oauth_token", "kkk9d7dh3k39sjv7"},
+		{"oauth_signature_method", "HMAC-SHA1"},
+		{"oauth_timestamp", "137131201"},
+		{"oauth_nonce", "7d8f3e4a"},
+	}
+	require.Equal(t,
+		"POST&http%3A%2F%2Fexample.com%2Frequest&a2%3Dr%2520b%26a3%3D2%2520q"+
+			"%26a3%3Da%26b5%3D%253D%25253D%26c%2540%3D%26c2%3D%26oauth_consumer_"+
+			"key%3D9djdj82h48djs9d2%26oauth_nonce%3D7d8f3e4a%26oauth_signature_m"+
+			"ethod%3DHMAC-SHA1%26oauth_timestamp%3D137131201%26oauth_token%3Dkkk"+
+			"9d7dh3k39sjv7",
+		o.baseString(req, params))
+
+	// RFC 5849 section 3.4.1.2
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+	require.NoError(t, uri.Parse(nil, []byte("HTTP://EXAMPLE.COM:80/r%20v/X?id=123")))
+	require.Equal(t, "http://example.com/r%20v/X", oauthBaseURI(uri))
+	require.NoError(t, uri.Parse(nil, []byte("https://www.example.net:8080/?q=1")))
+	require.Equal(t, "https://www.example.net:8080/", oauthBaseURI(uri))
+	require.NoError(t, uri.Parse(nil, []byte("https://www.example.net:443/a")))
+	require.Equal(t, "https://www.example.net/a", oauthBaseURI(uri))
+
+	require.Equal(t, "Ladies%20%2B%20Gentlemen~%21", escapeRFC3986("Ladies + Gentlemen~!"))
+}
+
+func Test_Oauth1_Signature(t *testing.T) {
+	// the example of appendix A of the OAuth Core 1.0 specification
+	req := NewRequest(GET, "http://photos.example.net/photos?file=vacation.jpg&size=original")
+	defer req.Release()
+
+	o := Oauth1{
+		ConsumerKey:    "dpf43f3p2l4k3l03",
+		ConsumerSecret: "kd94hf93k423kf44",
+		AccessToken:    "nnch734d00sl2jdk",
+		AccessSecret:   "pfkkdhi9sl3r4s00",
+		Realm:          "http://photos.example.net/",
+	}
+	header, err := o.sign(req, o.params("kllo9940pd9333jh", 1191242096))
+	require.NoError(t, err)
+	require.Equal(t, `OAuth realm="http://photos.example.net/", `+
+		`oauth_consumer_key="dpf43f3p2l4k3l03", oauth_nonce="kllo9940pd9333jh", `+
+		`oauth_signature="tR3%2BTy81lMeYAr%2FFid0kMTYa%2FWM%3D", oauth_signature_method="HMAC-SHA1", `+
+		`oauth_timestamp="1191242096", oauth_token="nnch734d00sl2jdk", oauth_version="1.0"`, string(header))
+
+	o.SignatureMethod = Oauth1HMACSHA256
+	header, err = o.sign(req, o.params("kllo9940pd9333jh", 1191242096))
+	require.NoError(t, err)
+	params := parseOauthHeader(t, string(header))
+	require.Equal(t, "HMAC-SHA256", params["oauth_signature_method"])
+	require.Equal(t, "WVPzl1j6ZsnkIjWr7e3OZ3jkenL57KwaLFhYsroX1hg=", params["oauth_signature"])
+
+	// RFC 5849 section 3.4.4
+	o = Oauth1{ConsumerSecret: "djr9rjt0jd78jf88", AccessSecret: "jjd999tj88uiths3", SignatureMethod: Oauth1Plaintext}
+	params = parseOauthHeader(t, string(o.GenHeader(req)))
+	require.Equal(t, "djr9rjt0jd78jf88&jjd999tj88uiths3", params["oauth_signature"])
+
+	o.SignatureMethod = "MD5"
+	require.Nil(t, o.GenHeader(req))
+	require.Error(t, o.Sign(req))
+}
+
+func Test_Oauth1_RSASHA1(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	req := NewRequest(GET, "http://photos.example.net/photos?size=original")
+	defer req.Release()
+
+	o := Oauth1{ConsumerKey: "dpf43f3p2l4k3l03", SignatureMethod: Oauth1RSASHA1}
+	require.Error(t, o.Sign(req))
+
+	o.PrivateKey = key
+	params := o.params("13917289812797014437", 1196666512)
+	header, err := o.sign(req, params)
+	require.NoError(t, err)
+
+	signature, err := base64.StdEncoding.DecodeString(parseOauthHeader(t, string(header))["oauth_signature"])
+	require.NoError(t, err)
+	digest := sha1.Sum([]byte(o.baseString(req, params)))
+	require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature))
+}
@@ -0,0 +1,261 @@
+package fastreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// defaultBatchConcurrency is the number of requests a batch sends at the same
+// time if BatchConfig.Concurrency is not set.
+const defaultBatchConcurrency = 10
+
+// BatchConfig configures Client.Batch and Client.BatchChan.
+type BatchConfig struct {
+	// Concurrency is the number of requests sent at the same time, 10 by default.
+	Concurrency int
+	// PerHost limits the number of requests sent to the same host at the same
+	// time, 0 means no limit besides Concurrency.
+	PerHost int
+	// Ordered passes the results to the callback in the order of the requests.
+	// Otherwise the results are passed as soon as they are finished.
+	Ordered bool
+	// FailFast stops the batch at the first failed request and returns its error.
+	// Otherwise all requests are sent and the errors are returned together.
+	FailFast bool
+	// Dropped is called with each request whose result is not passed to the
+	// callback, because the batch was stopped. With BatchChan, the requests
+	// can only be released here. The calls are never concurrent with the
+	// callback.
+	Dropped func(req *Request)
+}
+
+// BatchResult is the result of a request of a batch.
+type BatchResult struct {
+	// Index is the position of the request in the batch.
+	Index   int
+	Request *Request
+	// Response is nil if the request failed. It is released once the callback
+	// returns, use Response.Copy to keep it.
+	Response *Response
+	Err      error
+
+	skipped bool // not sent, because the batch was stopped
+}
+
+// BatchFunc is called with the result of each request of a batch. The calls are
+// never concurrent. Returning an error stops the batch.
+type BatchFunc func(result *BatchResult) error
+
+// Batch sends the requests with bounded concurrency and passes each result to fn.
+// It returns once all requests are done, or the batch is stopped by ctx, by fn
+// or by a failed request in fail-fast mode. Requests which are running when the
+// batch is stopped are finished, but their results are dropped.
+//
+// The caller keeps the ownership of the requests, Batch never releases them.
+func (c *Client) Batch(ctx context.Context, reqs []*Request, fn BatchFunc, config ...*BatchConfig) error {
+	i := 0
+	return c.batch(ctx, func(context.Context) (*Request, bool) {
+		if i >= len(reqs) {
+			return nil, false
+		}
+		i++
+		return reqs[i-1], true
+	}, fn, config)
+}
+
+// BatchChan is like Batch, but receives the requests from a channel until it is
+// closed. The requests can be released by fn, they are not used afterwards.
+// Requests received before the batch is stopped whose results are dropped are
+// passed to BatchConfig.Dropped instead, which should release them.
+func (c *Client) BatchChan(ctx context.Context, reqs <-chan *Request, fn BatchFunc, config ...*BatchConfig) error {
+	return c.batch(ctx, func(ctx context.Context) (*Request, bool) {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case req, ok := <-reqs:
+			return req, ok
+		}
+	}, fn, config)
+}
+
+// batchJob is a request of a batch with its position.
+type batchJob struct {
+	index int
+	req   *Request
+}
+
+// batch runs the requests returned by next until it returns false. next must
+// return false once the given context is done.
+func (c *Client) batch(parent context.Context, next func(context.Context) (*Request, bool), fn BatchFunc, config []*BatchConfig) error {
+	cfg := BatchConfig{}
+	if len(config) > 0 && config[0] != nil {
+		cfg = *config[0]
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultBatchConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	// in order, finished results wait for the ones before them, so the number of
+	// requests in flight is limited to keep the waiting results bounded
+	var window chan struct{}
+	if cfg.Ordered {
+		window = make(chan struct{}, 2*cfg.Concurrency)
+	}
+
+	jobs := make(chan batchJob)
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			if window != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case window <- struct{}{}:
+				}
+			}
+			req, ok := next(ctx)
+			if !ok {
+				return
+			}
+			// the workers drain the jobs, a stopped batch passes the request
+			// on as skipped
+			jobs <- batchJob{index: i, req: req}
+		}
+	}()
+
+	results := make(chan *BatchResult, cfg.Concurrency)
+	hosts := &batchHosts{limit: cfg.PerHost}
+	var wg sync.WaitGroup
+	for n := 0; n < cfg.Concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				results <- c.batchDo(ctx, job, hosts)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var (
+		stopped error
+		errs    []error
+		pending = make(map[int]*BatchResult)
+		nextIdx int
+	)
+	emit := func(r *BatchResult) {
+		if window != nil {
+			<-window
+		}
+		defer func() {
+			if r.Response != nil {
+				r.Response.Release()
+			}
+		}()
+		if stopped != nil || r.skipped {
+			if cfg.Dropped != nil {
+				cfg.Dropped(r.Request)
+			}
+			return
+		}
+
+		if err := fn(r); err != nil {
+			stopped = err
+			cancel()
+			return
+		}
+		if r.Err != nil {
+			if cfg.FailFast {
+				stopped = r.Err
+				cancel()
+				return
+			}
+			errs = append(errs, fmt.Errorf("request %d: %w", r.Index, r.Err))
+		}
+	}
+
+	for r := range results {
+		if !cfg.Ordered {
+			emit(r)
+			continue
+		}
+		pending[r.Index] = r
+		for {
+			p, ok := pending[nextIdx]
+			if !ok {
+				break
+			}
+			delete(pending, nextIdx)
+			nextIdx++
+			emit(p)
+		}
+	}
+
+	switch {
+	case stopped != nil:
+		return stopped
+	case parent.Err() != nil:
+		return parent.Err()
+	}
+	return errors.Join(errs...)
+}
+
+// batchDo sends the request of a job, unless the batch is stopped.
+func (c *Client) batchDo(ctx context.Context, job batchJob, hosts *batchHosts) *BatchResult {
+	r := &BatchResult{Index: job.index, Request: job.req}
+
+	release, err := hosts.acquire(ctx, string(job.req.URI().Host()))
+	if err != nil {
+		r.Err, r.skipped = err, true
+		return r
+	}
+	defer release()
+
+	if err := ctx.Err(); err != nil {
+		r.Err, r.skipped = err, true
+		return r
+	}
+	r.Response, r.Err = c.Do(job.req)
+	return r
+}
+
+// batchHosts limits the number of concurrent requests per host.
+type batchHosts struct {
+	limit int
+	mu    sync.Mutex
+	sems  map[string]chan struct{}
+}
+
+// acquire waits until a request can be sent to the host and returns the function
+// which releases the slot again.
+func (h *batchHosts) acquire(ctx context.Context, host string) (func(), error) {
+	if h.limit <= 0 {
+		return func() {}, nil
+	}
+
+	h.mu.Lock()
+	if h.sems == nil {
+		h.sems = make(map[string]chan struct{})
+	}
+	sem, ok := h.sems[host]
+	if !ok {
+		sem = make(chan struct{}, h.limit)
+		h.sems[host] = sem
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	}
+}
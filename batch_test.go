@@ -0,0 +1,218 @@
+package fastreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func newBatchClient(t *testing.T, handler fasthttp.RequestHandler) *Client {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{Handler: handler}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	return client
+}
+
+func newBatchRequests(t *testing.T, n int, url func(i int) string) []*Request {
+	reqs := make([]*Request, n)
+	for i := range reqs {
+		reqs[i] = NewRequest(GET, url(i))
+	}
+	t.Cleanup(func() { releaseRequests(reqs) })
+	return reqs
+}
+
+func Test_Client_Batch_Ordered(t *testing.T) {
+	var inflight, maxInflight atomic.Int64
+	client := newBatchClient(t, func(ctx *fasthttp.RequestCtx) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			m := maxInflight.Load()
+			if n <= m || maxInflight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		// later requests finish first
+		i, _ := strconv.Atoi(string(ctx.QueryArgs().Peek("i")))
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		ctx.SetBodyString(strconv.Itoa(i))
+	})
+
+	reqs := newBatchRequests(t, 20, func(i int) string {
+		return fmt.Sprintf("http://make.fasthttp.great/?i=%d", i)
+	})
+
+	var bodies []string
+	var responses []*Response
+	err := client.Batch(context.Background(), reqs, func(r *BatchResult) error {
+		require.NoError(t, r.Err)
+		require.Same(t, reqs[r.Index], r.Request)
+		bodies = append(bodies, string(r.Response.Body()))
+		responses = append(responses, r.Response)
+		return nil
+	}, &BatchConfig{Concurrency: 4, Ordered: true})
+	require.NoError(t, err)
+
+	expected := make([]string, 20)
+	for i := range expected {
+		expected[i] = strconv.Itoa(i)
+	}
+	require.Equal(t, expected, bodies)
+	require.LessOrEqual(t, maxInflight.Load(), int64(4))
+
+	// the responses are released once the callback returned
+	for _, resp := range responses {
+		require.Nil(t, resp.Response)
+	}
+}
+
+func Test_Client_Batch_PerHost(t *testing.T) {
+	var mu sync.Mutex
+	inflight := map[string]int{}
+	maxInflight := map[string]int{}
+	client := newBatchClient(t, func(ctx *fasthttp.RequestCtx) {
+		host := string(ctx.Host())
+		mu.Lock()
+		inflight[host]++
+		if inflight[host] > maxInflight[host] {
+			maxInflight[host] = inflight[host]
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inflight[host]--
+		mu.Unlock()
+	})
+
+	reqs := newBatchRequests(t, 30, func(i int) string {
+		return fmt.Sprintf("http://host%d.fasthttp.great/", i%3)
+	})
+
+	var finished int
+	err := client.Batch(context.Background(), reqs, func(r *BatchResult) error {
+		finished++
+		return r.Err
+	}, &BatchConfig{Concurrency: 9, PerHost: 2})
+	require.NoError(t, err)
+	require.Equal(t, 30, finished)
+	require.Equal(t, map[string]int{"host0.fasthttp.great": 2, "host1.fasthttp.great": 2, "host2.fasthttp.great": 2}, maxInflight)
+}
+
+func Test_Client_Batch_Errors(t *testing.T) {
+	var calls atomic.Int64
+	client := newBatchClient(t, func(ctx *fasthttp.RequestCtx) {
+		calls.Add(1)
+	})
+	dial := client.Dial
+	client.Dial = func(addr string) (net.Conn, error) {
+		if addr == "fail.fasthttp.great:80" {
+			return nil, fasthttp.ErrDialTimeout
+		}
+		return dial(addr)
+	}
+
+	reqs := newBatchRequests(t, 10, func(i int) string {
+		if i%5 == 1 {
+			return "http://fail.fasthttp.great/"
+		}
+		return "http://make.fasthttp.great/"
+	})
+
+	// collect-all sends every request and joins the errors
+	err := client.Batch(context.Background(), reqs, func(r *BatchResult) error { return nil },
+		&BatchConfig{Concurrency: 1})
+	require.ErrorIs(t, err, fasthttp.ErrDialTimeout)
+	require.ErrorContains(t, err, "request 1: ")
+	require.ErrorContains(t, err, "request 6: ")
+
+	// fail-fast stops at the first error
+	var results int
+	err = client.Batch(context.Background(), reqs, func(r *BatchResult) error {
+		results++
+		return nil
+	}, &BatchConfig{Concurrency: 1, FailFast: true, Ordered: true})
+	require.ErrorIs(t, err, fasthttp.ErrDialTimeout)
+	require.LessOrEqual(t, results, 3)
+
+	// errors of the callback stop the batch
+	stop := errors.New("stop")
+	err = client.Batch(context.Background(), reqs, func(r *BatchResult) error {
+		return stop
+	}, &BatchConfig{Concurrency: 1})
+	require.ErrorIs(t, err, stop)
+}
+
+func Test_Client_BatchChan_Cancel(t *testing.T) {
+	client := newBatchClient(t, func(ctx *fasthttp.RequestCtx) {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reqs := make(chan *Request)
+	go func() {
+		// the channel is never closed, the batch ends by cancellation
+		for i := 0; i < 5; i++ {
+			reqs <- NewRequest(GET, "http://make.fasthttp.great/")
+		}
+	}()
+
+	var results int
+	err := client.BatchChan(ctx, reqs, func(r *BatchResult) error {
+		require.NoError(t, r.Err)
+		r.Request.Release()
+		if results++; results == 5 {
+			cancel()
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 5, results)
+}
+
+func Test_Client_BatchChan_Dropped(t *testing.T) {
+	client := newBatchClient(t, func(ctx *fasthttp.RequestCtx) {})
+
+	reqs := make(chan *Request, 20)
+	for i := 0; i < cap(reqs); i++ {
+		reqs <- NewRequest(GET, "http://make.fasthttp.great/")
+	}
+	close(reqs)
+
+	// every request taken from the channel is passed on exactly once
+	var passed, dropped int
+	stop := errors.New("stop")
+	err := client.BatchChan(context.Background(), reqs, func(r *BatchResult) error {
+		passed++
+		r.Request.Release()
+		return stop
+	}, &BatchConfig{Concurrency: 4, Dropped: func(req *Request) {
+		dropped++
+		req.Release()
+	}})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, passed)
+	require.Equal(t, cap(reqs)-len(reqs), passed+dropped)
+	for req := range reqs {
+		req.Release()
+	}
+}
@@ -0,0 +1,395 @@
+package fastreq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// benchMaxLatency is the highest latency tracked by the histograms of Bench.
+// Longer latencies are recorded as benchMaxLatency.
+const benchMaxLatency = time.Minute
+
+// BenchPercentiles are the latency percentiles reported by BenchResult.
+var BenchPercentiles = []float64{50, 75, 90, 95, 99, 99.9}
+
+// BenchConfig configures a load test run by Client.Bench.
+type BenchConfig struct {
+	// Requests are the templates of the requests, which are sent round robin.
+	// Each request sends a copy, the templates are not modified.
+	Requests []*Request
+	// Concurrency is the number of requests sent at the same time, 1 by default.
+	Concurrency int
+	// Rate is the number of requests per second. With a rate, requests are
+	// started on a fixed schedule and latencies include the time a request had
+	// to wait for a free worker. Without a rate, each worker sends its next
+	// request as soon as the previous one is done.
+	Rate float64
+	// Duration stops the test after the given time.
+	Duration time.Duration
+	// Count stops the test after the given number of requests.
+	Count int
+}
+
+// BenchLatency is the latency distribution of a load test.
+type BenchLatency struct {
+	Min         time.Duration            `json:"min"`
+	Mean        time.Duration            `json:"mean"`
+	Max         time.Duration            `json:"max"`
+	StdDev      time.Duration            `json:"stddev"`
+	Percentiles map[string]time.Duration `json:"percentiles"`
+}
+
+// BenchResult is the result of a load test. It is encoded to JSON with all
+// durations in nanoseconds, e.g. to compare runs in CI.
+type BenchResult struct {
+	Requests    int64            `json:"requests"`
+	Errors      int64            `json:"errors"`
+	Duration    time.Duration    `json:"duration"`
+	Throughput  float64          `json:"throughput"`
+	BytesRead   int64            `json:"bytes_read"`
+	Latency     BenchLatency     `json:"latency"`
+	StatusCodes map[int]int64    `json:"status_codes"`
+	ErrorCounts map[string]int64 `json:"error_counts,omitempty"`
+
+	histogram *hdrhistogram.Histogram
+}
+
+// Percentile returns the latency at the given percentile, e.g. 99.9.
+func (r *BenchResult) Percentile(p float64) time.Duration {
+	if r.histogram == nil {
+		return 0
+	}
+	return time.Duration(r.histogram.ValueAtQuantile(p)) * time.Microsecond
+}
+
+// WriteJSON writes the result as indented JSON.
+func (r *BenchResult) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// String returns a human readable summary of the result.
+func (r *BenchResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summary:\n")
+	fmt.Fprintf(&b, "  Requests:\t%d\n", r.Requests)
+	fmt.Fprintf(&b, "  Errors:\t%d\n", r.Errors)
+	fmt.Fprintf(&b, "  Duration:\t%s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "  Throughput:\t%.2f req/s\n", r.Throughput)
+	fmt.Fprintf(&b, "  Bytes read:\t%d\n", r.BytesRead)
+
+	fmt.Fprintf(&b, "\nLatency:\n")
+	fmt.Fprintf(&b, "  Min:\t%s\n", r.Latency.Min)
+	fmt.Fprintf(&b, "  Mean:\t%s\n", r.Latency.Mean)
+	fmt.Fprintf(&b, "  Max:\t%s\n", r.Latency.Max)
+	fmt.Fprintf(&b, "  StdDev:\t%s\n", r.Latency.StdDev)
+	for _, p := range BenchPercentiles {
+		fmt.Fprintf(&b, "  p%s:\t%s\n", formatPercentile(p), r.Percentile(p))
+	}
+
+	if len(r.StatusCodes) > 0 {
+		fmt.Fprintf(&b, "\nStatus codes:\n")
+		codes := make([]int, 0, len(r.StatusCodes))
+		for code := range r.StatusCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&b, "  %d:\t%d\n", code, r.StatusCodes[code])
+		}
+	}
+
+	if len(r.ErrorCounts) > 0 {
+		fmt.Fprintf(&b, "\nErrors:\n")
+		errs := make([]string, 0, len(r.ErrorCounts))
+		for err := range r.ErrorCounts {
+			errs = append(errs, err)
+		}
+		sort.Strings(errs)
+		for _, err := range errs {
+			fmt.Fprintf(&b, "  %s:\t%d\n", err, r.ErrorCounts[err])
+		}
+	}
+	return b.String()
+}
+
+// formatPercentile formats a percentile without trailing zeros, e.g. 99.9.
+func formatPercentile(p float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.3f", p), "0"), ".")
+}
+
+// benchWorker holds the results of a single worker, which are merged at the end.
+type benchWorker struct {
+	histogram   *hdrhistogram.Histogram
+	statusCodes map[int]int64
+	errorCounts map[string]int64
+	requests    int64
+	errors      int64
+	bytesRead   int64
+}
+
+// record records the result of a request started at start.
+func (w *benchWorker) record(start time.Time, resp *Response, err error) {
+	latency := time.Since(start)
+	if latency > benchMaxLatency {
+		latency = benchMaxLatency
+	}
+	_ = w.histogram.RecordValue(latency.Microseconds())
+
+	w.requests++
+	if err != nil {
+		w.errors++
+		w.errorCounts[err.Error()]++
+		return
+	}
+	w.statusCodes[resp.StatusCode()]++
+	w.bytesRead += int64(len(resp.Body()))
+}
+
+// Bench runs a load test with the requests of the config and reports latencies,
+// status codes, errors and throughput. The test stops after the configured
+// duration or count, or when ctx is done.
+func (c *Client) Bench(ctx context.Context, config BenchConfig) (*BenchResult, error) {
+	if len(config.Requests) == 0 {
+		return nil, errors.New("fastreq: no requests to bench")
+	}
+	if config.Duration <= 0 && config.Count <= 0 {
+		return nil, errors.New("fastreq: bench needs a duration or a count")
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Duration)
+		defer cancel()
+	}
+
+	// each request receives its scheduled start time
+	starts := make(chan time.Time, config.Concurrency)
+	if config.Rate > 0 {
+		go benchSchedule(ctx, starts, config.Rate, config.Count)
+	} else {
+		go benchLoop(ctx, starts, config.Count)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		next    atomic.Uint64
+		workers = make([]*benchWorker, config.Concurrency)
+	)
+	begin := time.Now()
+	for i := range workers {
+		w := &benchWorker{
+			histogram:   hdrhistogram.New(1, benchMaxLatency.Microseconds(), 3),
+			statusCodes: make(map[int]int64),
+			errorCounts: make(map[string]int64),
+		}
+		workers[i] = w
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				if config.Rate <= 0 {
+					start = time.Now()
+				}
+				tmpl := config.Requests[(next.Add(1)-1)%uint64(len(config.Requests))]
+				req := tmpl.Copy()
+				resp, err := c.Do(req)
+				w.record(start, resp, err)
+				if resp != nil {
+					resp.Release()
+				}
+				req.Release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return mergeBenchWorkers(workers, time.Since(begin)), nil
+}
+
+// benchLoop starts requests whenever a worker is free, until ctx is done or count
+// requests were started. The workers measure the latency from the time they
+// receive a request.
+func benchLoop(ctx context.Context, starts chan<- time.Time, count int) {
+	defer close(starts)
+	for i := 0; count <= 0 || i < count; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case starts <- time.Now():
+		}
+	}
+}
+
+// benchSchedule sends the scheduled start times of requests at the given rate,
+// until ctx is done or count requests were scheduled. Requests which wait for a
+// free worker keep their scheduled time, so that the waiting time is part of
+// their latency and slow responses are not hidden by a lower request rate.
+func benchSchedule(ctx context.Context, starts chan<- time.Time, rate float64, count int) {
+	defer close(starts)
+
+	interval := time.Duration(float64(time.Second) / rate)
+	begin := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for i := 0; count <= 0 || i < count; i++ {
+		start := begin.Add(time.Duration(i) * interval)
+		if wait := time.Until(start); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case starts <- start:
+		}
+	}
+}
+
+// mergeBenchWorkers merges the results of the workers.
+func mergeBenchWorkers(workers []*benchWorker, duration time.Duration) *BenchResult {
+	r := &BenchResult{
+		Duration:    duration,
+		StatusCodes: make(map[int]int64),
+		ErrorCounts: make(map[string]int64),
+		histogram:   hdrhistogram.New(1, benchMaxLatency.Microseconds(), 3),
+	}
+	for _, w := range workers {
+		r.histogram.Merge(w.histogram)
+		r.Requests += w.requests
+		r.Errors += w.errors
+		r.BytesRead += w.bytesRead
+		for code, n := range w.statusCodes {
+			r.StatusCodes[code] += n
+		}
+		for err, n := range w.errorCounts {
+			r.ErrorCounts[err] += n
+		}
+	}
+
+	if duration > 0 {
+		r.Throughput = float64(r.Requests) / duration.Seconds()
+	}
+	if r.Requests > 0 {
+		r.Latency = BenchLatency{
+			Min:         time.Duration(r.histogram.Min()) * time.Microsecond,
+			Mean:        time.Duration(math.Round(r.histogram.Mean())) * time.Microsecond,
+			Max:         time.Duration(r.histogram.Max()) * time.Microsecond,
+			StdDev:      time.Duration(math.Round(r.histogram.StdDev())) * time.Microsecond,
+			Percentiles: make(map[string]time.Duration, len(BenchPercentiles)),
+		}
+		for _, p := range BenchPercentiles {
+			r.Latency.Percentiles["p"+formatPercentile(p)] = r.Percentile(p)
+		}
+	}
+	return r
+}
+
+// LoadBenchRequests loads the request templates of a load test from a file,
+// which is either a HAR file or contains curl commands. Each curl command starts
+// on a new line with "curl", empty lines and lines starting with # are ignored.
+func LoadBenchRequests(path string) ([]*Request, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		imports, err := ReadHAR(bytes.NewReader(trimmed))
+		if err != nil {
+			return nil, err
+		}
+		reqs := make([]*Request, len(imports))
+		for i, imp := range imports {
+			reqs[i] = imp.Request
+		}
+		for _, imp := range imports {
+			if err := prepareTemplate(imp.Request, imp.Options); err != nil {
+				releaseRequests(reqs)
+				return nil, err
+			}
+		}
+		if len(reqs) == 0 {
+			return nil, fmt.Errorf("fastreq: no requests in %s", path)
+		}
+		return reqs, nil
+	}
+
+	var (
+		reqs     []*Request
+		commands []string
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "curl ") || len(commands) == 0:
+			commands = append(commands, line)
+		default:
+			commands[len(commands)-1] += "\n" + line
+		}
+	}
+
+	for _, cmd := range commands {
+		req, opts, err := ParseCurl(cmd)
+		if err == nil {
+			err = prepareTemplate(req, opts)
+		}
+		if err != nil {
+			releaseRequests(reqs)
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("fastreq: no requests in %s", path)
+	}
+	return reqs, nil
+}
+
+// prepareTemplate binds the options to a request template and completes its
+// multipart body, so that copies of it can be sent as they are.
+func prepareTemplate(req *Request, opts []ReqOption) error {
+	for _, o := range opts {
+		if err := o.BindRequest(req); err != nil {
+			return err
+		}
+		if o.isAutoRelease() {
+			Release(o)
+		}
+	}
+	return req.closeMultipart()
+}
+
+// releaseRequests releases all requests.
+func releaseRequests(reqs []*Request) {
+	for _, req := range reqs {
+		req.Release()
+	}
+}
@@ -0,0 +1,154 @@
+package fastreq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func newBenchServer(t *testing.T, handler fasthttp.RequestHandler) *Client {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{Handler: handler}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	return client
+}
+
+func Test_Client_Bench_Count(t *testing.T) {
+	var calls, posts atomic.Int64
+	client := newBenchServer(t, func(ctx *fasthttp.RequestCtx) {
+		calls.Add(1)
+		if string(ctx.PostArgs().Peek("name")) == "fastreq" {
+			posts.Add(1)
+		}
+		if string(ctx.Path()) == "/fail" {
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			return
+		}
+		ctx.SetBodyString("ok")
+	})
+
+	get := NewRequest(GET, "http://make.fasthttp.great/")
+	defer get.Release()
+	post := NewRequest(POST, "http://make.fasthttp.great/")
+	defer post.Release()
+	post.SetPostForm(NewPostForm("name", "fastreq"))
+	fail := NewRequest(GET, "http://make.fasthttp.great/fail")
+	defer fail.Release()
+
+	result, err := client.Bench(context.Background(), BenchConfig{
+		Requests:    []*Request{get, post, get, fail},
+		Concurrency: 4,
+		Count:       100,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(100), calls.Load())
+	require.Equal(t, int64(25), posts.Load())
+	require.Equal(t, int64(100), result.Requests)
+	require.Equal(t, int64(0), result.Errors)
+	require.Equal(t, map[int]int64{200: 75, 500: 25}, result.StatusCodes)
+	require.Equal(t, int64(150), result.BytesRead)
+	require.Greater(t, result.Throughput, 0.0)
+	require.LessOrEqual(t, result.Latency.Min, result.Percentile(50))
+	require.LessOrEqual(t, result.Percentile(50), result.Percentile(99))
+	require.LessOrEqual(t, result.Percentile(99), result.Latency.Max)
+
+	var buf bytes.Buffer
+	require.NoError(t, result.WriteJSON(&buf))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, float64(100), decoded["requests"])
+	require.Equal(t, map[string]any{"200": float64(75), "500": float64(25)}, decoded["status_codes"])
+	require.Contains(t, decoded["latency"].(map[string]any)["percentiles"], "p99.9")
+
+	require.Contains(t, result.String(), "Requests:\t100\n")
+	require.Contains(t, result.String(), "  500:\t25\n")
+}
+
+func Test_Client_Bench_Rate(t *testing.T) {
+	client := newBenchServer(t, func(ctx *fasthttp.RequestCtx) {})
+
+	req := NewRequest(GET, "http://make.fasthttp.great/")
+	defer req.Release()
+
+	result, err := client.Bench(context.Background(), BenchConfig{
+		Requests:    []*Request{req},
+		Concurrency: 2,
+		Rate:        100,
+		Duration:    300 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	// 30 requests are scheduled within 300ms at 100 req/s
+	require.InDelta(t, 30, result.Requests, 5)
+	require.Equal(t, result.Requests, result.StatusCodes[200])
+}
+
+func Test_Client_Bench_Errors(t *testing.T) {
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return nil, fasthttp.ErrDialTimeout
+	}
+
+	req := NewRequest(GET, "http://make.fasthttp.great/")
+	defer req.Release()
+
+	result, err := client.Bench(context.Background(), BenchConfig{Requests: []*Request{req}, Count: 3})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), result.Errors)
+	require.Equal(t, map[string]int64{fasthttp.ErrDialTimeout.Error(): 3}, result.ErrorCounts)
+
+	_, err = client.Bench(context.Background(), BenchConfig{Requests: []*Request{req}})
+	require.Error(t, err)
+	_, err = client.Bench(context.Background(), BenchConfig{Count: 1})
+	require.Error(t, err)
+}
+
+func Test_LoadBenchRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`# create a user
+curl -X POST http://make.fasthttp.great/users \
+  -H 'Content-Type: application/json' \
+  -d '{"name":"fastreq"}'
+
+curl http://make.fasthttp.great/upload -F foo=bar -x 127.0.0.1:8080
+`), 0o600))
+
+	reqs, err := LoadBenchRequests(path)
+	require.NoError(t, err)
+	require.Len(t, reqs, 2)
+	defer releaseRequests(reqs)
+
+	require.Equal(t, `{"name":"fastreq"}`, string(reqs[0].Body()))
+	require.Equal(t, "application/json", string(reqs[0].Header.ContentType()))
+	require.Contains(t, string(reqs[1].Header.ContentType()), "multipart/form-data; boundary=")
+	require.Contains(t, string(reqs[1].Body()), "bar")
+
+	// copies keep the per-request settings of the template
+	c := reqs[1].Copy()
+	defer c.Release()
+	require.Equal(t, "127.0.0.1:8080", c.proxy)
+
+	require.NoError(t, os.WriteFile(path, []byte("# nothing\n"), 0o600))
+	_, err = LoadBenchRequests(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,374 @@
+package fastreq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// CassetteMode controls whether a Cassette records or replays requests.
+type CassetteMode int
+
+const (
+	// CassetteAuto replays from the cassette file if it exists, otherwise requests
+	// are sent over the network and recorded.
+	CassetteAuto CassetteMode = iota
+	// CassetteRecord always sends requests over the network and records them,
+	// replacing the interactions recorded before.
+	CassetteRecord
+	// CassetteReplay only replays recorded requests and never touches the network.
+	CassetteReplay
+)
+
+// cassetteVersion is the version of the cassette file format.
+const cassetteVersion = 1
+
+// redactedValue replaces redacted values in cassettes.
+const redactedValue = "REDACTED"
+
+// DefaultRedactHeaders are the headers which are always redacted, unless
+// CassetteConfig.NoDefaultRedactHeaders is set.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// ErrCassetteMiss is returned when a replayed request has no recorded interaction.
+var ErrCassetteMiss = errors.New("fastreq: no recorded interaction matches the request")
+
+// CassetteMatcher reports whether a request matches a recorded request. The request
+// is redacted the same way as the recorded one before they are compared.
+type CassetteMatcher func(req, recorded *CassetteRequest) bool
+
+// MatchMethod matches requests with the same method.
+func MatchMethod(req, recorded *CassetteRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches requests with the same URL.
+func MatchURL(req, recorded *CassetteRequest) bool {
+	return req.URL == recorded.URL
+}
+
+// MatchBody matches requests with the same body.
+func MatchBody(req, recorded *CassetteRequest) bool {
+	return req.Body == recorded.Body && req.BodyEncoding == recorded.BodyEncoding
+}
+
+// MatchHeaders returns a matcher which matches requests with the same values of
+// the given headers.
+func MatchHeaders(names ...string) CassetteMatcher {
+	return func(req, recorded *CassetteRequest) bool {
+		for _, name := range names {
+			if strings.Join(req.Headers.values(name), "\n") != strings.Join(recorded.Headers.values(name), "\n") {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// CassetteConfig Cassette Config
+type CassetteConfig struct {
+	// Mode of the cassette, CassetteAuto by default.
+	Mode CassetteMode
+
+	// Matchers decide which recorded interaction is replayed for a request.
+	// MatchMethod and MatchURL are used if none are provided.
+	Matchers []CassetteMatcher
+
+	// RedactHeaders are request and response headers whose values are never
+	// written, in addition to DefaultRedactHeaders.
+	RedactHeaders []string
+	// NoDefaultRedactHeaders writes the values of DefaultRedactHeaders which
+	// are not in RedactHeaders.
+	NoDefaultRedactHeaders bool
+
+	// RedactQuery are query parameters whose values are never written.
+	RedactQuery []string
+
+	// Redact is called for each interaction before it is written, to redact
+	// secrets the other options can not reach, like parts of the body.
+	Redact func(i *Interaction)
+}
+
+// CassetteHeaders are the headers of a recorded request or response.
+type CassetteHeaders map[string][]string
+
+// values returns the values of the header with the given name.
+func (h CassetteHeaders) values(name string) []string {
+	for k, v := range h {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// del deletes the header with the given name.
+func (h CassetteHeaders) del(name string) {
+	for k := range h {
+		if strings.EqualFold(k, name) {
+			delete(h, k)
+		}
+	}
+}
+
+// CassetteRequest is a recorded request.
+type CassetteRequest struct {
+	Method       string          `json:"method"`
+	URL          string          `json:"url"`
+	Headers      CassetteHeaders `json:"headers,omitempty"`
+	Body         string          `json:"body,omitempty"`
+	BodyEncoding string          `json:"body_encoding,omitempty"`
+}
+
+// CassetteResponse is a recorded response.
+type CassetteResponse struct {
+	StatusCode   int             `json:"status_code"`
+	Headers      CassetteHeaders `json:"headers,omitempty"`
+	Body         string          `json:"body,omitempty"`
+	BodyEncoding string          `json:"body_encoding,omitempty"`
+}
+
+// Interaction is a recorded request together with its response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// cassetteFile is the JSON document a cassette is stored in.
+type cassetteFile struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Cassette records requests and their responses to a JSON file and replays them
+// afterwards, which makes tests against third-party APIs deterministic. Replaying
+// works entirely offline. Use Client.SetCassette to enable it.
+type Cassette struct {
+	path          string
+	mode          CassetteMode
+	matchers      []CassetteMatcher
+	redactHeaders []string
+	redactQuery   []string
+	redact        func(i *Interaction)
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	replayed     []bool
+}
+
+// NewCassette loads the cassette stored at path.
+// If no configuration is provided, the default configuration is used.
+func NewCassette(path string, config ...*CassetteConfig) (*Cassette, error) {
+	realConfig := &CassetteConfig{}
+	if len(config) > 0 {
+		realConfig = config[0]
+	}
+	redactHeaders := realConfig.RedactHeaders
+	if !realConfig.NoDefaultRedactHeaders {
+		redactHeaders = append(append([]string(nil), DefaultRedactHeaders...), redactHeaders...)
+	}
+
+	c := &Cassette{
+		path:          path,
+		mode:          realConfig.Mode,
+		matchers:      realConfig.Matchers,
+		redactHeaders: redactHeaders,
+		redactQuery:   realConfig.RedactQuery,
+		redact:        realConfig.Redact,
+	}
+	if len(c.matchers) == 0 {
+		c.matchers = []CassetteMatcher{MatchMethod, MatchURL}
+	}
+
+	content, err := os.ReadFile(filepath.Clean(path))
+	switch {
+	case err == nil:
+		if c.mode == CassetteAuto {
+			c.mode = CassetteReplay
+		}
+	case errors.Is(err, os.ErrNotExist):
+		if c.mode == CassetteReplay {
+			return nil, err
+		}
+		c.mode = CassetteRecord
+	default:
+		return nil, err
+	}
+
+	if c.mode == CassetteReplay {
+		var f cassetteFile
+		if err := json.Unmarshal(content, &f); err != nil {
+			return nil, fmt.Errorf("fastreq: invalid cassette %s: %w", path, err)
+		}
+		c.interactions = f.Interactions
+		c.replayed = make([]bool, len(f.Interactions))
+	}
+
+	return c, nil
+}
+
+// Mode returns the mode of the cassette. CassetteAuto is resolved to the mode
+// actually used when the cassette was loaded.
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Interactions returns the interactions of the cassette.
+func (c *Cassette) Interactions() []*Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Interaction(nil), c.interactions...)
+}
+
+// roundTrip replays the request of ctx, or sends and records it.
+func (c *Cassette) roundTrip(ctx *Ctx, resp *Response) error {
+	if c.mode == CassetteReplay {
+		return c.replay(ctx.Request, resp)
+	}
+
+	if err := ctx.client.doTimeout(ctx, resp); err != nil {
+		return err
+	}
+	return c.record(ctx.Request, resp)
+}
+
+// replay fills resp with the recorded response matching req. Unused interactions
+// are preferred, so identical requests replay their responses in order.
+func (c *Cassette) replay(req *Request, resp *Response) error {
+	r := c.newRequest(req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := -1
+	for i, interaction := range c.interactions {
+		if !c.matches(r, &interaction.Request) {
+			continue
+		}
+		found = i
+		if !c.replayed[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return fmt.Errorf("%w: %s %s", ErrCassetteMiss, r.Method, r.URL)
+	}
+	c.replayed[found] = true
+
+	recorded := c.interactions[found].Response
+	body, err := decodeText(recorded.Body, recorded.BodyEncoding)
+	if err != nil {
+		return err
+	}
+	resp.SetStatusCode(recorded.StatusCode)
+	for k, values := range recorded.Headers {
+		for _, v := range values {
+			resp.Header.Add(k, v)
+		}
+	}
+	resp.SetBody(body)
+	return nil
+}
+
+// record appends the interaction of req and resp and writes the cassette file.
+func (c *Cassette) record(req *Request, resp *Response) error {
+	interaction := &Interaction{
+		Request:  *c.newRequest(req),
+		Response: CassetteResponse{StatusCode: resp.StatusCode(), Headers: CassetteHeaders{}},
+	}
+	resp.Header.VisitAll(func(key, value []byte) {
+		k := string(key)
+		interaction.Response.Headers[k] = append(interaction.Response.Headers[k], c.redactHeader(k, string(value)))
+	})
+	body, err := resp.BodyUncompressed()
+	if err != nil {
+		return err
+	}
+	interaction.Response.Body, interaction.Response.BodyEncoding = encodeText(body)
+	interaction.Response.Headers.del(fasthttp.HeaderContentEncoding)
+	interaction.Response.Headers.del(fasthttp.HeaderContentLength)
+	if c.redact != nil {
+		c.redact(interaction)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+	return c.save()
+}
+
+// save writes all interactions to the cassette file, replacing it atomically.
+func (c *Cassette) save() error {
+	content, err := json.MarshalIndent(cassetteFile{Version: cassetteVersion, Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// matches reports whether r matches the recorded request.
+func (c *Cassette) matches(r, recorded *CassetteRequest) bool {
+	for _, m := range c.matchers {
+		if !m(r, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequest converts req to a redacted CassetteRequest.
+func (c *Cassette) newRequest(req *Request) *CassetteRequest {
+	r := &CassetteRequest{
+		Method:  string(req.Header.Method()),
+		URL:     c.redactURL(req.URI().String()),
+		Headers: CassetteHeaders{},
+	}
+	req.Header.VisitAll(func(key, value []byte) {
+		k := string(key)
+		r.Headers[k] = append(r.Headers[k], c.redactHeader(k, string(value)))
+	})
+	r.Body, r.BodyEncoding = encodeText(req.Body())
+	return r
+}
+
+// redactHeader returns the value to record for the given header.
+func (c *Cassette) redactHeader(key, value string) string {
+	for _, h := range c.redactHeaders {
+		if strings.EqualFold(h, key) {
+			return redactedValue
+		}
+	}
+	return value
+}
+
+// redactURL redacts the configured query parameters of rawURL.
+func (c *Cassette) redactURL(rawURL string) string {
+	if len(c.redactQuery) == 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for _, q := range c.redactQuery {
+		if _, ok := query[q]; ok {
+			query.Set(q, redactedValue)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
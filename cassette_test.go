@@ -0,0 +1,141 @@
+package fastreq
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_Cassette_Record_Replay(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			switch string(ctx.Path()) {
+			case "/binary":
+				ctx.SetBody([]byte{0xff, 0xfe, 0x00})
+			default:
+				ctx.Response.Header.Set("Set-Cookie", "session=secret")
+				ctx.SetBodyString("hello " + string(ctx.Request.Body()))
+			}
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	config := &CassetteConfig{
+		Matchers:    []CassetteMatcher{MatchMethod, MatchURL, MatchBody, MatchHeaders("Authorization")},
+		RedactQuery: []string{"api_key"},
+	}
+
+	cassette, err := NewCassette(path, config)
+	require.NoError(t, err)
+	require.Equal(t, CassetteRecord, cassette.Mode())
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	client.SetCassette(cassette)
+
+	resp, err := client.Post(
+		"http://make.fasthttp.great/greet?api_key=secret",
+		NewBody([]byte("world")),
+		NewHeaders("Authorization", "Bearer secret"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", resp.BodyString())
+	resp.Release()
+
+	resp, err = client.Get("http://make.fasthttp.great/binary")
+	require.NoError(t, err)
+	resp.Release()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "secret")
+	require.Contains(t, string(content), `"body_encoding": "base64"`)
+
+	// replaying works without any network access
+	cassette, err = NewCassette(path, config)
+	require.NoError(t, err)
+	require.Equal(t, CassetteReplay, cassette.Mode())
+
+	client = NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return nil, errors.New("network access during replay")
+	}
+	client.SetCassette(cassette)
+
+	resp, err = client.Post(
+		"http://make.fasthttp.great/greet?api_key=other",
+		NewBody([]byte("world")),
+		NewHeaders("Authorization", "Bearer other"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Equal(t, "hello world", resp.BodyString())
+	require.Equal(t, redactedValue, string(resp.Header.Peek("Set-Cookie")))
+	resp.Release()
+
+	resp, err = client.Get("http://make.fasthttp.great/binary")
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xff, 0xfe, 0x00}, resp.Body())
+	resp.Release()
+
+	_, err = client.Post("http://make.fasthttp.great/greet?api_key=other", NewBody([]byte("moon")))
+	require.ErrorIs(t, err, ErrCassetteMiss)
+}
+
+func Test_Cassette_Replay_Missing(t *testing.T) {
+	_, err := NewCassette(filepath.Join(t.TempDir(), "missing.json"), &CassetteConfig{Mode: CassetteReplay})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func Test_Cassette_DefaultRedactHeaders(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go func() {
+		_ = fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+			ctx.Response.Header.Set("Set-Cookie", "session=secret")
+		})
+	}()
+	record := func(config *CassetteConfig) string {
+		path := filepath.Join(t.TempDir(), "cassette.json")
+		cassette, err := NewCassette(path, config)
+		require.NoError(t, err)
+
+		client := NewClient()
+		client.Dial = func(addr string) (net.Conn, error) {
+			return ln.Dial()
+		}
+		client.SetCassette(cassette)
+		resp, err := client.Get("http://make.fasthttp.great/",
+			NewHeaders("Authorization", "Bearer secret", "X-Token", "token"))
+		require.NoError(t, err)
+		resp.Release()
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// the default headers are redacted with any config
+	content := record(&CassetteConfig{Mode: CassetteRecord, RedactHeaders: []string{"X-Token"}})
+	require.NotContains(t, content, "secret")
+	require.NotContains(t, content, `"token"`)
+
+	content = record(&CassetteConfig{Mode: CassetteRecord, NoDefaultRedactHeaders: true})
+	require.Contains(t, content, "Bearer secret")
+	require.Contains(t, content, "session=secret")
+}
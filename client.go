@@ -3,8 +3,11 @@ package fastreq
 import (
 	"crypto/tls"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	utls "github.com/refraction-networking/utls"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpproxy"
 )
@@ -37,8 +40,23 @@ type Client struct {
 	maxRedirectsCount int
 	timeout           time.Duration
 	debugLevel        DebugLevel
+	proxy             string
+	proxyRules        []ProxyRule
+	proxyPool         *ProxyPool
+	profile           *BrowserProfile
+	orderedHeaders    bool
 	auth              Oauth1
-	middlewares       []Middleware
+	middlewares       []namedMiddleware
+	middlewaresMu     sync.RWMutex
+	hooks             *Hooks
+	cassette          *Cassette
+	transports        map[transportKey]*fasthttp.Client
+	transportsMu      sync.Mutex
+	balancer          *LoadBalancer
+	pins              map[string][]string // SPKI pins by host
+	pinsMu            sync.RWMutex
+	retryIf           fasthttp.RetryIfFunc
+	inflight          sync.Map // *fasthttp.Request -> *Ctx, used to track retries
 }
 
 // NewClient creates a new instance of a Client.
@@ -76,81 +94,89 @@ func NewClient(config ...*ClientConfig) *Client {
 			ConnPoolStrategy:              0,
 			ConfigureClient:               nil,
 		},
-		middlewares:       []Middleware{},
+		middlewares:       []namedMiddleware{},
+		hooks:             NewHooks(),
 		timeout:           realConfig.Timeout,
 		debugLevel:        realConfig.DebugLevel,
 		maxRedirectsCount: realConfig.MaxRedirectsCount,
 		defaultUserAgent:  unsafeS2B(realConfig.DefaultUserAgent),
 	}
+	client.RetryIf = client.isRetryable
 
 	return client
 }
 
 // Get performs an HTTP GET request to the specified URL with optional request options.
 func (c *Client) Get(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(GET, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(GET, url), opts)
 }
 
 // Head sends a HEAD request to the specified URL and returns the response.
 func (c *Client) Head(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(HEAD, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(HEAD, url), opts)
 }
 
 // Post sends an HTTP POST request to the specified URL with the provided request options.
 func (c *Client) Post(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(POST, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(POST, url), opts)
 }
 
 // Put sends an HTTP PUT request to the specified URL with the provided request options.
 func (c *Client) Put(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(PUT, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(PUT, url), opts)
 }
 
 // Patch sends an HTTP PATCH request to the specified URL with the provided request options.
 func (c *Client) Patch(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(PATCH, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(PATCH, url), opts)
 }
 
 // Delete sends an HTTP DELETE request to the specified URL with the provided request options.
 func (c *Client) Delete(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(DELETE, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(DELETE, url), opts)
 }
 
 // Options sends an HTTP OPTIONS request to the specified URL with the provided request options.
 func (c *Client) Options(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(OPTIONS, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(OPTIONS, url), opts)
 }
 
 // Connect sends an HTTP CONNECT request to the specified URL with the provided request options.
 func (c *Client) Connect(url string, opts ...ReqOption) (*Response, error) {
-	req := NewRequest(CONNECT, url)
-	return c.Do(req, opts...)
+	return c.doOwned(NewRequest(CONNECT, url), opts)
 }
 
-// DownloadFile downloads a file from the specified URL.
-func (c *Client) DownloadFile(req *Request, path, filename string) error {
-	resp, err := c.Do(req)
+// DownloadFile downloads a file from the specified URL. If filename is empty,
+// the name sent in the Content-Disposition header of the response is used.
+// The caller keeps the ownership of req.
+func (c *Client) DownloadFile(req *Request, path, filename string, opts ...ReqOption) error {
+	resp, err := c.Do(req, opts...)
 	if err != nil {
 		return err
 	}
+	defer resp.Release()
 
-	if err := resp.SaveToFile(path, filename); err != nil {
-		return err
-	}
-
-	resp.Release()
+	return resp.SaveToFile(path, filename)
+}
 
-	return nil
+// doOwned executes a request created by the Client itself. The returned Response
+// takes over the ownership of the request, which is released right away on error.
+func (c *Client) doOwned(req *Request, opts []ReqOption) (*Response, error) {
+	resp, err := c.Do(req, opts...)
+	if err != nil {
+		req.Release()
+		return nil, err
+	}
+	resp.ownedRequest = req
+	return resp, nil
 }
 
-// Do execute an HTTP request with optional request options
+// Do execute an HTTP request with optional request options.
+//
+// The caller keeps the ownership of req and must release it once it is no longer
+// needed, Do never releases it. The returned Response is owned by the caller as
+// well and must be released exactly once. The Ctx used to run the middlewares is
+// owned by Do and returned to its pool before Do returns.
 func (c *Client) Do(req *Request, opts ...ReqOption) (*Response, error) {
 	// apply all request options
 	for _, o := range opts {
@@ -162,68 +188,171 @@ func (c *Client) Do(req *Request, opts ...ReqOption) (*Response, error) {
 		}
 	}
 
+	if p := c.profileOf(req); p != nil {
+		p.setDefaults(req)
+	}
+	if c.orderedHeaders || req.orderedHeaders {
+		// keep the casing of the headers set by middlewares
+		req.Header.DisableNormalizing()
+	}
+
 	// set default user agent if none is provided
 	if len(req.Header.UserAgent()) == 0 {
 		req.Header.SetUserAgentBytes(c.defaultUserAgent)
 	}
 
+	// complete the multipart body, so that middlewares sign the body as sent
+	if err := req.closeMultipart(); err != nil {
+		return nil, err
+	}
+
 	// create a context object with the request and client info
 	ctx := NewCtx()
 	ctx.Request = req
 	ctx.client = c
 
+	ctx.middlewares = c.buildMiddlewares(req, ctx.middlewares[:0])
+
 	// apply the first middleware function if there are any
-	if len(c.middlewares) > 0 {
-		if err := c.middlewares[0](ctx); err != nil {
-			return nil, err
-		}
+	var err error
+	if len(ctx.middlewares) > 0 {
+		err = ctx.middlewares[0](ctx)
 	} else {
 		// execute the request
-		if err := do(ctx); err != nil {
-			return nil, err
+		err = do(ctx)
+	}
+	if err != nil {
+		runErrorHooks(ctx, err)
+		if ctx.Response != nil {
+			ctx.Response.Release()
 		}
+		ctx.Release()
+		return nil, err
 	}
 
-	return ctx.Response, nil
+	resp := ctx.Response
+	ctx.copyValuesTo(resp)
+	ctx.Release()
+
+	return resp, nil
 }
 
 // do executes the request
 func do(ctx *Ctx) error {
-	if ctx.Request.mw != nil {
-		ctx.Request.Header.SetMultipartFormBoundary(ctx.Request.mw.Boundary())
-		if err := ctx.Request.mw.Close(); err != nil {
-			return err
-		}
+	if err := runRequestHooks(ctx); err != nil {
+		return err
 	}
 
 	start := time.Now()
 	debugBeforeRequest(ctx, start)
 
-	resp := fasthttp.AcquireResponse()
-	if err := ctx.client.DoTimeout(ctx.fastRequest(), resp, ctx.client.timeout); err != nil {
-		fasthttp.ReleaseResponse(resp)
+	resp := NewResponse()
+	if err := ctx.client.send(ctx, resp); err != nil {
+		resp.Release()
 		return err
 	}
-	ctx.Response = &Response{Response: resp, Request: ctx.Request.Request}
+	resp.Request = ctx.fastRequest()
+	ctx.Response = resp
 
 	debugAfterRequest(ctx, start)
 
-	return nil
+	// the after-response phase runs before the middlewares see the response
+	return runResponseHooks(ctx)
+}
+
+// send sends the request of ctx and fills resp. If a cassette is set, the request
+// is recorded to or replayed from it.
+func (c *Client) send(ctx *Ctx, resp *Response) error {
+	if c.cassette != nil {
+		return c.cassette.roundTrip(ctx, resp)
+	}
+	return c.doTimeout(ctx, resp)
+}
+
+// doTimeout sends the request of ctx over the network and fills resp.
+func (c *Client) doTimeout(ctx *Ctx, resp *Response) error {
+	// track the request so that its retries can be attributed to the Ctx
+	c.inflight.Store(ctx.fastRequest(), ctx)
+	defer c.inflight.Delete(ctx.fastRequest())
+
+	profile := c.profileOf(ctx.Request)
+	if order, ok := c.headerOrder(ctx.Request, profile); ok {
+		saved := orderHeaders(ctx.fastRequest(), order)
+		defer restoreHeaders(ctx.fastRequest(), saved)
+	}
+
+	if c.balancer != nil {
+		return c.balancer.do(c, ctx, resp)
+	}
+
+	proxy := c.pickProxy(ctx.Request, true)
+	if proxy.redacted != "" {
+		ctx.SetValue(ValueProxy, proxy.redacted)
+	}
+	key := transportKey{proxy: proxy.url, insecure: ctx.Request.insecureSkipVerify}
+	if profile != nil && profile.ClientHello != (utls.ClientHelloID{}) && string(ctx.Request.URI().Scheme()) == "https" {
+		key.profile = profile
+	}
+	t, err := c.transportFor(key)
+	if err != nil {
+		return err
+	}
+	err = t.DoTimeout(ctx.fastRequest(), resp.Response, c.timeout)
+	if proxy.entry != nil {
+		proxy.pool.report(proxy.entry, proxy.pool.config.IsFailure(resp.Response, err))
+	}
+	return err
+}
+
+// isRetryable is installed as the RetryIf function of the underlying fasthttp
+// client. It asks the user provided RetryIf function, or falls back to the
+// fasthttp default, and fires the retry hooks of the request being retried.
+func (c *Client) isRetryable(req *fasthttp.Request) bool {
+	var retry bool
+	if c.retryIf != nil {
+		retry = c.retryIf(req)
+	} else {
+		retry = req.Header.IsGet() || req.Header.IsHead() || req.Header.IsPut()
+	}
+	if !retry {
+		return false
+	}
+
+	if v, ok := c.inflight.Load(req); ok {
+		ctx := v.(*Ctx)
+		maxAttempts := c.MaxIdemponentCallAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = fasthttp.DefaultMaxIdemponentCallAttempts
+		}
+		// fasthttp gives up without retrying once all attempts are used
+		if ctx.retries+1 < maxAttempts {
+			ctx.retries++
+			ctx.SetValue(ValueRetries, ctx.retries)
+			runRetryHooks(ctx, ctx.retries)
+		}
+	}
+	return true
 }
 
 // SetHTTPProxy sets the HTTP proxy to use for requests
 func (c *Client) SetHTTPProxy(proxy string) {
 	c.Dial = fasthttpproxy.FasthttpHTTPDialer(proxy)
+	c.proxy = "http://" + strings.TrimPrefix(proxy, "http://")
+	c.resetTransports()
 }
 
 // SetSocks5Proxy sets the SOCKS5 proxy to use for requests
 func (c *Client) SetSocks5Proxy(proxy string) {
 	c.Dial = fasthttpproxy.FasthttpSocksDialer(proxy)
+	c.proxy = proxy
+	c.resetTransports()
 }
 
 // SetEnvHTTPProxy using the env(HTTP_PROXY, HTTPS_PROXY and NO_PROXY) configured HTTP proxy for the default client.
 func (c *Client) SetEnvHTTPProxy() {
 	c.Dial = fasthttpproxy.FasthttpProxyHTTPDialer()
+	c.proxy = ""
+	c.resetTransports()
 }
 
 // SetTimeout sets the request timeout
@@ -244,6 +373,7 @@ func (c *Client) SetDebugLevel(lvl DebugLevel) {
 // SetTLSConfig sets the TLS config
 func (c *Client) SetTLSConfig(config *tls.Config) {
 	c.TLSConfig = config
+	c.resetTransports()
 }
 
 // SetMaxRedirectsCount sets the max redirects count
@@ -252,8 +382,10 @@ func (c *Client) SetMaxRedirectsCount(count int) {
 }
 
 // SetRetryIf sets the RetryIf function for the HTTP client.
+// Use this instead of assigning Client.RetryIf directly, otherwise the retry
+// hooks are not called.
 func (c *Client) SetRetryIf(retryIf fasthttp.RetryIfFunc) {
-	c.RetryIf = retryIf
+	c.retryIf = retryIf
 }
 
 // SkipInsecureVerify sets whether the client should skip verification of the server's
@@ -271,18 +403,136 @@ func (c *Client) SkipInsecureVerify(isSkip bool) {
 		/* #nosec G402 */
 		c.TLSConfig.InsecureSkipVerify = isSkip
 	}
+	c.resetTransports()
 }
 
-// SetOauth1 sets the Oauth1 middleware
+// SetOauth1 sets the Oauth1 middleware, replacing the one set before.
 func (c *Client) SetOauth1(o *Oauth1) {
-	c.middlewares = append(c.middlewares, MiddlewareOauth1(o))
+	c.UseMiddleware(MiddlewareNameOauth1, MiddlewareOauth1(o))
+}
+
+// SetOauth2 sets the Oauth2 middleware, replacing the one set before.
+func (c *Client) SetOauth2(o *Oauth2) {
+	c.UseMiddleware(MiddlewareNameOauth2, MiddlewareOauth2(o))
+}
+
+// SetBearer sets the bearer token middleware, replacing the one set before.
+func (c *Client) SetBearer(token func() (string, error)) {
+	c.UseMiddleware(MiddlewareNameBearer, MiddlewareBearer(token))
+}
+
+// SetAPIKey sets the API key middleware, replacing the one set before.
+func (c *Client) SetAPIKey(in APIKeyIn, name, key string) {
+	c.UseMiddleware(MiddlewareNameAPIKey, MiddlewareAPIKey(in, name, key))
+}
+
+// SetDigestAuth sets the Digest authentication middleware, replacing the one set
+// before.
+func (c *Client) SetDigestAuth(username, password string) {
+	c.UseMiddleware(MiddlewareNameDigest, MiddlewareDigest(username, password))
+}
+
+// SetSigV4 sets the AWS Signature Version 4 middleware, replacing the one set
+// before.
+func (c *Client) SetSigV4(s *SigV4Signer) {
+	c.UseMiddleware(MiddlewareNameSigV4, MiddlewareSigV4(s))
+}
+
+// SetHTTPSignature sets the HTTP message signature middleware, replacing the one
+// set before.
+func (c *Client) SetHTTPSignature(s *HTTPSigner) {
+	c.UseMiddleware(MiddlewareNameHTTPSignature, MiddlewareHTTPSignature(s))
+}
+
+// SetHMACSignature sets the HMAC signature middleware, replacing the one set
+// before.
+func (c *Client) SetHMACSignature(s *HMACSigner) {
+	c.UseMiddleware(MiddlewareNameHMAC, MiddlewareHMAC(s))
+}
+
+// SetJWT sets the JWT middleware, replacing the one set before.
+func (c *Client) SetJWT(s *JWTSigner, attach JWTAttach) {
+	c.UseMiddleware(MiddlewareNameJWT, MiddlewareJWT(s, attach))
 }
 
 // AddMiddleware appends one or more Middleware functions to the Client's list of
 // middlewares. These middlewares are called in the order they are provided when
 // sending HTTP requests.
 func (c *Client) AddMiddleware(middlewares ...Middleware) {
-	c.middlewares = append(c.middlewares, middlewares...)
+	c.middlewaresMu.Lock()
+	defer c.middlewaresMu.Unlock()
+
+	list := make([]namedMiddleware, len(c.middlewares), len(c.middlewares)+len(middlewares))
+	copy(list, c.middlewares)
+	for _, m := range middlewares {
+		list = append(list, namedMiddleware{handler: m})
+	}
+	c.middlewares = list
+}
+
+// UseMiddleware adds a named middleware to the Client. If a middleware with the
+// same name already exists, it is replaced in place and keeps its position in the
+// chain, otherwise the middleware is appended.
+func (c *Client) UseMiddleware(name string, middleware Middleware) {
+	c.middlewaresMu.Lock()
+	defer c.middlewaresMu.Unlock()
+
+	list := make([]namedMiddleware, len(c.middlewares), len(c.middlewares)+1)
+	copy(list, c.middlewares)
+	for i := range list {
+		if name != "" && list[i].name == name {
+			list[i].handler = middleware
+			c.middlewares = list
+			return
+		}
+	}
+	c.middlewares = append(list, namedMiddleware{name: name, handler: middleware})
+}
+
+// RemoveMiddleware removes the middleware with the given name from the Client.
+// It reports whether such a middleware was found.
+func (c *Client) RemoveMiddleware(name string) bool {
+	c.middlewaresMu.Lock()
+	defer c.middlewaresMu.Unlock()
+
+	for i := range c.middlewares {
+		if name != "" && c.middlewares[i].name == name {
+			list := make([]namedMiddleware, 0, len(c.middlewares)-1)
+			list = append(list, c.middlewares[:i]...)
+			c.middlewares = append(list, c.middlewares[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// buildMiddlewares appends the middleware chain of the given request to dst:
+// the Client's middlewares which are not skipped by the request, followed by the
+// request's own middlewares.
+func (c *Client) buildMiddlewares(req *Request, dst []Middleware) []Middleware {
+	c.middlewaresMu.RLock()
+	list := c.middlewares
+	c.middlewaresMu.RUnlock()
+
+	for i := range list {
+		if req.isMiddlewareSkipped(list[i].name) {
+			continue
+		}
+		dst = append(dst, list[i].handler)
+	}
+	return append(dst, req.middlewares...)
+}
+
+// SetCassette records requests to or replays them from the given cassette.
+// Pass nil to send requests over the network again.
+func (c *Client) SetCassette(cassette *Cassette) {
+	c.cassette = cassette
+}
+
+// Hooks returns the hooks of the client, which are called for every request sent
+// by it. Hooks should be registered before the client is used.
+func (c *Client) Hooks() *Hooks {
+	return c.hooks
 }
 
 // debugBeforeRequest logs information about the incoming request when debugging is enabled.
@@ -309,6 +559,12 @@ func debugBeforeRequest(ctx *Ctx, start time.Time) {
 			ctx.Request.URI().FullURI(),
 			body,
 		)
+	case DebugCurl:
+		fmt.Printf(
+			"REQUEST[%s]: %s\n",
+			start.Format("2006-01-02 15:04:05"),
+			ctx.client.ToCurl(ctx.Request),
+		)
 	}
 }
 
@@ -317,7 +573,7 @@ func debugAfterRequest(ctx *Ctx, start time.Time) {
 	switch ctx.client.debugLevel {
 	case DebugClose:
 		return
-	case DebugSimple:
+	case DebugSimple, DebugCurl:
 		end := time.Now()
 		fmt.Printf(
 			"RESPONSE[%s]: %d %dms %s %s\n",
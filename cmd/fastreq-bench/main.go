@@ -0,0 +1,168 @@
+// Command fastreq-bench is a load-testing tool built on fastreq.
+//
+// Usage:
+//
+//	fastreq-bench [flags] URL
+//	fastreq-bench [flags] -f requests.txt
+//
+// It either sends as many requests as possible with a fixed concurrency, or
+// starts requests at a constant rate with -rate. The test stops after -n requests
+// or the -d duration, 200 requests by default. Request templates are loaded from
+// a HAR file or a file with curl commands. The report contains the latency
+// percentiles, the status codes, the errors and the throughput, or the same as
+// JSON with -json, e.g. to compare runs in CI.
+//
+// Examples:
+//
+//	fastreq-bench -c 50 -d 30s http://localhost:8080/
+//	fastreq-bench -rate 1000 -d 1m -json -f requests.txt > result.json
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/wnanbei/fastreq"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr, fastreq.NewClient())
+	stop()
+	os.Exit(code)
+}
+
+// headers collects the values of the repeatable -H flag.
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headers) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("invalid header %q, expected Name: value", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// options are the flags of the command.
+type options struct {
+	concurrency int
+	rate        float64
+	duration    time.Duration
+	count       int
+	method      string
+	headers     headers
+	body        string
+	file        string
+	timeout     time.Duration
+	insecure    bool
+	json        bool
+}
+
+// run runs the command with the given arguments and returns the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, client *fastreq.Client) int {
+	var opts options
+	fs := flag.NewFlagSet("fastreq-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.IntVar(&opts.concurrency, "c", 50, "number of requests sent at the same time")
+	fs.Float64Var(&opts.rate, "rate", 0, "requests per second, as fast as possible if 0")
+	fs.DurationVar(&opts.duration, "d", 0, "duration of the test, e.g. 30s")
+	fs.IntVar(&opts.count, "n", 0, "number of requests, 200 if neither -n nor -d is given")
+	fs.StringVar(&opts.method, "m", "GET", "HTTP method")
+	fs.Var(&opts.headers, "H", "request header, e.g. -H 'Accept: application/json', can be repeated")
+	fs.StringVar(&opts.body, "body", "", "request body")
+	fs.StringVar(&opts.file, "f", "", "file with request templates, a HAR file or curl commands")
+	fs.DurationVar(&opts.timeout, "timeout", 0, "timeout of each request, e.g. 5s")
+	fs.BoolVar(&opts.insecure, "k", false, "skip the verification of the server's TLS certificate")
+	fs.BoolVar(&opts.json, "json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fastreq-bench [flags] URL | -f FILE")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := opts.run(ctx, fs.Args(), stdout, client); err != nil {
+		fmt.Fprintln(stderr, "fastreq-bench:", err)
+		return 1
+	}
+	return 0
+}
+
+// run runs the load test and prints the result.
+func (opts *options) run(ctx context.Context, args []string, stdout io.Writer, client *fastreq.Client) error {
+	reqs, err := opts.requests(args)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, req := range reqs {
+			req.Release()
+		}
+	}()
+
+	if opts.timeout > 0 {
+		client.SetTimeout(opts.timeout)
+	}
+	if opts.insecure {
+		client.SkipInsecureVerify(true)
+	}
+
+	config := fastreq.BenchConfig{
+		Requests:    reqs,
+		Concurrency: opts.concurrency,
+		Rate:        opts.rate,
+		Duration:    opts.duration,
+		Count:       opts.count,
+	}
+	if config.Duration <= 0 && config.Count <= 0 {
+		config.Count = 200
+	}
+
+	result, err := client.Bench(ctx, config)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return result.WriteJSON(stdout)
+	}
+	_, err = io.WriteString(stdout, result.String())
+	return err
+}
+
+// requests returns the request templates of the file or the URL and flags.
+func (opts *options) requests(args []string) ([]*fastreq.Request, error) {
+	if opts.file != "" {
+		if len(args) > 0 {
+			return nil, errors.New("either -f or a URL can be given")
+		}
+		return fastreq.LoadBenchRequests(opts.file)
+	}
+	if len(args) != 1 {
+		return nil, errors.New("exactly one URL is needed")
+	}
+
+	req := fastreq.NewRequest(fastreq.HTTPMethod(strings.ToUpper(opts.method)), args[0])
+	for _, h := range opts.headers {
+		k, v, _ := strings.Cut(h, ":")
+		req.SetHeader(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	if opts.body != "" {
+		req.SetBodyString(opts.body)
+	}
+	return []*fastreq.Request{req}, nil
+}
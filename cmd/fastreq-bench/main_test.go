@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"github.com/wnanbei/fastreq"
+)
+
+func newClient(t *testing.T, handler fasthttp.RequestHandler) *fastreq.Client {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{Handler: handler}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	client := fastreq.NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	return client
+}
+
+func Test_Run_URL(t *testing.T) {
+	var posts atomic.Int64
+	client := newClient(t, func(ctx *fasthttp.RequestCtx) {
+		if ctx.IsPost() && string(ctx.Request.Header.Peek("X-Token")) == "secret" && string(ctx.PostBody()) == "hello" {
+			posts.Add(1)
+		}
+	})
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-c", "4", "-n", "20", "-m", "post", "-H", "X-Token: secret",
+		"-body", "hello", "-json", "http://make.fasthttp.great/"}, &stdout, &stderr, client)
+	require.Equal(t, 0, code, stderr.String())
+	require.Equal(t, int64(20), posts.Load())
+
+	var result fastreq.BenchResult
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	require.Equal(t, int64(20), result.Requests)
+	require.Equal(t, map[int]int64{200: 20}, result.StatusCodes)
+}
+
+func Test_Run_File(t *testing.T) {
+	var calls atomic.Int64
+	client := newClient(t, func(ctx *fasthttp.RequestCtx) {
+		calls.Add(1)
+	})
+
+	path := filepath.Join(t.TempDir(), "requests.txt")
+	require.NoError(t, os.WriteFile(path, []byte("curl http://make.fasthttp.great/a\ncurl http://make.fasthttp.great/b -d x=1\n"), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"-f", path}, &stdout, &stderr, client)
+	require.Equal(t, 0, code, stderr.String())
+	require.Equal(t, int64(200), calls.Load())
+	require.Contains(t, stdout.String(), "Requests:\t200\n")
+	require.Contains(t, stdout.String(), "p99.9:")
+
+	require.Equal(t, 1, run(context.Background(), []string{"-f", path, "http://x"}, &stdout, &stderr, client))
+	require.Equal(t, 1, run(context.Background(), nil, &stdout, &stderr, client))
+	require.Equal(t, 2, run(context.Background(), []string{"-H", "invalid"}, &stdout, &stderr, client))
+}
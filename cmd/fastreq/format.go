@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tidwall/pretty"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"golang.org/x/net/html"
+)
+
+// ANSI colors of the output.
+const (
+	colorReset  = "\x1b[0m"
+	colorKey    = "\x1b[36m"
+	colorTag    = "\x1b[34m"
+	colorAttr   = "\x1b[32m"
+	colorValue  = "\x1b[33m"
+	colorStatus = "\x1b[1m"
+)
+
+// printer writes responses in a human readable way.
+type printer struct {
+	w       io.Writer
+	headers bool
+	body    bool
+	format  bool
+	color   bool
+}
+
+// colorize wraps s in the color if colors are enabled.
+func (p *printer) colorize(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// printResponse prints the status line and headers and the body of the response.
+func (p *printer) printResponse(resp *fastreq.Response) {
+	if p.headers {
+		code := resp.StatusCode()
+		fmt.Fprintln(p.w, p.colorize(colorStatus, fmt.Sprintf("%s %d %s", resp.Header.Protocol(), code, fasthttp.StatusMessage(code))))
+		resp.Header.VisitAll(func(key, value []byte) {
+			fmt.Fprintf(p.w, "%s: %s\n", p.colorize(colorKey, string(key)), value)
+		})
+		if p.body {
+			fmt.Fprintln(p.w)
+		}
+	}
+	if p.body {
+		p.printBody(resp.Body(), string(resp.Header.ContentType()))
+	}
+}
+
+// printBody prints a body, which is formatted and colorized according to its
+// content type.
+func (p *printer) printBody(body []byte, contentType string) {
+	if len(body) == 0 {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		if p.format {
+			body = pretty.Pretty(body)
+		}
+		if p.color {
+			body = pretty.Color(body, nil)
+		}
+	case mediaType == fastreq.MIMETextHTML && (p.format || p.color):
+		body = p.formatHTML(body)
+	case !utf8.Valid(body) && p.format:
+		fmt.Fprintf(p.w, "+-----------------------------------------+\n"+
+			"| NOTE: binary data not shown in terminal |\n"+
+			"+-----------------------------------------+\n")
+		return
+	}
+
+	p.w.Write(body) //nolint:errcheck
+	if !bytes.HasSuffix(body, []byte("\n")) {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// formatHTML indents and colorizes an HTML document. The content of elements
+// whose whitespace matters, like pre or script, is kept as it is.
+func (p *printer) formatHTML(body []byte) []byte {
+	var (
+		b     bytes.Buffer
+		depth int
+		raw   string // the element whose content is printed as it is
+	)
+	indent := func() {
+		if p.format {
+			b.WriteString(strings.Repeat("  ", depth))
+		}
+	}
+	newline := func() {
+		if p.format {
+			b.WriteByte('\n')
+		}
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Raw()
+		if raw != "" && tt != html.EndTagToken {
+			b.Write(token)
+			continue
+		}
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			indent()
+			p.writeTag(&b, z, token, name, hasAttr, tt == html.SelfClosingTagToken)
+			switch {
+			case tt == html.SelfClosingTagToken || voidElements[string(name)]:
+			case rawElements[string(name)]:
+				raw = string(name)
+				continue
+			default:
+				depth++
+			}
+			newline()
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if raw != "" {
+				if string(name) != raw {
+					b.Write(token)
+					continue
+				}
+				raw = ""
+			} else {
+				if depth > 0 {
+					depth--
+				}
+				indent()
+			}
+			b.WriteString(p.colorize(colorTag, string(token)))
+			newline()
+		case html.TextToken:
+			text := token
+			if p.format {
+				text = bytes.TrimSpace(text)
+				if len(text) == 0 {
+					continue
+				}
+				indent()
+			}
+			b.Write(text)
+			newline()
+		default:
+			indent()
+			b.Write(token)
+			newline()
+		}
+	}
+	return b.Bytes()
+}
+
+// writeTag writes the current start tag of the tokenizer with colorized attributes.
+func (p *printer) writeTag(b *bytes.Buffer, z *html.Tokenizer, token, name []byte, hasAttr, selfClosing bool) {
+	if !p.color {
+		b.Write(token)
+		return
+	}
+
+	b.WriteString(colorTag + "<" + string(name) + colorReset)
+	for hasAttr {
+		var key, value []byte
+		key, value, hasAttr = z.TagAttr()
+		b.WriteString(" " + colorAttr + string(key) + colorReset)
+		b.WriteString("=" + colorValue + `"` + html.EscapeString(string(value)) + `"` + colorReset)
+	}
+	if selfClosing {
+		b.WriteString(colorTag + "/>" + colorReset)
+	} else {
+		b.WriteString(colorTag + ">" + colorReset)
+	}
+}
+
+// voidElements are the HTML elements without end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawElements are the HTML elements whose content is printed as it is.
+var rawElements = map[string]bool{
+	"pre": true, "script": true, "style": true, "textarea": true,
+}
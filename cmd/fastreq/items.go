@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+)
+
+// Separators of request items, longest first, so that e.g. "==" wins over "=".
+const (
+	sepJSONFile  = ":=@"
+	sepDataFile  = "=@"
+	sepJSON      = ":="
+	sepQuery     = "=="
+	sepData      = "="
+	sepHeader    = ":"
+	sepFile      = "@"
+	sepEmptyHead = ";"
+)
+
+var separators = []string{sepJSONFile, sepDataFile, sepJSON, sepQuery, sepData, sepHeader, sepFile, sepEmptyHead}
+
+// item is a request item of the command line, like name=value or Header:value.
+type item struct {
+	key   string
+	sep   string
+	value string
+}
+
+// parseItem splits a request item at its first separator. Separator characters
+// in the key can be escaped with a backslash, e.g. foo\=bar=baz.
+func parseItem(arg string) (item, error) {
+	var key strings.Builder
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '\\' && i+1 < len(arg) {
+			i++
+			key.WriteByte(arg[i])
+			continue
+		}
+		for _, sep := range separators {
+			if strings.HasPrefix(arg[i:], sep) {
+				if sep == sepEmptyHead && i+1 != len(arg) {
+					// only "Header;" is an empty header, ";" may appear in keys
+					continue
+				}
+				return item{key: key.String(), sep: sep, value: arg[i+len(sep):]}, nil
+			}
+		}
+		key.WriteByte(arg[i])
+	}
+	return item{}, fmt.Errorf("invalid request item %q", arg)
+}
+
+// requestData collects the request items which form the request.
+type requestData struct {
+	headers [][2]string
+	query   [][2]string
+	fields  [][2]string
+	json    map[string]any
+	rawJSON bool
+	files   [][2]string
+}
+
+// hasBody reports whether the request items contain data for the request body.
+func (d *requestData) hasBody() bool {
+	return len(d.fields) > 0 || len(d.json) > 0 || len(d.files) > 0
+}
+
+// add adds a request item.
+func (d *requestData) add(it item) error {
+	switch it.sep {
+	case sepHeader:
+		d.headers = append(d.headers, [2]string{it.key, it.value})
+	case sepEmptyHead:
+		d.headers = append(d.headers, [2]string{it.key, ""})
+	case sepQuery:
+		d.query = append(d.query, [2]string{it.key, it.value})
+	case sepData:
+		d.fields = append(d.fields, [2]string{it.key, it.value})
+		d.setJSON(it.key, it.value)
+	case sepDataFile:
+		b, err := os.ReadFile(it.value)
+		if err != nil {
+			return err
+		}
+		d.fields = append(d.fields, [2]string{it.key, string(b)})
+		d.setJSON(it.key, string(b))
+	case sepJSON, sepJSONFile:
+		raw := []byte(it.value)
+		if it.sep == sepJSONFile {
+			var err error
+			if raw, err = os.ReadFile(it.value); err != nil {
+				return err
+			}
+		}
+		if !json.Valid(raw) {
+			return fmt.Errorf("invalid JSON in request item %s%s%s", it.key, it.sep, it.value)
+		}
+		d.setJSON(it.key, json.RawMessage(raw))
+		d.rawJSON = true
+	case sepFile:
+		d.files = append(d.files, [2]string{it.key, it.value})
+	}
+	return nil
+}
+
+// setJSON sets a field of the JSON body.
+func (d *requestData) setJSON(key string, value any) {
+	if d.json == nil {
+		d.json = make(map[string]any)
+	}
+	d.json[key] = value
+}
+
+// apply sets the collected items on the request. Data fields are sent as JSON
+// object, as form with form set or as multipart form if files are uploaded.
+func (d *requestData) apply(req *fastreq.Request, form bool) error {
+	if len(d.query) > 0 {
+		args := req.URI().QueryArgs()
+		for _, q := range d.query {
+			args.Add(q[0], q[1])
+		}
+	}
+
+	switch {
+	case d.rawJSON && (form || len(d.files) > 0):
+		return errors.New("raw JSON fields can only be sent as JSON")
+	case len(d.files) > 0:
+		for _, f := range d.fields {
+			if err := req.AddMFField(f[0], f[1]); err != nil {
+				return err
+			}
+		}
+		for _, f := range d.files {
+			if err := req.AddMFFile(f[0], f[1]); err != nil {
+				return err
+			}
+		}
+	case form && len(d.fields) > 0:
+		f := fastreq.NewPostForm()
+		for _, kv := range d.fields {
+			f.Add(kv[0], kv[1])
+		}
+		req.SetPostForm(f)
+		f.Release()
+	case len(d.json) > 0:
+		if err := req.SetJSON(d.json); err != nil {
+			return err
+		}
+		req.SetHeader(fasthttp.HeaderAccept, "application/json, */*;q=0.5")
+	}
+
+	// headers are set last, so that they can override e.g. the Content-Type
+	for _, h := range d.headers {
+		req.SetHeader(h[0], h[1])
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"github.com/wnanbei/fastreq/fastreqtest"
+)
+
+func Test_Run_JSON(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/api").
+		WithQuery("page", "2").
+		WithHeader("X-Token", "secret").
+		WithJSONBody(map[string]any{"name": "fastreq", "count": 1, "tags": []any{"a"}}).
+		Once().
+		Reply(fasthttp.StatusCreated).
+		JSON(map[string]any{"id": 1})
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-pretty", "format", srv.URL() + "/api", "page==2", "X-Token:secret",
+		"name=fastreq", "count:=1", `tags:=["a"]`}, &stdout, &stderr, srv.Client())
+	require.Equal(t, 0, code, stderr.String())
+	require.Contains(t, stdout.String(), "HTTP/1.1 201 Created\n")
+	require.Contains(t, stdout.String(), "Content-Type: application/json\n")
+	require.Contains(t, stdout.String(), "\n{\n  \"id\": 1\n}\n")
+}
+
+func Test_Run_Form_Multipart(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.PUT, "/form").WithFormValue("user", "me").Once().Body("ok")
+	srv.On(fastreq.POST, "/upload").Once().Handle(func(ctx *fasthttp.RequestCtx) {
+		mf, err := ctx.MultipartForm()
+		require.NoError(t, err)
+		require.Equal(t, []string{"bar"}, mf.Value["foo"])
+		require.Equal(t, "file.txt", mf.File["txt"][0].Filename)
+	})
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-form", "-body", "PUT", srv.URL() + "/form", "user=me"}, &stdout, &stderr, srv.Client())
+	require.Equal(t, 0, code, stderr.String())
+	require.Equal(t, "ok\n", stdout.String())
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("fastreq"), 0o600))
+	code = run([]string{srv.URL() + "/upload", "foo=bar", "txt@" + path}, &stdout, &stderr, srv.Client())
+	require.Equal(t, 0, code, stderr.String())
+}
+
+func Test_Run_Download(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.GET, "/files/archive.zip").Once().Body("zip")
+	srv.On(fastreq.GET, "/").Once().Header("Content-Disposition", `attachment; filename="named.txt"`).Body("named")
+
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-download", "-o", dir + "/", srv.URL() + "/files/archive.zip"}, &stdout, &stderr, srv.Client())
+	require.Equal(t, 0, code, stderr.String())
+	b, err := os.ReadFile(filepath.Join(dir, "archive.zip"))
+	require.NoError(t, err)
+	require.Equal(t, "zip", string(b))
+
+	code = run([]string{"-download", "-o", dir + "/", srv.URL() + "/"}, &stdout, &stderr, srv.Client())
+	require.Equal(t, 0, code, stderr.String())
+	b, err = os.ReadFile(filepath.Join(dir, "named.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "named", string(b))
+}
+
+func Test_Run_DownloadTraversal(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.GET, "/").Once().Header("Content-Disposition", `attachment; filename="..%2F..%2F.bashrc"`).Body("evil")
+
+	dir := filepath.Join(t.TempDir(), "a", "b")
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"-download", "-o", dir + "/", srv.URL() + "/"}, &stdout, &stderr, srv.Client())
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr.String(), "invalid file name")
+	_, err := os.Stat(filepath.Join(dir, "..", "..", ".bashrc"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func Test_Run_Errors(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.GET, "/missing").Once().Reply(fasthttp.StatusNotFound)
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 4, run([]string{"-check-status", srv.URL() + "/missing"}, &stdout, &stderr, srv.Client()))
+	require.Equal(t, 1, run([]string{"-form", srv.URL(), "count:=1"}, &stdout, &stderr, srv.Client()))
+	require.Contains(t, stderr.String(), "raw JSON fields can only be sent as JSON")
+	require.Equal(t, 1, run([]string{"-oauth1", "a:b", srv.URL()}, &stdout, &stderr, srv.Client()))
+	require.Equal(t, 1, run([]string{srv.URL(), "noseparator"}, &stdout, &stderr, srv.Client()))
+	require.Equal(t, 2, run([]string{"-unknown"}, &stdout, &stderr, srv.Client()))
+}
+
+func Test_ParseItem(t *testing.T) {
+	for arg, expected := range map[string]item{
+		"name=value":         {key: "name", sep: sepData, value: "value"},
+		"q==a=b":             {key: "q", sep: sepQuery, value: "a=b"},
+		"X-Token:a:b":        {key: "X-Token", sep: sepHeader, value: "a:b"},
+		"X-Empty;":           {key: "X-Empty", sep: sepEmptyHead, value: ""},
+		"count:=1":           {key: "count", sep: sepJSON, value: "1"},
+		"body:=@data.json":   {key: "body", sep: sepJSONFile, value: "data.json"},
+		"text=@file.txt":     {key: "text", sep: sepDataFile, value: "file.txt"},
+		"file@path/to/a.txt": {key: "file", sep: sepFile, value: "path/to/a.txt"},
+		`a\=b=c`:             {key: "a=b", sep: sepData, value: "c"},
+	} {
+		it, err := parseItem(arg)
+		require.NoError(t, err, arg)
+		require.Equal(t, expected, it, arg)
+	}
+}
+
+func Test_NormalizeURL(t *testing.T) {
+	require.Equal(t, "http://localhost:8080/path", normalizeURL(":8080/path"))
+	require.Equal(t, "http://example.com/a?b=c", normalizeURL("example.com/a?b=c"))
+	require.Equal(t, "https://example.com", normalizeURL("https://example.com"))
+}
+
+func Test_Printer_HTML(t *testing.T) {
+	var b bytes.Buffer
+	p := &printer{w: &b, body: true, format: true}
+	p.printBody([]byte(`<html><body><p class="x">Hi<br>there</p><pre>  keep
+  this</pre></body></html>`), fastreq.MIMETextHTMLCharsetUTF8)
+	require.Equal(t, "<html>\n  <body>\n    <p class=\"x\">\n      Hi\n      <br>\n      there\n    </p>\n"+
+		"    <pre>  keep\n  this</pre>\n  </body>\n</html>\n", b.String())
+
+	b.Reset()
+	p = &printer{w: &b, body: true, color: true}
+	p.printBody([]byte(`<a href="/">x</a>`), fastreq.MIMETextHTML)
+	require.Equal(t, colorTag+"<a"+colorReset+" "+colorAttr+"href"+colorReset+"="+colorValue+`"/"`+colorReset+
+		colorTag+">"+colorReset+"x"+colorTag+"</a>"+colorReset+"\n", b.String())
+
+	b.Reset()
+	p = &printer{w: &b, body: true, format: true}
+	p.printBody([]byte{0xff, 0xfe}, fastreq.MIMEOctetStream)
+	require.Contains(t, b.String(), "binary data not shown")
+}
@@ -0,0 +1,159 @@
+package fastreq
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrCoalescedPanic is returned to the requests coalesced with a request which
+// panicked.
+var ErrCoalescedPanic = errors.New("fastreq: the coalesced request panicked")
+
+// CoalesceConfig configures MiddlewareCoalesce.
+type CoalesceConfig struct {
+	// Methods are the methods of the requests which are coalesced, GET and HEAD
+	// by default. The request body is not part of the default key, so requests
+	// with other methods usually need a custom Key.
+	Methods []HTTPMethod
+	// Headers are the request headers which are part of the default key, besides
+	// method and URL, e.g. Authorization for responses which depend on the user.
+	Headers []string
+	// Key returns the key of a request instead of the default key. Requests with
+	// the same key are coalesced, requests with an empty key are sent as usual.
+	Key func(req *Request) string
+}
+
+// coalesceCall is a request in flight, which duplicate requests wait for.
+type coalesceCall struct {
+	done  chan struct{}
+	dups  int
+	resps []*Response
+	err   error
+}
+
+// coalesceGroup holds the requests in flight of a MiddlewareCoalesce.
+type coalesceGroup struct {
+	config CoalesceConfig
+	mu     sync.Mutex
+	calls  map[string]*coalesceCall
+}
+
+// MiddlewareCoalesce returns a middleware which coalesces identical requests in
+// flight: while a request is sent, identical requests wait for it instead of
+// being sent as well. Each of them gets its own copy of the response, made with
+// Response.Copy, which is released by its caller as usual. Coalesced responses
+// have the value ValueCoalesced set to true.
+//
+// Middlewares after it, the request hooks, the response hooks of the Client and
+// the debug output only run for the request which is actually sent, and the
+// copies are made of its response once they did. The response hooks of a
+// coalesced request itself then run on its copy, and so do middlewares before
+// MiddlewareCoalesce, which is therefore usually added last.
+func MiddlewareCoalesce(config ...*CoalesceConfig) Middleware {
+	g := &coalesceGroup{calls: make(map[string]*coalesceCall)}
+	if len(config) > 0 && config[0] != nil {
+		g.config = *config[0]
+	}
+	if len(g.config.Methods) == 0 {
+		g.config.Methods = []HTTPMethod{GET, HEAD}
+	}
+
+	return func(ctx *Ctx) error {
+		key := g.key(ctx.Request)
+		if key == "" {
+			return ctx.Next()
+		}
+
+		g.mu.Lock()
+		if call, ok := g.calls[key]; ok {
+			i := call.dups
+			call.dups++
+			g.mu.Unlock()
+
+			<-call.done
+			if call.err != nil {
+				return call.err
+			}
+			ctx.Response = call.resps[i]
+			ctx.Response.Request = ctx.fastRequest()
+			ctx.SetValue(ValueCoalesced, true)
+			if ctx.Request.hooks != nil {
+				for _, hook := range ctx.Request.hooks.onResponse {
+					if err := hook(ctx); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+		call := &coalesceCall{done: make(chan struct{})}
+		g.calls[key] = call
+		g.mu.Unlock()
+
+		var err error
+		panicked := true
+		defer func() {
+			// no duplicates can join once the call is removed, so every
+			// duplicate gets a copy of the response before it is returned to
+			// the caller
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+
+			call.err = err
+			if panicked {
+				call.err = ErrCoalescedPanic
+			} else if err == nil && call.dups > 0 {
+				call.resps = make([]*Response, call.dups)
+				for i := range call.resps {
+					call.resps[i] = ctx.Response.Copy()
+				}
+			}
+			close(call.done)
+		}()
+
+		err = ctx.Next()
+		panicked = false
+		return err
+	}
+}
+
+// key returns the key of a request, or an empty key if the request must not be
+// coalesced.
+func (g *coalesceGroup) key(req *Request) string {
+	method := string(req.Header.Method())
+	coalesced := false
+	for _, m := range g.config.Methods {
+		if string(m) == method {
+			coalesced = true
+			break
+		}
+	}
+	if !coalesced {
+		return ""
+	}
+
+	if g.config.Key != nil {
+		return g.config.Key(req)
+	}
+
+	var b strings.Builder
+	b.WriteString(method)
+	b.WriteByte(' ')
+	b.Write(req.URI().FullURI())
+	if uri := req.URI(); len(uri.Username()) > 0 {
+		// the basic auth of the URI is not part of FullURI
+		b.WriteByte('\n')
+		b.Write(uri.Username())
+		b.WriteByte(':')
+		b.Write(uri.Password())
+	}
+	for _, h := range g.config.Headers {
+		b.WriteByte('\n')
+		b.WriteString(h)
+		b.WriteByte(':')
+		b.Write(req.Header.Peek(h))
+	}
+	return b.String()
+}
@@ -0,0 +1,231 @@
+package fastreq
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_MiddlewareCoalesce(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			calls.Add(1)
+			if string(ctx.Path()) == "/slow" {
+				<-release
+			}
+			ctx.SetBodyString(string(ctx.Path()) + " " + string(ctx.Request.Header.Peek("Authorization")))
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	client.UseMiddleware("coalesce", MiddlewareCoalesce(&CoalesceConfig{Headers: []string{"Authorization"}}))
+
+	const n = 10
+	var wg sync.WaitGroup
+	responses := make([]*Response, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			auth := "a"
+			if i%2 == 1 {
+				auth = "b"
+			}
+			resp, err := client.Get("http://make.fasthttp.great/slow", NewHeaders("Authorization", auth))
+			require.NoError(t, err)
+			responses[i] = resp
+		}(i)
+	}
+
+	// wait until all requests are in flight or waiting
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int64(2), calls.Load())
+	coalesced := 0
+	for i, resp := range responses {
+		if i%2 == 0 {
+			require.Equal(t, "/slow a", string(resp.Body()))
+		} else {
+			require.Equal(t, "/slow b", string(resp.Body()))
+		}
+		if v, _ := ValueOf[bool](resp, ValueCoalesced); v {
+			coalesced++
+		}
+	}
+	require.Equal(t, n-2, coalesced)
+
+	// every response is an independent copy
+	require.NotSame(t, responses[0].Response, responses[2].Response)
+	responses[0].SetBodyString("changed")
+	require.Equal(t, "/slow a", string(responses[2].Body()))
+	for _, resp := range responses {
+		resp.Release()
+	}
+
+	// other methods are not coalesced
+	resp, err := client.Post("http://make.fasthttp.great/post")
+	require.NoError(t, err)
+	resp.Release()
+	require.Equal(t, int64(3), calls.Load())
+}
+
+func Test_MiddlewareCoalesce_Error(t *testing.T) {
+	block := make(chan struct{})
+	var dials atomic.Int64
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		dials.Add(1)
+		<-block
+		return nil, fasthttp.ErrDialTimeout
+	}
+	client.UseMiddleware("coalesce", MiddlewareCoalesce(&CoalesceConfig{
+		Key: func(req *Request) string { return string(req.URI().Path()) },
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Get("http://make.fasthttp.great/same?i=x")
+			require.ErrorIs(t, err, fasthttp.ErrDialTimeout)
+		}()
+	}
+	require.Eventually(t, func() bool { return dials.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	require.Equal(t, int64(1), dials.Load())
+}
+
+func Test_MiddlewareCoalesce_Panic(t *testing.T) {
+	block := make(chan struct{})
+	var keys atomic.Int64
+	client := NewClient()
+	client.UseMiddleware("coalesce", MiddlewareCoalesce(&CoalesceConfig{
+		Key: func(req *Request) string {
+			keys.Add(1)
+			return "same"
+		},
+	}))
+	client.UseMiddleware("panic", func(ctx *Ctx) error {
+		<-block
+		panic("boom")
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs <- errors.New("panicked")
+				}
+			}()
+			_, err := client.Get("http://make.fasthttp.great/")
+			errs <- err
+		}()
+	}
+	require.Eventually(t, func() bool { return keys.Load() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	close(errs)
+
+	// the duplicates don't hang, and the key is free again
+	var got []string
+	for err := range errs {
+		got = append(got, err.Error())
+	}
+	require.ElementsMatch(t, []string{"panicked", ErrCoalescedPanic.Error(), ErrCoalescedPanic.Error()}, got)
+	require.Panics(t, func() { _, _ = client.Get("http://make.fasthttp.great/") })
+}
+
+func Test_MiddlewareCoalesce_Hooks(t *testing.T) {
+	var calls atomic.Int64
+	release := make(chan struct{})
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go func() {
+		_ = fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+			calls.Add(1)
+			<-release
+			ctx.SetBodyString("shared")
+		})
+	}()
+
+	var clientHooks atomic.Int64
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	client.Hooks().OnResponse(func(ctx *Ctx) error {
+		clientHooks.Add(1)
+		return nil
+	})
+	client.UseMiddleware("coalesce", MiddlewareCoalesce())
+
+	const n = 3
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hooks := NewHooks().OnResponse(func(ctx *Ctx) error {
+				if i == n-1 {
+					return errors.New("rejected")
+				}
+				ctx.Response.SetBodyString(string(ctx.Response.Body()) + " " + strconv.Itoa(i))
+				return nil
+			})
+			resp, err := client.Get("http://make.fasthttp.great/", hooks)
+			errs[i] = err
+			if err == nil {
+				bodies[i] = string(resp.Body())
+				resp.Release()
+			}
+		}(i)
+		if i == 0 {
+			// the first request is the one which is sent
+			require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// the hooks of each request run on its own copy, those of the client once
+	require.Equal(t, int64(1), calls.Load())
+	require.Equal(t, int64(1), clientHooks.Load())
+	require.Equal(t, []string{"shared 0", "shared 0 1", ""}, bodies)
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	require.EqualError(t, errs[2], "rejected")
+}
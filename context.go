@@ -14,6 +14,10 @@ type Ctx struct {
 	ctx             context.Context
 	client          *Client
 	indexMiddleware int
+	middlewares     []Middleware
+	retries         int
+	values          []keyValue
+	released        bool
 }
 
 // Next ..
@@ -21,24 +25,72 @@ func (c *Ctx) Next() (err error) {
 	// Increment handler index
 	c.indexMiddleware++
 	// Did we execute all route handlers?
-	if c.indexMiddleware < len(c.client.middlewares) {
+	if c.indexMiddleware < len(c.middlewares) {
 		// Continue route stack
-		return c.client.middlewares[c.indexMiddleware](c)
+		return c.middlewares[c.indexMiddleware](c)
 	} else {
 		// Continue handler stack
 		return do(c)
 	}
 }
 
+// Release returns the Ctx to its pool. The Request and Response it refers to are
+// not released, they are owned by the caller of Client.Do.
+//
+// The Ctx is released by Client.Do once all middlewares returned, so middlewares
+// must not retain references to it.
 func (c *Ctx) Release() {
-	c.Request.Release()
-	c.Response.Release()
+	if c.released {
+		trackDoubleRelease(c)
+		return
+	}
+	trackRelease(c)
+	c.released = true
+
+	c.Request = nil
+	c.Response = nil
 	c.client = nil
 	c.indexMiddleware = 0
+	c.middlewares = c.middlewares[:0]
+	c.retries = 0
+	c.values = resetValues(c.values)
 
 	ctxPool.Put(c)
 }
 
+// SetValue stores a request-scoped value under the given key, replacing the value
+// stored before. Values can be used by middlewares to pass data to each other,
+// they are copied onto the Response once the request succeeded.
+func (c *Ctx) SetValue(key string, value any) {
+	c.values = setValue(c.values, key, value)
+}
+
+// Value returns the value stored under the given key, or nil if there is none.
+func (c *Ctx) Value(key string) any {
+	return getValue(c.values, key)
+}
+
+// copyValuesTo copies all values of the Ctx onto the given Response.
+func (c *Ctx) copyValuesTo(resp *Response) {
+	for _, kv := range c.values {
+		resp.values = setValue(resp.values, kv.key, kv.value)
+	}
+}
+
+// fork returns a new Ctx which sends a copy of the request through the remaining
+// middlewares when its Next is called, independently of c. The caller owns the
+// fork and its request, and must release both.
+func (c *Ctx) fork() *Ctx {
+	f := NewCtx()
+	f.Request = c.Request.Copy()
+	f.Request.hooks = c.Request.hooks
+	f.client = c.client
+	f.indexMiddleware = c.indexMiddleware
+	f.middlewares = append(f.middlewares[:0], c.middlewares...)
+	f.values = append(f.values[:0], c.values...)
+	return f
+}
+
 func (c *Ctx) fastClient() *fasthttp.Client {
 	return c.client.Client
 }
@@ -53,10 +105,16 @@ func (c *Ctx) fastResponse() *fasthttp.Response {
 
 var ctxPool sync.Pool
 
+// NewCtx returns an empty Ctx from the pool.
 func NewCtx() *Ctx {
+	var c *Ctx
 	v := ctxPool.Get()
 	if v == nil {
-		return &Ctx{}
+		c = &Ctx{}
+	} else {
+		c = v.(*Ctx)
+		c.released = false
 	}
-	return v.(*Ctx)
+	trackAcquire(c)
+	return c
 }
@@ -0,0 +1,182 @@
+package fastreq
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/valyala/fasthttp"
+)
+
+// curlOptions are the Client settings reflected in a curl command.
+type curlOptions struct {
+	proxy    string
+	insecure bool
+}
+
+// ToCurl returns a shell-quoted curl command which sends the same request.
+// Use Client.ToCurl to include the settings of the Client as well.
+func (r *Request) ToCurl() string {
+	return r.curl(curlOptions{})
+}
+
+// ToCurl returns a shell-quoted curl command which sends the given request with
+// the proxy and TLS settings of the Client and the request. The proxy is the
+// one the request would be sent through next, see SetProxyRules, or for pools
+// with ProxyRandom any one of them. The password of the proxy is redacted.
+func (c *Client) ToCurl(req *Request) string {
+	opts := curlOptions{proxy: c.pickProxy(req, false).url, insecure: req.insecureSkipVerify}
+	if opts.proxy == "" {
+		opts.proxy = c.proxy
+	}
+	if u, err := parseProxy(opts.proxy); err == nil && u.User != nil {
+		opts.proxy = u.Redacted()
+	}
+	if c.TLSConfig != nil && c.TLSConfig.InsecureSkipVerify {
+		opts.insecure = true
+	}
+	return req.curl(opts)
+}
+
+// curl builds the curl command of the request.
+func (r *Request) curl(opts curlOptions) string {
+	var b strings.Builder
+	b.WriteString("curl")
+
+	body := r.Body()
+	method := string(r.Header.Method())
+	switch {
+	case method == fasthttp.MethodHead && len(body) == 0:
+		// -X HEAD would make curl wait for a response body
+		b.WriteString(" -I")
+	case method != fasthttp.MethodGet || len(body) > 0:
+		writeCurlArg(&b, "-X", method)
+	}
+
+	uri := r.URI()
+	hasBasicAuth := len(uri.Username()) > 0
+	if hasBasicAuth {
+		writeCurlArg(&b, "-u", string(uri.Username())+":"+string(uri.Password()))
+	}
+	if opts.proxy != "" {
+		writeCurlArg(&b, "-x", opts.proxy)
+	}
+	if opts.insecure {
+		b.WriteString(" -k")
+	}
+
+	// multipart bodies are rebuilt by curl with its own boundary
+	boundary := ""
+	if r.mw != nil {
+		boundary = r.mw.Boundary()
+	} else if mediaType, params, err := mime.ParseMediaType(string(r.Header.ContentType())); err == nil && mediaType == MIMEMultipartForm {
+		boundary = params["boundary"]
+	}
+
+	r.Header.VisitAll(func(key, value []byte) {
+		k := string(key)
+		switch {
+		case strings.EqualFold(k, fasthttp.HeaderContentLength),
+			strings.EqualFold(k, fasthttp.HeaderCookie),
+			strings.EqualFold(k, fasthttp.HeaderHost) && bytes.Equal(value, uri.Host()):
+			return
+		case strings.EqualFold(k, fasthttp.HeaderContentType) && boundary != "":
+			return
+		case strings.EqualFold(k, fasthttp.HeaderAuthorization) && hasBasicAuth && bytes.HasPrefix(value, []byte("Basic ")):
+			return
+		case strings.EqualFold(k, fasthttp.HeaderUserAgent):
+			writeCurlArg(&b, "-A", string(value))
+			return
+		}
+		writeCurlArg(&b, "-H", k+": "+string(value))
+	})
+
+	var cookies []string
+	r.Header.VisitAllCookie(func(key, value []byte) {
+		cookies = append(cookies, string(key)+"="+string(value))
+	})
+	if len(cookies) > 0 {
+		writeCurlArg(&b, "-b", strings.Join(cookies, "; "))
+	}
+
+	pipe := ""
+	switch {
+	case len(body) == 0:
+	case boundary != "":
+		writeCurlMultipart(&b, body, boundary)
+	case utf8.Valid(body):
+		writeCurlArg(&b, "--data-raw", string(body))
+	default:
+		// binary bodies can not be quoted safely, so they are piped into curl
+		pipe = "echo " + shellQuote(base64.StdEncoding.EncodeToString(body)) + " | base64 -d | "
+		b.WriteString(" --data-binary @-")
+	}
+
+	b.WriteString(" ")
+	b.WriteString(shellQuote(uri.String()))
+
+	return pipe + b.String()
+}
+
+// writeCurlMultipart writes each part of a multipart body as -F option. File parts
+// refer to a file with the original file name, which must exist where curl runs.
+func writeCurlMultipart(b *strings.Builder, body []byte, boundary string) {
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		// the closing boundary is missing as long as the request has not been sent,
+		// so any error ends the body
+		part, err := mr.NextPart()
+		if err != nil {
+			return
+		}
+
+		if part.FileName() != "" {
+			value := part.FormName() + "=@" + curlFormQuote(part.FileName())
+			if ct := part.Header.Get(fasthttp.HeaderContentType); ct != "" && ct != MIMEOctetStream {
+				value += ";type=" + ct
+			}
+			writeCurlArg(b, "-F", value)
+			continue
+		}
+
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return
+		}
+		option := "-F"
+		if bytes.HasPrefix(value, []byte("@")) || bytes.HasPrefix(value, []byte("<")) || bytes.IndexByte(value, ';') >= 0 {
+			// -F reads values starting with @ or < from files and parses ;type= etc.
+			option = "--form-string"
+		}
+		writeCurlArg(b, option, part.FormName()+"="+string(value))
+	}
+}
+
+// writeCurlArg writes an option and its shell-quoted value.
+func writeCurlArg(b *strings.Builder, option, value string) {
+	b.WriteString(" ")
+	b.WriteString(option)
+	b.WriteString(" ")
+	b.WriteString(shellQuote(value))
+}
+
+// curlFormQuote quotes a file name for curl's -F option if necessary.
+func curlFormQuote(name string) string {
+	if !strings.ContainsAny(name, `;,"\ `) {
+		return name
+	}
+	name = strings.ReplaceAll(name, `\`, `\\`)
+	return `"` + strings.ReplaceAll(name, `"`, `\"`) + `"`
+}
+
+// shellQuote quotes s for POSIX shells using single quotes.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
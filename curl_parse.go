@@ -0,0 +1,680 @@
+package fastreq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/valyala/fasthttp"
+)
+
+// curlFlags lists the supported long curl options and whether they take a value.
+var curlFlags = map[string]bool{
+	"request":        true,
+	"header":         true,
+	"data":           true,
+	"data-ascii":     true,
+	"data-raw":       true,
+	"data-binary":    true,
+	"data-urlencode": true,
+	"form":           true,
+	"form-string":    true,
+	"user":           true,
+	"cookie":         true,
+	"user-agent":     true,
+	"referer":        true,
+	"proxy":          true,
+	"url":            true,
+	"compressed":     false,
+	"insecure":       false,
+	"get":            false,
+	"head":           false,
+	"globoff":        false,
+	// output only options, which do not change the request
+	"silent":     false,
+	"show-error": false,
+	"verbose":    false,
+	"include":    false,
+	"location":   false,
+}
+
+// curlShortFlags maps the supported short curl options to their long names.
+var curlShortFlags = map[byte]string{
+	'X': "request",
+	'H': "header",
+	'd': "data",
+	'F': "form",
+	'u': "user",
+	'b': "cookie",
+	'A': "user-agent",
+	'e': "referer",
+	'x': "proxy",
+	'k': "insecure",
+	'G': "get",
+	'I': "head",
+	'g': "globoff",
+	's': "silent",
+	'S': "show-error",
+	'v': "verbose",
+	'i': "include",
+	'L': "location",
+}
+
+// curlCommand holds the parsed options of a curl command line.
+type curlCommand struct {
+	method     string
+	url        string
+	headers    [][2]string
+	data       []string
+	forms      []curlFormPart
+	user       string
+	hasUser    bool
+	cookies    [][2]string
+	userAgent  string
+	referer    string
+	proxy      string
+	compressed bool
+	insecure   bool
+	get        bool
+	head       bool
+	globoff    bool
+}
+
+// curlFormPart is a part of a multipart form given by -F or --form-string.
+type curlFormPart struct {
+	name     string
+	value    string
+	fileName string
+	isFile   bool
+}
+
+// ParseCurl parses a curl command line, e.g. copied from API docs or the browser's
+// "Copy as cURL", into a Request and the options needed to send it with Client.Do.
+// Data of -d is mapped to a PostForm unless the request has another Content-Type,
+// -F to a MultipartForm, -k to InsecureSkipVerify and -x to Proxy. Files referred
+// to by @file are read when parsing. Options which only change curl's output, like
+// -s or -v, are ignored, and unsupported options are reported as error.
+func ParseCurl(cmdline string) (*Request, []ReqOption, error) {
+	args, err := splitCurlArgs(cmdline)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) > 0 && args[0] == "curl" {
+		args = args[1:]
+	}
+
+	cmd := &curlCommand{}
+	if err := cmd.parse(args); err != nil {
+		return nil, nil, err
+	}
+	return cmd.build()
+}
+
+// parse sets the options of the command from the arguments.
+func (cmd *curlCommand) parse(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		switch {
+		case arg == "--":
+			for _, u := range args[i+1:] {
+				if err := cmd.setURL(u); err != nil {
+					return err
+				}
+			}
+			return nil
+		case strings.HasPrefix(arg, "--"):
+			name := arg[2:]
+			hasValue, ok := curlFlags[name]
+			if !ok {
+				return fmt.Errorf("fastreq: unsupported curl option %s", arg)
+			}
+			value := ""
+			if hasValue {
+				if i+1 >= len(args) {
+					return fmt.Errorf("fastreq: curl option %s needs a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			if err := cmd.apply(name, value); err != nil {
+				return err
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// short options can be combined, e.g. -sSL, and take the rest of the
+			// argument or the next argument as value, e.g. -XPOST or -X POST
+			for j := 1; j < len(arg); j++ {
+				name, ok := curlShortFlags[arg[j]]
+				if !ok {
+					return fmt.Errorf("fastreq: unsupported curl option -%c", arg[j])
+				}
+				if !curlFlags[name] {
+					if err := cmd.apply(name, ""); err != nil {
+						return err
+					}
+					continue
+				}
+
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return fmt.Errorf("fastreq: curl option -%c needs a value", arg[j])
+					}
+					i++
+					value = args[i]
+				}
+				if err := cmd.apply(name, value); err != nil {
+					return err
+				}
+				break
+			}
+		default:
+			if err := cmd.setURL(arg); err != nil {
+				return err
+			}
+		}
+	}
+
+	if cmd.url == "" {
+		return errors.New("fastreq: no URL in curl command")
+	}
+	return nil
+}
+
+// apply sets the option with the given long name.
+func (cmd *curlCommand) apply(name, value string) error {
+	switch name {
+	case "request":
+		cmd.method = value
+	case "header":
+		if k, v, ok := strings.Cut(value, ":"); ok {
+			// "X-Name:" removes the header, which is not set anyway
+			if v = strings.TrimSpace(v); v != "" {
+				cmd.headers = append(cmd.headers, [2]string{strings.TrimSpace(k), v})
+			}
+		} else if k, ok := strings.CutSuffix(value, ";"); ok {
+			// "X-Name;" sends the header with an empty value
+			cmd.headers = append(cmd.headers, [2]string{strings.TrimSpace(k), ""})
+		} else {
+			return fmt.Errorf("fastreq: invalid curl header %q", value)
+		}
+	case "data", "data-ascii":
+		if strings.HasPrefix(value, "@") {
+			b, err := readCurlFile(value[1:])
+			if err != nil {
+				return err
+			}
+			// like curl, strip line breaks of files sent with -d
+			value = strings.NewReplacer("\r", "", "\n", "").Replace(string(b))
+		}
+		cmd.data = append(cmd.data, value)
+	case "data-raw":
+		cmd.data = append(cmd.data, value)
+	case "data-binary":
+		if strings.HasPrefix(value, "@") {
+			b, err := readCurlFile(value[1:])
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		}
+		cmd.data = append(cmd.data, value)
+	case "data-urlencode":
+		data, err := curlURLEncode(value)
+		if err != nil {
+			return err
+		}
+		cmd.data = append(cmd.data, data)
+	case "form":
+		part, err := parseCurlForm(value)
+		if err != nil {
+			return err
+		}
+		cmd.forms = append(cmd.forms, part)
+	case "form-string":
+		k, v, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("fastreq: invalid curl form %q", value)
+		}
+		cmd.forms = append(cmd.forms, curlFormPart{name: k, value: v})
+	case "user":
+		cmd.user, cmd.hasUser = value, true
+	case "cookie":
+		if !strings.Contains(value, "=") {
+			return fmt.Errorf("fastreq: curl cookie files are not supported: %s", value)
+		}
+		for _, c := range strings.Split(value, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(c), "=")
+			if k != "" {
+				cmd.cookies = append(cmd.cookies, [2]string{k, v})
+			}
+		}
+	case "user-agent":
+		cmd.userAgent = value
+	case "referer":
+		cmd.referer = strings.TrimSuffix(value, ";auto")
+	case "proxy":
+		cmd.proxy = value
+	case "url":
+		return cmd.setURL(value)
+	case "compressed":
+		cmd.compressed = true
+	case "insecure":
+		cmd.insecure = true
+	case "get":
+		cmd.get = true
+	case "head":
+		cmd.head = true
+	case "globoff":
+		cmd.globoff = true
+	}
+	return nil
+}
+
+// setURL sets the URL of the command, which may only be given once.
+func (cmd *curlCommand) setURL(u string) error {
+	if cmd.url != "" {
+		return errors.New("fastreq: curl commands with multiple URLs are not supported")
+	}
+	cmd.url = u
+	return nil
+}
+
+// build creates the request and its options from the command.
+func (cmd *curlCommand) build() (*Request, []ReqOption, error) {
+	if len(cmd.data) > 0 && len(cmd.forms) > 0 {
+		return nil, nil, errors.New("fastreq: curl command mixes -d and -F")
+	}
+
+	u := cmd.url
+	if !cmd.globoff {
+		var err error
+		if u, err = checkCurlGlob(u); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+
+	data := strings.Join(cmd.data, "&")
+	if cmd.get && len(cmd.data) > 0 {
+		if strings.Contains(u, "?") {
+			u += "&" + data
+		} else {
+			u += "?" + data
+		}
+		data = ""
+		cmd.data = nil
+	}
+
+	method := cmd.method
+	switch {
+	case method != "":
+	case cmd.head:
+		method = fasthttp.MethodHead
+	case len(cmd.data) > 0 || len(cmd.forms) > 0:
+		method = fasthttp.MethodPost
+	default:
+		method = fasthttp.MethodGet
+	}
+
+	req := NewRequest(HTTPMethod(method), u)
+	contentType := ""
+	for _, h := range cmd.headers {
+		if strings.EqualFold(h[0], fasthttp.HeaderContentType) {
+			contentType = h[1]
+		}
+		req.SetHeader(h[0], h[1])
+	}
+	if cmd.hasUser {
+		username, password, _ := strings.Cut(cmd.user, ":")
+		req.SetBasicAuth(username, password)
+	}
+	for _, c := range cmd.cookies {
+		req.SetCookie(c[0], c[1])
+	}
+	if cmd.userAgent != "" {
+		req.SetUserAgent(cmd.userAgent)
+	}
+	if cmd.referer != "" {
+		req.SetReferer(cmd.referer)
+	}
+	if cmd.compressed {
+		req.SetHeader(fasthttp.HeaderAcceptEncoding, "gzip, deflate, br")
+	}
+
+	var opts []ReqOption
+	switch {
+	case len(cmd.forms) > 0:
+		form := NewMultipartForm(multipart.NewWriter(io.Discard).Boundary())
+		for _, part := range cmd.forms {
+			if part.isFile {
+				form.AddFile(part.name, part.fileName, []byte(part.value))
+			} else {
+				form.Add(part.name, part.value)
+			}
+		}
+		opts = append(opts, form)
+	case len(cmd.data) > 0:
+		opts = append(opts, curlDataOption(req, contentType, data))
+	}
+	if cmd.insecure {
+		opts = append(opts, NewInsecureSkipVerify())
+	}
+	if cmd.proxy != "" {
+		opts = append(opts, NewProxy(cmd.proxy))
+	}
+
+	return req, opts, nil
+}
+
+// curlDataOption returns the option which sets the data of -d as body. URL-encoded
+// form data is mapped to a PostForm, other data is sent as it is.
+func curlDataOption(req *Request, contentType, data string) ReqOption {
+	if contentType != "" && !strings.HasPrefix(contentType, MIMEApplicationForm) {
+		return NewBody([]byte(data))
+	}
+	if !isFormData(data) {
+		// curl sends any data of -d as form, e.g. JSON without Content-Type
+		req.SetContentType(MIMEApplicationForm)
+		return NewBody([]byte(data))
+	}
+
+	form := NewPostForm()
+	form.Parse(data)
+	return form
+}
+
+// isFormData reports whether data is URL-encoded form data, which is encoded the
+// same way by fasthttp when it is parsed into a PostForm.
+func isFormData(data string) bool {
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-._~*&=+", c) >= 0:
+		case c == '%' && i+2 < len(data) && isHexDigit(data[i+1]) && isHexDigit(data[i+2]):
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseCurlForm parses the value of -F: name=value, name=@file or name=<file,
+// optionally followed by ;type= and ;filename=.
+func parseCurlForm(value string) (curlFormPart, error) {
+	name, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return curlFormPart{}, fmt.Errorf("fastreq: invalid curl form %q", value)
+	}
+	part := curlFormPart{name: name}
+
+	switch {
+	case strings.HasPrefix(v, "@"), strings.HasPrefix(v, "<"):
+		path, params := splitCurlFormValue(v[1:])
+		b, err := readCurlFile(path)
+		if err != nil {
+			return curlFormPart{}, err
+		}
+		part.value = string(b)
+		if v[0] == '@' {
+			part.isFile = true
+			part.fileName = filepath.Base(path)
+			if fileName, ok := params["filename"]; ok {
+				part.fileName = fileName
+			}
+		}
+	default:
+		part.value, _ = splitCurlFormValue(v)
+	}
+	return part, nil
+}
+
+// splitCurlFormValue splits a -F value into the value, which may be quoted, and
+// its ;key=value parameters.
+func splitCurlFormValue(v string) (string, map[string]string) {
+	value := v
+	rest := ""
+	if strings.HasPrefix(v, `"`) {
+		var b strings.Builder
+		i := 1
+		for ; i < len(v) && v[i] != '"'; i++ {
+			if v[i] == '\\' && i+1 < len(v) {
+				i++
+			}
+			b.WriteByte(v[i])
+		}
+		value = b.String()
+		if i < len(v) {
+			rest = v[i+1:]
+		}
+	} else if i := strings.Index(v, ";"); i >= 0 {
+		// only known parameters end the value, other semicolons belong to it
+		for _, p := range []string{";type=", ";filename=", ";headers="} {
+			if j := strings.Index(v, p); j >= 0 && j <= i {
+				value, rest = v[:j], v[j:]
+				break
+			}
+		}
+	}
+
+	params := make(map[string]string)
+	for _, p := range strings.Split(rest, ";") {
+		if k, pv, ok := strings.Cut(p, "="); ok {
+			params[strings.TrimSpace(k)] = strings.Trim(pv, `"`)
+		}
+	}
+	return value, params
+}
+
+// curlURLEncode encodes the value of --data-urlencode: content, =content,
+// name=content, @file or name@file.
+func curlURLEncode(value string) (string, error) {
+	i := strings.IndexByte(value, '=')
+	if i < 0 {
+		i = strings.IndexByte(value, '@')
+	}
+	if i < 0 {
+		return curlEscape(value), nil
+	}
+
+	name, content := value[:i], value[i+1:]
+	if value[i] == '@' {
+		b, err := readCurlFile(content)
+		if err != nil {
+			return "", err
+		}
+		content = string(b)
+	}
+	if name == "" {
+		return curlEscape(content), nil
+	}
+	return name + "=" + curlEscape(content), nil
+}
+
+// curlEscape percent-encodes s like curl, which encodes spaces as %20.
+func curlEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// readCurlFile reads a file referred to by @file.
+func readCurlFile(path string) ([]byte, error) {
+	if path == "-" {
+		return nil, errors.New("fastreq: reading curl data from stdin is not supported")
+	}
+	return os.ReadFile(path)
+}
+
+// checkCurlGlob returns an error if the URL contains curl's globbing patterns, which
+// expand to several requests, and removes the backslashes of escaped brackets.
+func checkCurlGlob(u string) (string, error) {
+	var b strings.Builder
+	start := 0
+	if i := strings.Index(u, "://"); i >= 0 {
+		start = i + 3
+	}
+	b.WriteString(u[:start])
+
+	for i := start; i < len(u); i++ {
+		c := u[i]
+		switch {
+		case c == '\\' && i+1 < len(u) && strings.IndexByte("{}[]", u[i+1]) >= 0:
+			i++
+			b.WriteByte(u[i])
+		case c == '[' && i == start:
+			// IPv6 addresses, e.g. http://[::1]:8080/
+			end := strings.IndexByte(u[i:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("fastreq: curl URL globbing is not supported, use -g: %s", u)
+			}
+			b.WriteString(u[i : i+end+1])
+			i += end
+		case strings.IndexByte("{}[]", c) >= 0:
+			return "", fmt.Errorf("fastreq: curl URL globbing is not supported, use -g: %s", u)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// splitCurlArgs splits a command line into arguments like a POSIX shell, including
+// line continuations and the $'...' quoting used by browsers.
+func splitCurlArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		b     strings.Builder
+		inArg bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, errors.New("fastreq: unterminated escape in curl command")
+			}
+			i++
+			if s[i] == '\n' {
+				continue
+			}
+			if s[i] == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+				i++
+				continue
+			}
+			b.WriteByte(s[i])
+			inArg = true
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("fastreq: unterminated quote in curl command")
+			}
+			b.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, err := unquoteANSIC(&b, s[i+2:])
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte("$`\"\\\n", s[j+1]) >= 0 {
+					j++
+					if s[j] == '\n' {
+						continue
+					}
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.New("fastreq: unterminated quote in curl command")
+			}
+			i = j
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			b.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args, nil
+}
+
+// unquoteANSIC writes the content of a $'...' string, which starts at s, to b and
+// returns the number of bytes read including the closing quote.
+func unquoteANSIC(b *strings.Builder, s string) (int, error) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\'' {
+			return i + 1, nil
+		}
+		if c != '\\' || i+1 >= len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && isHexDigit(s[j]) {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i+1:j], 16, 8)
+			if err != nil {
+				return 0, fmt.Errorf("fastreq: invalid escape in curl command: %s", s[i-1:j])
+			}
+			b.WriteByte(byte(v))
+			i = j - 1
+		case 'u':
+			j := i + 1
+			for j < len(s) && j < i+5 && isHexDigit(s[j]) {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i+1:j], 16, 32)
+			if err != nil {
+				return 0, fmt.Errorf("fastreq: invalid escape in curl command: %s", s[i-1:j])
+			}
+			var buf [utf8.UTFMax]byte
+			b.Write(buf[:utf8.EncodeRune(buf[:], rune(v))])
+			i = j - 1
+		default:
+			// \\, \', \" and unknown escapes
+			b.WriteByte(s[i])
+		}
+	}
+	return 0, errors.New("fastreq: unterminated quote in curl command")
+}
+
+// isHexDigit reports whether c is a hexadecimal digit.
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
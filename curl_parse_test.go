@@ -0,0 +1,147 @@
+package fastreq
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_ParseCurl(t *testing.T) {
+	req, opts, err := ParseCurl(`curl -sSL -XPUT 'https://example.com/api?q=1' \
+		-H 'Content-Type: application/json' -H "X-Token: a\"b" -H 'X-Empty;' -H 'Accept:' \
+		-u user:pass -b 'a=1; b=2' -A fastreq -e https://example.com/ --compressed -k \
+		-x socks5://127.0.0.1:1080 --data-raw $'{"name":"it\'s"}'`)
+	require.NoError(t, err)
+	defer req.Release()
+
+	require.Equal(t, "PUT", string(req.Header.Method()))
+	require.Equal(t, "https://example.com/api?q=1", req.URI().String())
+	require.Equal(t, "user", string(req.URI().Username()))
+	require.Equal(t, "pass", string(req.URI().Password()))
+	require.Equal(t, `a"b`, string(req.Header.Peek("X-Token")))
+	require.Equal(t, "", string(req.Header.Peek("X-Empty")))
+	require.Contains(t, req.Header.String(), "X-Empty: \r\n")
+	require.Empty(t, req.Header.Peek("Accept"))
+	require.Equal(t, "1", string(req.Header.Cookie("a")))
+	require.Equal(t, "2", string(req.Header.Cookie("b")))
+	require.Equal(t, "fastreq", string(req.Header.UserAgent()))
+	require.Equal(t, "https://example.com/", string(req.Header.Referer()))
+	require.Equal(t, "gzip, deflate, br", string(req.Header.Peek("Accept-Encoding")))
+
+	require.Len(t, opts, 3)
+	require.Equal(t, NewBody([]byte(`{"name":"it's"}`)), opts[0])
+	require.Equal(t, NewInsecureSkipVerify(), opts[1])
+	require.Equal(t, NewProxy("socks5://127.0.0.1:1080"), opts[2])
+}
+
+func Test_ParseCurl_Data(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a b&c\n"), 0o600))
+
+	// form data is mapped to a PostForm, other data is sent as it is
+	req, opts, err := ParseCurl(`curl example.com -d user=fastreq --data-urlencode 'name=a b' --data-urlencode name@` + path)
+	require.NoError(t, err)
+	require.Equal(t, "POST", string(req.Header.Method()))
+	require.Equal(t, "http://example.com/", req.URI().String())
+	require.Len(t, opts, 1)
+	form, ok := opts[0].(*PostForm)
+	require.True(t, ok)
+	require.Equal(t, "fastreq", string(form.Peek("user")))
+	require.Equal(t, []string{"a b", "a b&c\n"}, []string{string(form.PeekMulti("name")[0]), string(form.PeekMulti("name")[1])})
+	req.Release()
+
+	req, opts, err = ParseCurl(`curl example.com -d '{"a":1}'`)
+	require.NoError(t, err)
+	require.Equal(t, MIMEApplicationForm, string(req.Header.ContentType()))
+	require.Equal(t, NewBody([]byte(`{"a":1}`)), opts[0])
+	req.Release()
+
+	// -G moves the data into the query string
+	req, opts, err = ParseCurl(`curl -G 'example.com/?page=1' -d q=fastreq`)
+	require.NoError(t, err)
+	require.Equal(t, "GET", string(req.Header.Method()))
+	require.Equal(t, "http://example.com/?page=1&q=fastreq", req.URI().String())
+	require.Empty(t, opts)
+	req.Release()
+
+	req, _, err = ParseCurl(`curl -I example.com`)
+	require.NoError(t, err)
+	require.Equal(t, "HEAD", string(req.Header.Method()))
+	req.Release()
+}
+
+func Test_ParseCurl_Errors(t *testing.T) {
+	for cmdline, msg := range map[string]string{
+		`curl 'example.com/[1-3].html'`:    "globbing",
+		`curl 'example.com/{a,b}'`:         "globbing",
+		`curl -b cookies.txt example.com`:  "cookie files",
+		`curl --oauth2-bearer x example`:   "unsupported curl option --oauth2-bearer",
+		`curl -Z example.com`:              "unsupported curl option -Z",
+		`curl example.com -X`:              "needs a value",
+		`curl 'example.com`:                "unterminated quote",
+		`curl -s`:                          "no URL",
+		`curl a.com b.com`:                 "multiple URLs",
+		`curl a.com -d a=1 -F b=2`:         "mixes -d and -F",
+		`curl a.com --data-binary @-`:      "stdin",
+		`curl a.com -F 'file=@/nonexist/'`: "no such file",
+	} {
+		_, _, err := ParseCurl(cmdline)
+		require.ErrorContains(t, err, msg, cmdline)
+	}
+
+	for cmdline, expected := range map[string]string{
+		`curl -g 'example.com/[1-3].html'`: "http://example.com/%5B1-3%5D.html",
+		`curl 'example.com/\[1\].html'`:    "http://example.com/%5B1%5D.html",
+		`curl 'http://[::1]:8080/'`:        "http://[::1]:8080/",
+	} {
+		req, _, err := ParseCurl(cmdline)
+		require.NoError(t, err, cmdline)
+		require.Equal(t, expected, req.URI().String(), cmdline)
+		req.Release()
+	}
+}
+
+func Test_ParseCurl_Multipart(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			mf, err := ctx.MultipartForm()
+			require.NoError(t, err)
+			require.Equal(t, []string{"bar"}, mf.Value["foo"])
+			require.Equal(t, []string{"@literal;x"}, mf.Value["at"])
+			require.Equal(t, []string{"fastreq"}, mf.Value["text"])
+			require.Equal(t, "upload.txt", mf.File["txt"][0].Filename)
+			require.Equal(t, int64(7), mf.File["txt"][0].Size)
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("fastreq"), 0o600))
+
+	req, opts, err := ParseCurl(`curl http://make.fasthttp.great/upload -F foo=bar --form-string 'at=@literal;x' ` +
+		`-F 'text=<` + path + `' -F 'txt=@` + path + `;type=text/plain;filename=upload.txt'`)
+	require.NoError(t, err)
+	defer req.Release()
+
+	resp, err := client.Do(req, opts...)
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	resp.Release()
+}
@@ -0,0 +1,268 @@
+package fastreq
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// digestChallenge is a Digest challenge of a server, which is reused for the
+// following requests to the same host.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	stale     bool // the challenge only renews the nonce
+
+	mu sync.Mutex
+	nc uint32 // nonce count, the number of requests sent with the nonce
+}
+
+// digestAuth holds the state of a MiddlewareDigest.
+type digestAuth struct {
+	username string
+	password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge // by host
+}
+
+// MiddlewareDigest returns a middleware which authenticates the requests with
+// HTTP Digest authentication, see RFC 7616. The MD5 and SHA-256 algorithms and
+// their session variants are supported, with the qop auth or auth-int.
+//
+// A request without known challenge is sent without credentials first. If the
+// server responds with a Digest challenge, the request is sent once more with
+// the credentials. The challenge is kept per host, so that the following
+// requests are authenticated right away, with increasing nonce counts.
+func MiddlewareDigest(username, password string) Middleware {
+	d := &digestAuth{
+		username:   username,
+		password:   password,
+		challenges: make(map[string]*digestChallenge),
+	}
+
+	return func(ctx *Ctx) error {
+		host := string(ctx.Request.URI().Host())
+		d.mu.Lock()
+		ch := d.challenges[host]
+		d.mu.Unlock()
+
+		if ch != nil {
+			if err := d.authorize(ctx.Request, ch); err != nil {
+				return err
+			}
+		}
+
+		index := ctx.indexMiddleware
+		err := ctx.Next()
+		if err != nil || ctx.Response.StatusCode() != fasthttp.StatusUnauthorized {
+			return err
+		}
+
+		// retry once if the server sent a new challenge, the 401 response is
+		// returned for wrong credentials
+		fresh := parseDigestChallenges(ctx.Response.Header.PeekAll(fasthttp.HeaderWWWAuthenticate))
+		if fresh == nil || ch != nil && !fresh.stale {
+			return nil
+		}
+		d.mu.Lock()
+		d.challenges[host] = fresh
+		d.mu.Unlock()
+		if err := d.authorize(ctx.Request, fresh); err != nil {
+			return err
+		}
+
+		ctx.Response.Release()
+		ctx.Response = nil
+		ctx.indexMiddleware = index
+		return ctx.Next()
+	}
+}
+
+// authorize sets the Digest Authorization header of req for the challenge.
+func (d *digestAuth) authorize(req *Request, ch *digestChallenge) error {
+	ch.mu.Lock()
+	ch.nc++
+	nc := ch.nc
+	ch.mu.Unlock()
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	cnonce := hex.EncodeToString(b)
+
+	header, err := d.header(ch, string(req.Header.Method()), string(req.URI().RequestURI()), req.Body(), nc, cnonce)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(fasthttp.HeaderAuthorization, header)
+	return nil
+}
+
+// header returns the Authorization header for a request, see RFC 7616 section
+// 3.4.
+func (d *digestAuth) header(ch *digestChallenge, method, uri string, body []byte, nc uint32, cnonce string) (string, error) {
+	var newHash func() hash.Hash
+	algorithm := strings.ToUpper(ch.algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("fastreq: unsupported digest algorithm %q", ch.algorithm)
+	}
+	h := func(s ...string) string {
+		hh := newHash()
+		hh.Write([]byte(strings.Join(s, ":")))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	ha1 := h(d.username, ch.realm, d.password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1, ch.nonce, cnonce)
+	}
+	ha2 := h(method, uri)
+	if ch.qop == "auth-int" {
+		hb := newHash()
+		hb.Write(body)
+		ha2 = h(method, uri, hex.EncodeToString(hb.Sum(nil)))
+	}
+
+	count := fmt.Sprintf("%08x", nc)
+	var response string
+	if ch.qop == "" {
+		response = h(ha1, ch.nonce, ha2)
+	} else {
+		response = h(ha1, ch.nonce, count, cnonce, ch.qop, ha2)
+	}
+
+	username := d.username
+	if ch.userhash {
+		username = h(d.username, ch.realm)
+	}
+
+	var b strings.Builder
+	b.WriteString("Digest ")
+	fmt.Fprintf(&b, `username=%s, realm=%s, nonce=%s, uri=%s`,
+		quoteString(username), quoteString(ch.realm), quoteString(ch.nonce), quoteString(uri))
+	if ch.algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", ch.algorithm)
+	}
+	fmt.Fprintf(&b, ", response=%s", quoteString(response))
+	if ch.opaque != "" {
+		fmt.Fprintf(&b, ", opaque=%s", quoteString(ch.opaque))
+	}
+	if ch.qop != "" {
+		fmt.Fprintf(&b, ", qop=%s, nc=%s, cnonce=%s", ch.qop, count, quoteString(cnonce))
+	}
+	if ch.userhash {
+		b.WriteString(", userhash=true")
+	}
+	return b.String(), nil
+}
+
+// quoteString returns s as quoted string.
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// parseDigestChallenges returns the strongest supported Digest challenge of the
+// WWW-Authenticate headers, or nil if there is none.
+func parseDigestChallenges(headers [][]byte) *digestChallenge {
+	var best *digestChallenge
+	for _, header := range headers {
+		ch, err := parseDigestChallenge(string(header))
+		if err != nil {
+			continue
+		}
+		if best == nil || strings.HasPrefix(strings.ToUpper(ch.algorithm), "SHA-256") {
+			best = ch
+		}
+	}
+	return best
+}
+
+// parseDigestChallenge parses a Digest challenge, see RFC 7616 section 3.3.
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, errors.New("fastreq: not a digest challenge")
+	}
+
+	ch := &digestChallenge{}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("fastreq: invalid digest challenge %q", header)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimLeft(value, " \t")
+
+		if strings.HasPrefix(value, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(value) && value[i] != '"'; i++ {
+				if value[i] == '\\' && i+1 < len(value) {
+					i++
+				}
+				b.WriteByte(value[i])
+			}
+			if i >= len(value) {
+				return nil, fmt.Errorf("fastreq: invalid digest challenge %q", header)
+			}
+			value, rest = b.String(), value[i+1:]
+		} else {
+			value, rest, _ = strings.Cut(value, ",")
+			value = strings.TrimSpace(value)
+		}
+
+		switch key {
+		case "realm":
+			ch.realm = value
+		case "nonce":
+			ch.nonce = value
+		case "opaque":
+			ch.opaque = value
+		case "algorithm":
+			ch.algorithm = value
+		case "qop":
+			for _, qop := range strings.Split(value, ",") {
+				qop = strings.TrimSpace(qop)
+				if qop == "auth" || qop == "auth-int" && ch.qop == "" {
+					ch.qop = qop
+				}
+			}
+		case "userhash":
+			ch.userhash = strings.EqualFold(value, "true")
+		case "stale":
+			ch.stale = strings.EqualFold(value, "true")
+		}
+	}
+	if ch.nonce == "" {
+		return nil, fmt.Errorf("fastreq: digest challenge without nonce %q", header)
+	}
+	switch strings.TrimSuffix(strings.ToUpper(ch.algorithm), "-SESS") {
+	case "", "MD5", "SHA-256":
+	default:
+		return nil, fmt.Errorf("fastreq: unsupported digest algorithm %q", ch.algorithm)
+	}
+	return ch, nil
+}
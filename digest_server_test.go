@@ -0,0 +1,157 @@
+package fastreq_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"github.com/wnanbei/fastreq/fastreqtest"
+)
+
+// digestServer is a server stand-in for Digest authentication with MD5 and
+// qop=auth-int.
+type digestServer struct {
+	mu     sync.Mutex
+	nonce  string
+	ncs    []string
+	rounds int
+}
+
+func (s *digestServer) handle(ctx *fasthttp.RequestCtx) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rounds++
+
+	challenge := func(stale bool) {
+		header := `Digest realm="test", qop="auth-int", nonce="` + s.nonce + `", opaque="o"`
+		if stale {
+			header += ", stale=true"
+		}
+		ctx.Response.Header.Add(fasthttp.HeaderWWWAuthenticate, `Basic realm="test"`)
+		ctx.Response.Header.Add(fasthttp.HeaderWWWAuthenticate, header)
+		ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+	}
+
+	auth := string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+	if !strings.HasPrefix(auth, "Digest ") {
+		challenge(false)
+		return
+	}
+	params := make(map[string]string)
+	for _, p := range strings.Split(strings.TrimPrefix(auth, "Digest "), ", ") {
+		key, value, _ := strings.Cut(p, "=")
+		params[key] = strings.Trim(value, `"`)
+	}
+	if params["nonce"] != s.nonce {
+		challenge(true)
+		return
+	}
+
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := md5hex("Mufasa:test:Circle of Life")
+	ha2 := md5hex(string(ctx.Method()) + ":" + params["uri"] + ":" + md5hex(string(ctx.PostBody())))
+	expected := md5hex(ha1 + ":" + s.nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth-int:" + ha2)
+	if params["response"] != expected || params["uri"] != string(ctx.RequestURI()) || params["opaque"] != "o" {
+		challenge(false)
+		return
+	}
+	s.ncs = append(s.ncs, params["nc"])
+	ctx.SetBodyString("welcome")
+}
+
+func Test_MiddlewareDigest(t *testing.T) {
+	server := &digestServer{nonce: "n1"}
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/dir/index.html").WithQuery("a", "b").Times(8).Handle(server.handle)
+
+	client := srv.Client()
+	client.SetDigestAuth("Mufasa", "Circle of Life")
+
+	post := func() *fastreq.Response {
+		resp, err := client.Post("http://make.fasthttp.great/dir/index.html?a=b", fastreq.NewBody([]byte("body")))
+		require.NoError(t, err)
+		return resp
+	}
+
+	// the challenge is answered, then reused with increasing nonce counts
+	for i := 0; i < 2; i++ {
+		resp := post()
+		require.Equal(t, "welcome", string(resp.Body()))
+		resp.Release()
+	}
+	require.Equal(t, 3, server.rounds)
+	require.Equal(t, []string{"00000001", "00000002"}, server.ncs)
+
+	// a stale nonce is renewed
+	server.nonce = "n2"
+	resp := post()
+	require.Equal(t, "welcome", string(resp.Body()))
+	resp.Release()
+	require.Equal(t, 5, server.rounds)
+	require.Equal(t, "00000001", server.ncs[2])
+
+	// wrong credentials are not retried over and over
+	client.SetDigestAuth("Mufasa", "wrong")
+	resp = post()
+	require.Equal(t, fasthttp.StatusUnauthorized, resp.StatusCode())
+	resp.Release()
+	require.Equal(t, 7, server.rounds)
+
+	resp = post()
+	require.Equal(t, fasthttp.StatusUnauthorized, resp.StatusCode())
+	resp.Release()
+	require.Equal(t, 8, server.rounds)
+}
+
+func Test_MiddlewareDigest_Multipart(t *testing.T) {
+	server := &digestServer{nonce: "n1"}
+	var forms []string
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/upload").Times(3).Handle(func(ctx *fasthttp.RequestCtx) {
+		server.handle(ctx)
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			return
+		}
+		form, err := ctx.MultipartForm()
+		if err != nil {
+			forms = append(forms, err.Error())
+			return
+		}
+		body := ctx.PostBody()
+		forms = append(forms, form.Value["foo"][0]+" "+form.File["txt"][0].Filename+" "+
+			strconv.Itoa(bytes.Count(body, []byte("--fastreq--"))))
+	})
+
+	client := srv.Client()
+	client.SetDigestAuth("Mufasa", "Circle of Life")
+
+	// the body retried after the challenge is completed only once
+	mf := fastreq.NewMultipartForm("fastreq", "foo", "bar")
+	mf.AddFile("txt", "file.txt", []byte("fastreq"))
+	resp, err := client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	require.Equal(t, "welcome", string(resp.Body()))
+	resp.Release()
+	require.Equal(t, 2, server.rounds)
+	require.Equal(t, []string{"bar file.txt 1"}, forms)
+
+	// the cached challenge is answered with the digest of the completed body
+	mf = fastreq.NewMultipartForm("fastreq", "foo", "baz")
+	mf.AddFile("txt", "file.txt", []byte("fastreq"))
+	resp, err = client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	require.Equal(t, "welcome", string(resp.Body()))
+	resp.Release()
+	require.Equal(t, 3, server.rounds)
+	require.Equal(t, []string{"bar file.txt 1", "baz file.txt 1"}, forms)
+}
@@ -0,0 +1,50 @@
+package fastreq
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Digest_Header(t *testing.T) {
+	// RFC 7616 section 3.9.1
+	d := &digestAuth{username: "Mufasa", password: "Circle of Life"}
+	challenge := `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, ` +
+		`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+
+	for algorithm, response := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		ch, err := parseDigestChallenge(strings.Replace(challenge, "%s", algorithm, 1))
+		require.NoError(t, err)
+		require.Equal(t, "auth", ch.qop)
+
+		header, err := d.header(ch, "GET", "/dir/index.html", nil, 1, "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+		require.NoError(t, err)
+		require.Equal(t, `Digest username="Mufasa", realm="http-auth@example.org", `+
+			`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", `+
+			`algorithm=`+algorithm+`, response="`+response+`", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", `+
+			`qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"`, header)
+	}
+}
+
+func Test_Digest_Challenges(t *testing.T) {
+	ch := parseDigestChallenges([][]byte{
+		[]byte(`Basic realm="x"`),
+		[]byte(`Digest realm="a \"quoted\" realm", nonce="n1", algorithm=MD5`),
+		[]byte(`Digest realm="r", nonce="n2", algorithm=SHA-512-256`),
+		[]byte(`Digest realm="r", nonce="n3", algorithm=SHA-256-sess, qop=auth-int, stale=TRUE, userhash=true`),
+	})
+	require.NotNil(t, ch)
+	require.Equal(t, "n3", ch.nonce)
+	require.Equal(t, "auth-int", ch.qop)
+	require.True(t, ch.stale)
+	require.True(t, ch.userhash)
+
+	ch = parseDigestChallenges([][]byte{[]byte(`Digest realm="a \"quoted\" realm", nonce="n1"`)})
+	require.Equal(t, `a "quoted" realm`, ch.realm)
+
+	require.Nil(t, parseDigestChallenges([][]byte{[]byte(`Digest realm="r"`), []byte(`Digest realm="r, nonce=n`)}))
+}
@@ -0,0 +1,55 @@
+package fastreq
+
+import (
+	"crypto"
+	"encoding/base64"
+
+	"github.com/valyala/fasthttp"
+)
+
+// The external tests, which use fastreqtest, check the results of the requests
+// with these internals.
+
+// ParseOauthHeader returns the parameters of an OAuth Authorization header.
+var ParseOauthHeader = parseOauthHeader
+
+// JWTVerify verifies a JWT and returns its header and claims.
+var JWTVerify = jwtVerify
+
+// ContentDigest returns the Content-Digest header of a body.
+var ContentDigest = contentDigest
+
+// Oauth1Signature returns the signature of req with the given OAuth parameters.
+func Oauth1Signature(o *Oauth1, req *Request, params map[string]string) (string, error) {
+	all := make([]oauthParam, 0, len(params))
+	for key, value := range params {
+		all = append(all, oauthParam{key, value})
+	}
+	return o.signature(req, all)
+}
+
+// SignHTTPResponse sets the signature sig1 of resp to req with the given
+// components and parameters, as a server would.
+func SignHTTPResponse(req *fasthttp.Request, resp *fasthttp.Response, components []string, params string,
+	alg HTTPSigAlgorithm, key crypto.PrivateKey,
+) error {
+	parsed := make([]httpSigComponent, len(components))
+	for i, name := range components {
+		c, err := parseHTTPSigComponent(name)
+		if err != nil {
+			return err
+		}
+		parsed[i] = c
+	}
+	base, err := httpSigMessage{req: req, resp: resp}.base(parsed, params)
+	if err != nil {
+		return err
+	}
+	signature, err := httpSigSign(alg, key, []byte(base))
+	if err != nil {
+		return err
+	}
+	resp.Header.Set("Signature-Input", "sig1="+params)
+	resp.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
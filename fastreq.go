@@ -48,6 +48,7 @@ const (
 	DebugClose DebugLevel = iota // close debug
 	DebugSimple
 	DebugDetail
+	DebugCurl // print requests as curl commands
 )
 
 // debugLimit limit length of debug logging output
@@ -0,0 +1,26 @@
+package fastreqtest
+
+import (
+	"testing"
+
+	"github.com/wnanbei/fastreq"
+)
+
+// CheckLeaks enables the leak detection of fastreq for the rest of the test and
+// fails the test if a Request, Response or Ctx acquired during it was not released,
+// or was released more than once.
+//
+// The leak detection is global, so tests using CheckLeaks must not run in parallel.
+func CheckLeaks(t testing.TB) {
+	t.Helper()
+
+	fastreq.ResetLeaks()
+	fastreq.SetLeakDetection(true)
+	t.Cleanup(func() {
+		fastreq.SetLeakDetection(false)
+		for _, leak := range fastreq.Leaks() {
+			t.Errorf("fastreqtest: %s", leak)
+		}
+		fastreq.ResetLeaks()
+	})
+}
@@ -0,0 +1,200 @@
+package fastreqtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+)
+
+// Matcher reports whether a request received by the Server matches a route.
+type Matcher func(req *fasthttp.Request) bool
+
+// Route is an expectation registered on a Server together with its canned
+// response. All methods return the Route so that calls can be chained.
+type Route struct {
+	mu       *sync.Mutex // the mutex of the Server
+	method   string
+	path     string
+	matchers []Matcher
+	// times is the expected number of calls, 0 means at least once
+	times    int
+	optional bool
+	calls    int
+
+	status  int
+	headers [][2]string
+	body    []byte
+	handler fasthttp.RequestHandler
+}
+
+// WithQuery matches requests with the given query parameter.
+func (r *Route) WithQuery(key, value string) *Route {
+	return r.Match(func(req *fasthttp.Request) bool {
+		return string(req.URI().QueryArgs().Peek(key)) == value
+	})
+}
+
+// WithHeader matches requests with the given header.
+func (r *Route) WithHeader(key, value string) *Route {
+	return r.Match(func(req *fasthttp.Request) bool {
+		return string(req.Header.Peek(key)) == value
+	})
+}
+
+// WithBody matches requests whose body is exactly body.
+func (r *Route) WithBody(body string) *Route {
+	return r.Match(func(req *fasthttp.Request) bool {
+		return string(req.Body()) == body
+	})
+}
+
+// WithFormValue matches requests with the given urlencoded or multipart form field.
+func (r *Route) WithFormValue(key, value string) *Route {
+	return r.Match(func(req *fasthttp.Request) bool {
+		if mf, err := req.MultipartForm(); err == nil {
+			values := mf.Value[key]
+			return len(values) > 0 && values[0] == value
+		}
+		return string(req.PostArgs().Peek(key)) == value
+	})
+}
+
+// WithJSONBody matches requests whose body is JSON equal to v, ignoring formatting
+// and the order of object keys.
+func (r *Route) WithJSONBody(v any) *Route {
+	want, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("fastreqtest: can not marshal JSON body: %v", err))
+	}
+	return r.Match(func(req *fasthttp.Request) bool {
+		var a, b any
+		if json.Unmarshal(want, &a) != nil || json.Unmarshal(req.Body(), &b) != nil {
+			return false
+		}
+		return reflect.DeepEqual(a, b)
+	})
+}
+
+// Match matches requests with a custom matcher.
+func (r *Route) Match(m Matcher) *Route {
+	r.matchers = append(r.matchers, m)
+	return r
+}
+
+// Times expects the route to be called exactly n times. By default a route is
+// expected to be called at least once.
+func (r *Route) Times(n int) *Route {
+	r.times = n
+	return r
+}
+
+// Once expects the route to be called exactly once.
+func (r *Route) Once() *Route {
+	return r.Times(1)
+}
+
+// Optional does not expect the route to be called at all.
+func (r *Route) Optional() *Route {
+	r.optional = true
+	return r
+}
+
+// Reply sets the status code of the response.
+func (r *Route) Reply(status int) *Route {
+	r.status = status
+	return r
+}
+
+// Header adds a header to the response.
+func (r *Route) Header(key, value string) *Route {
+	r.headers = append(r.headers, [2]string{key, value})
+	return r
+}
+
+// Body sets the body of the response.
+func (r *Route) Body(body string) *Route {
+	r.body = []byte(body)
+	return r
+}
+
+// JSON sets the body of the response to v encoded as JSON.
+func (r *Route) JSON(v any) *Route {
+	body, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("fastreqtest: can not marshal JSON response: %v", err))
+	}
+	r.body = body
+	return r.Header("Content-Type", fastreq.MIMEApplicationJSON)
+}
+
+// Handle responds with a custom handler instead of the canned response.
+func (r *Route) Handle(handler fasthttp.RequestHandler) *Route {
+	r.handler = handler
+	return r
+}
+
+// Calls returns how many times the route was called.
+func (r *Route) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+// String returns the method and path of the route.
+func (r *Route) String() string {
+	return r.method + " " + r.path
+}
+
+// matches reports whether req matches the route.
+func (r *Route) matches(req *fasthttp.Request) bool {
+	if !bytes.Equal(req.Header.Method(), []byte(r.method)) {
+		return false
+	}
+	if string(req.URI().Path()) != r.path {
+		return false
+	}
+	for _, m := range r.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
+// exhausted reports whether the route has been called as often as expected.
+func (r *Route) exhausted() bool {
+	return r.times > 0 && r.calls >= r.times
+}
+
+// unmet describes why the expectation of the route is not met, or returns an
+// empty string if it is.
+func (r *Route) unmet() string {
+	switch {
+	case r.optional:
+		return ""
+	case r.times > 0 && r.calls != r.times:
+		return fmt.Sprintf("%s expected %d calls, got %d", r, r.times, r.calls)
+	case r.calls == 0:
+		return fmt.Sprintf("%s was never called", r)
+	}
+	return ""
+}
+
+// respond writes the canned response of the route.
+func (r *Route) respond(ctx *fasthttp.RequestCtx) {
+	if r.handler != nil {
+		r.handler(ctx)
+		return
+	}
+
+	ctx.SetStatusCode(r.status)
+	for _, h := range r.headers {
+		ctx.Response.Header.Add(h[0], h[1])
+	}
+	ctx.SetBody(r.body)
+}
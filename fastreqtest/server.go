@@ -0,0 +1,154 @@
+// Package fastreqtest provides an in-memory mock server for testing code which
+// sends requests with fastreq.
+//
+//	srv := fastreqtest.NewServer(t)
+//	srv.On(fastreq.GET, "/users").WithQuery("page", "1").Reply(200).JSON(users)
+//
+//	resp, err := srv.Client().Get(srv.URL() + "/users?page=1")
+//
+// Every route registered on the server is expected to be called, which is checked
+// when the test finishes.
+package fastreqtest
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"github.com/wnanbei/fastreq"
+)
+
+// DefaultURL is the base URL of the mock server. Any other host works as well,
+// the client of the server sends every request to it.
+const DefaultURL = "http://fastreq.test"
+
+// Server is an in-memory mock HTTP server. Requests are matched against the routes
+// in the order they were registered, the first matching route which has not been
+// exhausted handles the request.
+type Server struct {
+	t      testing.TB
+	ln     *fasthttputil.InmemoryListener
+	server *fasthttp.Server
+	client *fastreq.Client
+
+	mu         sync.Mutex
+	routes     []*Route
+	unexpected []string
+}
+
+// NewServer starts a new mock server, which is shut down when the test finishes.
+// At that point the test fails if a route was not called as often as expected or
+// if the server received a request no route expected.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		t:  t,
+		ln: fasthttputil.NewInmemoryListener(),
+	}
+	s.server = &fasthttp.Server{Handler: s.handle}
+	go func() {
+		err := s.server.Serve(s.ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	s.client = fastreq.NewClient()
+	s.client.Dial = func(addr string) (net.Conn, error) {
+		return s.ln.Dial()
+	}
+
+	t.Cleanup(func() {
+		s.AssertExpectations(t)
+		_ = s.ln.Close()
+	})
+	return s
+}
+
+// Client returns the Client wired to the server. It can be configured like any
+// other Client, but its Dial function must not be replaced.
+func (s *Server) Client() *fastreq.Client {
+	return s.client
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return DefaultURL
+}
+
+// On registers a route for the given method and path. The path is matched without
+// the query string, use Route.WithQuery to match query parameters.
+func (s *Server) On(method fastreq.HTTPMethod, path string) *Route {
+	r := &Route{
+		mu:     &s.mu,
+		method: string(method),
+		path:   path,
+		status: fasthttp.StatusOK,
+	}
+
+	s.mu.Lock()
+	s.routes = append(s.routes, r)
+	s.mu.Unlock()
+	return r
+}
+
+// AssertExpectations fails the test if a route was not called as expected or the
+// server received unexpected requests. It is called automatically when the test
+// finishes.
+func (s *Server) AssertExpectations(t testing.TB) bool {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok := true
+	for _, r := range s.routes {
+		if msg := r.unmet(); msg != "" {
+			t.Errorf("fastreqtest: %s", msg)
+			ok = false
+		}
+	}
+	for _, msg := range s.unexpected {
+		t.Errorf("fastreqtest: %s", msg)
+		ok = false
+	}
+	return ok
+}
+
+// handle dispatches a request to the first matching route.
+func (s *Server) handle(ctx *fasthttp.RequestCtx) {
+	s.mu.Lock()
+	var matched, exhausted *Route
+	for _, r := range s.routes {
+		if !r.matches(&ctx.Request) {
+			continue
+		}
+		if r.exhausted() {
+			if exhausted == nil {
+				exhausted = r
+			}
+			continue
+		}
+		matched = r
+		break
+	}
+	switch {
+	case matched != nil:
+		matched.calls++
+	case exhausted != nil:
+		s.unexpected = append(s.unexpected, fmt.Sprintf("%s called more than %d times", exhausted, exhausted.times))
+	default:
+		s.unexpected = append(s.unexpected, fmt.Sprintf("unexpected request %s %s", ctx.Method(), ctx.RequestURI()))
+	}
+	s.mu.Unlock()
+
+	if matched == nil {
+		ctx.Error("fastreqtest: no route for "+string(ctx.Method())+" "+string(ctx.RequestURI()), fasthttp.StatusNotFound)
+		return
+	}
+	matched.respond(ctx)
+}
@@ -0,0 +1,114 @@
+package fastreqtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+)
+
+// recorder records the failures of a test instead of failing it.
+type recorder struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recorder) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(t)
+	users := srv.On(fastreq.GET, "/users").
+		WithQuery("page", "1").
+		WithHeader("X-Token", "secret").
+		Reply(fasthttp.StatusOK).
+		JSON(map[string]any{"name": "fastreq"})
+	created := srv.On(fastreq.POST, "/users").
+		WithJSONBody(map[string]any{"name": "fastreq", "age": 1}).
+		Reply(fasthttp.StatusCreated).
+		Once()
+	form := srv.On(fastreq.POST, "/login").
+		WithFormValue("user", "fastreq").
+		Reply(fasthttp.StatusNoContent)
+
+	client := srv.Client()
+
+	resp, err := client.Get(srv.URL()+"/users?page=1", fastreq.NewHeaders("X-Token", "secret"))
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Equal(t, "fastreq", resp.JsonGet("name").String())
+	resp.Release()
+
+	resp, err = client.Post(srv.URL()+"/users", fastreq.NewJsonBody(map[string]any{"age": 1, "name": "fastreq"}))
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusCreated, resp.StatusCode())
+	resp.Release()
+
+	resp, err = client.Post(srv.URL()+"/login", fastreq.NewPostForm("user", "fastreq"))
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusNoContent, resp.StatusCode())
+	resp.Release()
+
+	require.Equal(t, 1, users.Calls())
+	require.Equal(t, 1, created.Calls())
+	require.Equal(t, 1, form.Calls())
+}
+
+func TestServer_Expectations(t *testing.T) {
+	rec := &recorder{TB: t}
+	srv := NewServer(rec)
+	srv.On(fastreq.GET, "/never")
+	srv.On(fastreq.GET, "/optional").Optional()
+	srv.On(fastreq.GET, "/once").Once()
+
+	client := srv.Client()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL() + "/once")
+		require.NoError(t, err)
+		resp.Release()
+	}
+
+	resp, err := client.Get(srv.URL() + "/unknown")
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusNotFound, resp.StatusCode())
+	resp.Release()
+
+	rec.finish()
+	require.Equal(t, []string{
+		"fastreqtest: GET /never was never called",
+		"fastreqtest: GET /once called more than 1 times",
+		"fastreqtest: unexpected request GET /unknown",
+	}, rec.errors)
+}
+
+func TestCheckLeaks(t *testing.T) {
+	rec := &recorder{TB: t}
+	CheckLeaks(rec)
+
+	srv := NewServer(t)
+	srv.On(fastreq.GET, "/")
+
+	resp, err := srv.Client().Get(srv.URL() + "/")
+	require.NoError(t, err)
+	_ = resp
+
+	rec.finish()
+	require.Len(t, rec.errors, 2)
+	require.Contains(t, rec.errors[0], "not released")
+}
@@ -0,0 +1,448 @@
+package fastreq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// harVersion is the version of the HAR format written by HARRecorder.
+const harVersion = "1.2"
+
+// HAR is an HTTP Archive, see http://www.softwareishard.com/blog/har-12-spec/.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of the exported data.
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator is the application which created the log.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is an exported request together with its response.
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is an exported request.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is an exported response.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header or a query parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie is a request or response cookie.
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// HARPostData is the body of a request.
+type HARPostData struct {
+	MimeType string     `json:"mimeType"`
+	Params   []HARParam `json:"params,omitempty"`
+	Text     string     `json:"text"`
+	// Encoding is not part of HAR 1.2 for requests, but commonly used by tools to
+	// export binary bodies as base64 like the response content.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARParam is a form field, or a file of a multipart form.
+type HARParam struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// HARContent is the body of a response.
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// HARTimings are the timings of an entry in milliseconds. Blocked, DNS, Connect
+// and SSL are -1 if not available, while Send, Wait and Receive can't be. As
+// fasthttp doesn't expose the phases of a request, HARRecorder records the time
+// of the whole exchange as wait, and zero for send and receive.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARRecorder captures requests sent by a Client into a HAR, which can be inspected
+// in the developer tools of browsers. Use MiddlewareHAR to capture requests.
+type HARRecorder struct {
+	mu      sync.Mutex
+	entries []*HAREntry
+}
+
+// NewHARRecorder creates a new, empty HARRecorder.
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{}
+}
+
+// MiddlewareHAR generates a middleware function which captures every request that
+// received a response into the given HARRecorder.
+func MiddlewareHAR(rec *HARRecorder) Middleware {
+	return func(ctx *Ctx) error {
+		start := time.Now()
+		if err := ctx.Next(); err != nil {
+			return err
+		}
+		rec.add(ctx.Request, ctx.Response, start, time.Since(start))
+		return nil
+	}
+}
+
+// Entries returns the captured entries.
+func (r *HARRecorder) Entries() []*HAREntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*HAREntry(nil), r.entries...)
+}
+
+// Reset drops all captured entries.
+func (r *HARRecorder) Reset() {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// HAR returns the captured entries as HAR.
+func (r *HARRecorder) HAR() *HAR {
+	return &HAR{Log: HARLog{
+		Version: harVersion,
+		Creator: HARCreator{Name: "fastreq", Version: Version},
+		Entries: r.Entries(),
+	}}
+}
+
+// WriteTo writes the captured entries as HAR JSON to w.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	content, err := json.MarshalIndent(r.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(content)
+	return int64(n), err
+}
+
+// SaveToFile writes the captured entries as HAR JSON to the file at path.
+func (r *HARRecorder) SaveToFile(path string) error {
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// add captures a request and its response.
+func (r *HARRecorder) add(req *Request, resp *Response, start time.Time, elapsed time.Duration) {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	entry := &HAREntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request:         newHARRequest(req),
+		Response:        newHARResponse(resp),
+		Timings:         HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 0, Wait: ms, Receive: 0},
+	}
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+}
+
+// newHARRequest exports req.
+func newHARRequest(req *Request) HARRequest {
+	h := HARRequest{
+		Method:      string(req.Header.Method()),
+		URL:         req.URI().String(),
+		HTTPVersion: string(req.Header.Protocol()),
+		Cookies:     []HARCookie{},
+		Headers:     []HARNameValue{},
+		QueryString: []HARNameValue{},
+		HeadersSize: len(req.Header.Header()),
+		BodySize:    len(req.Body()),
+	}
+	req.Header.VisitAll(func(key, value []byte) {
+		h.Headers = append(h.Headers, HARNameValue{Name: string(key), Value: string(value)})
+	})
+	req.Header.VisitAllCookie(func(key, value []byte) {
+		h.Cookies = append(h.Cookies, HARCookie{Name: string(key), Value: string(value)})
+	})
+	req.URI().QueryArgs().VisitAll(func(key, value []byte) {
+		h.QueryString = append(h.QueryString, HARNameValue{Name: string(key), Value: string(value)})
+	})
+
+	body := req.Body()
+	if len(body) == 0 {
+		return h
+	}
+	contentType := string(req.Header.ContentType())
+	h.PostData = &HARPostData{MimeType: contentType}
+	h.PostData.Text, h.PostData.Encoding = encodeText(body)
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case MIMEApplicationForm:
+		req.PostArgs().VisitAll(func(key, value []byte) {
+			h.PostData.Params = append(h.PostData.Params, HARParam{Name: string(key), Value: string(value)})
+		})
+	case MIMEMultipartForm:
+		h.PostData.Params, _ = parseHARMultipart(body, params["boundary"])
+	}
+	return h
+}
+
+// newHARResponse exports resp.
+func newHARResponse(resp *Response) HARResponse {
+	h := HARResponse{
+		Status:      resp.StatusCode(),
+		StatusText:  fasthttp.StatusMessage(resp.StatusCode()),
+		HTTPVersion: string(resp.Header.Protocol()),
+		Cookies:     []HARCookie{},
+		Headers:     []HARNameValue{},
+		RedirectURL: string(resp.Header.Peek(fasthttp.HeaderLocation)),
+		HeadersSize: len(resp.Header.Header()),
+		BodySize:    len(resp.Body()),
+	}
+	resp.Header.VisitAll(func(key, value []byte) {
+		h.Headers = append(h.Headers, HARNameValue{Name: string(key), Value: string(value)})
+	})
+	resp.Header.VisitAllCookie(func(_, value []byte) {
+		c := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(c)
+		if c.ParseBytes(value) != nil {
+			return
+		}
+		cookie := HARCookie{
+			Name:     string(c.Key()),
+			Value:    string(c.Value()),
+			Path:     string(c.Path()),
+			Domain:   string(c.Domain()),
+			HTTPOnly: c.HTTPOnly(),
+			Secure:   c.Secure(),
+		}
+		if !c.Expire().Equal(fasthttp.CookieExpireUnlimited) {
+			cookie.Expires = c.Expire().Format(time.RFC3339)
+		}
+		h.Cookies = append(h.Cookies, cookie)
+	})
+
+	body, err := resp.BodyUncompressed()
+	if err != nil {
+		body = resp.Body()
+	}
+	h.Content = HARContent{Size: len(body), MimeType: string(resp.Header.ContentType())}
+	h.Content.Text, h.Content.Encoding = encodeText(body)
+	return h
+}
+
+// parseHARMultipart exports the parts of a multipart body as params.
+func parseHARMultipart(body []byte, boundary string) ([]HARParam, error) {
+	var params []HARParam
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := r.NextPart()
+		if errors.Is(err, io.EOF) {
+			return params, nil
+		}
+		if err != nil {
+			return params, err
+		}
+		value, err := io.ReadAll(part)
+		if err != nil {
+			return params, err
+		}
+		params = append(params, HARParam{
+			Name:        part.FormName(),
+			Value:       string(value),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get(fasthttp.HeaderContentType),
+		})
+	}
+}
+
+// HARImport is a request imported from a HAR. Form bodies are rebuilt as Options,
+// which must be passed to Client.Do together with the Request.
+type HARImport struct {
+	Request *Request
+	Options []ReqOption
+}
+
+// LoadHAR imports the requests of the HAR file at path, see ReadHAR.
+func LoadHAR(path string) ([]*HARImport, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadHAR(f)
+}
+
+// ReadHAR imports the requests of a HAR, for example one exported by a browser,
+// as replayable requests. urlencoded bodies are rebuilt as PostForm and multipart
+// bodies as MultipartForm, other bodies are set on the request as they are.
+func ReadHAR(r io.Reader) ([]*HARImport, error) {
+	var har HAR
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, err
+	}
+
+	imports := make([]*HARImport, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		imp, err := importHARRequest(&entry.Request)
+		if err != nil {
+			for _, i := range imports {
+				i.Request.Release()
+			}
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+	return imports, nil
+}
+
+// importHARRequest rebuilds a single request.
+func importHARRequest(h *HARRequest) (*HARImport, error) {
+	imp := &HARImport{Request: NewRequest(HTTPMethod(h.Method), h.URL)}
+	req := imp.Request
+
+	var mediaType string
+	var params map[string]string
+	if h.PostData != nil {
+		mediaType, params, _ = mime.ParseMediaType(h.PostData.MimeType)
+	}
+	isForm := mediaType == MIMEApplicationForm || mediaType == MIMEMultipartForm
+
+	hasCookieHeader := false
+	for _, header := range h.Headers {
+		name := header.Name
+		switch {
+		case strings.HasPrefix(name, ":"): // HTTP/2 pseudo headers
+			continue
+		case strings.EqualFold(name, fasthttp.HeaderContentLength), strings.EqualFold(name, fasthttp.HeaderHost):
+			continue
+		case isForm && strings.EqualFold(name, fasthttp.HeaderContentType):
+			continue
+		case strings.EqualFold(name, fasthttp.HeaderCookie):
+			hasCookieHeader = true
+		}
+		req.AddHeader(name, header.Value)
+	}
+	if !hasCookieHeader {
+		for _, c := range h.Cookies {
+			req.SetCookie(c.Name, c.Value)
+		}
+	}
+
+	if h.PostData == nil {
+		return imp, nil
+	}
+	body, err := decodeText(h.PostData.Text, h.PostData.Encoding)
+	if err != nil {
+		req.Release()
+		return nil, err
+	}
+
+	switch mediaType {
+	case MIMEApplicationForm:
+		form := NewPostForm()
+		if len(h.PostData.Params) > 0 {
+			for _, p := range h.PostData.Params {
+				form.Add(p.Name, p.Value)
+			}
+		} else {
+			form.Parse(unsafeB2S(body))
+		}
+		imp.Options = append(imp.Options, form)
+	case MIMEMultipartForm:
+		// the values of params lose binary file content in JSON, the text
+		// doesn't as it is base64 encoded
+		harParams := h.PostData.Params
+		if len(harParams) == 0 || (len(body) > 0 && params["boundary"] != "") {
+			if harParams, err = parseHARMultipart(body, params["boundary"]); err != nil {
+				req.Release()
+				return nil, err
+			}
+		}
+		boundary := params["boundary"]
+		if boundary == "" {
+			boundary = multipart.NewWriter(io.Discard).Boundary()
+		}
+		form := NewMultipartForm(boundary)
+		for _, p := range harParams {
+			if p.FileName != "" {
+				form.AddFile(p.Name, p.FileName, []byte(p.Value))
+			} else {
+				form.Add(p.Name, p.Value)
+			}
+		}
+		imp.Options = append(imp.Options, form)
+	default:
+		req.SetBody(body)
+	}
+	return imp, nil
+}
@@ -0,0 +1,206 @@
+package fastreq
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_HAR_Export_Import(t *testing.T) {
+	var received []string
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			switch string(ctx.Path()) {
+			case "/form":
+				received = append(received, "form "+string(ctx.PostArgs().Peek("user")))
+			case "/upload":
+				mf, err := ctx.MultipartForm()
+				require.NoError(t, err)
+				f, err := mf.File["txt"][0].Open()
+				require.NoError(t, err)
+				buf := make([]byte, mf.File["txt"][0].Size)
+				_, err = f.Read(buf)
+				require.NoError(t, err)
+				received = append(received, "upload "+mf.Value["foo"][0]+" "+mf.File["txt"][0].Filename+" "+string(buf))
+			case "/binary":
+				ctx.Response.Header.Set("Set-Cookie", "session=abc; Path=/; HttpOnly")
+				ctx.SetContentType(MIMEOctetStream)
+				ctx.SetBody([]byte{0xff, 0x00, 0xfe})
+			}
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	rec := NewHARRecorder()
+	client.UseMiddleware("har", MiddlewareHAR(rec))
+
+	resp, err := client.Post("http://make.fasthttp.great/form?page=1", NewPostForm("user", "fastreq"), NewCookies("id", "1"))
+	require.NoError(t, err)
+	resp.Release()
+
+	mf := NewMultipartForm("fastreq", "foo", "bar")
+	mf.AddFile("txt", "file1.txt", []byte("fastreq"))
+	resp, err = client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	resp.Release()
+
+	resp, err = client.Get("http://make.fasthttp.great/binary")
+	require.NoError(t, err)
+	resp.Release()
+
+	require.Equal(t, []string{"form fastreq", "upload bar file1.txt fastreq"}, received)
+
+	entries := rec.Entries()
+	require.Len(t, entries, 3)
+
+	form := entries[0].Request
+	require.Equal(t, "POST", form.Method)
+	require.Equal(t, "http://make.fasthttp.great/form?page=1", form.URL)
+	require.Equal(t, []HARNameValue{{Name: "page", Value: "1"}}, form.QueryString)
+	require.Equal(t, []HARCookie{{Name: "id", Value: "1"}}, form.Cookies)
+	require.Equal(t, []HARParam{{Name: "user", Value: "fastreq"}}, form.PostData.Params)
+
+	upload := entries[1].Request
+	require.Equal(t, []HARParam{
+		{Name: "foo", Value: "bar"},
+		{Name: "txt", Value: "fastreq", FileName: "file1.txt", ContentType: MIMEOctetStream},
+	}, upload.PostData.Params)
+
+	binary := entries[2].Response
+	require.Equal(t, fasthttp.StatusOK, binary.Status)
+	require.Equal(t, "base64", binary.Content.Encoding)
+	require.Equal(t, "/wD+", binary.Content.Text)
+	require.Equal(t, "session", binary.Cookies[0].Name)
+	require.True(t, binary.Cookies[0].HTTPOnly)
+	require.Equal(t, float64(-1), entries[2].Timings.DNS)
+	require.Equal(t, float64(0), entries[2].Timings.Send)
+	require.Equal(t, float64(0), entries[2].Timings.Receive)
+	require.Equal(t, entries[2].Time, entries[2].Timings.Wait)
+
+	// the exported HAR can be imported and replayed
+	var buf bytes.Buffer
+	_, err = rec.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `"version": "1.2"`)
+
+	imports, err := ReadHAR(&buf)
+	require.NoError(t, err)
+	require.Len(t, imports, 3)
+
+	received = nil
+	for _, imp := range imports[:2] {
+		resp, err := client.Do(imp.Request, imp.Options...)
+		require.NoError(t, err)
+		require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+		resp.Release()
+		imp.Request.Release()
+	}
+	require.Equal(t, []string{"form fastreq", "upload bar file1.txt fastreq"}, received)
+	imports[2].Request.Release()
+}
+
+func Test_HAR_Export_Import_Binary(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go func() {
+		_ = fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+			mf, err := ctx.MultipartForm()
+			if err != nil {
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+				return
+			}
+			f, err := mf.File["bin"][0].Open()
+			if err != nil {
+				ctx.SetStatusCode(fasthttp.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			_, _ = io.Copy(ctx, f)
+		})
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	rec := NewHARRecorder()
+	client.UseMiddleware("har", MiddlewareHAR(rec))
+
+	content := []byte{0xff, 0xfe, 0x00, 0x80, 'f', 'a', 's', 't'}
+	mf := NewMultipartForm("fastreq")
+	mf.AddFile("bin", "file.bin", content)
+	resp, err := client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	require.Equal(t, content, resp.Body())
+	resp.Release()
+
+	var buf bytes.Buffer
+	_, err = rec.WriteTo(&buf)
+	require.NoError(t, err)
+	imports, err := ReadHAR(&buf)
+	require.NoError(t, err)
+	require.Len(t, imports, 1)
+
+	// the file content survives the JSON of the HAR
+	resp, err = client.Do(imports[0].Request, imports[0].Options...)
+	require.NoError(t, err)
+	require.Equal(t, content, resp.Body())
+	resp.Release()
+	imports[0].Request.Release()
+}
+
+func Test_HAR_Import_Browser(t *testing.T) {
+	har := `{"log": {"version": "1.2", "creator": {"name": "WebInspector", "version": "537.36"}, "entries": [{
+		"request": {
+			"method": "POST",
+			"url": "https://example.com/upload",
+			"httpVersion": "HTTP/2.0",
+			"headers": [
+				{"name": ":authority", "value": "example.com"},
+				{"name": "content-type", "value": "multipart/form-data; boundary=----WebKitFormBoundary"},
+				{"name": "content-length", "value": "190"},
+				{"name": "x-token", "value": "abc"}
+			],
+			"cookies": [{"name": "session", "value": "xyz"}],
+			"queryString": [],
+			"postData": {
+				"mimeType": "multipart/form-data; boundary=----WebKitFormBoundary",
+				"text": "------WebKitFormBoundary\r\nContent-Disposition: form-data; name=\"foo\"\r\n\r\nbar\r\n------WebKitFormBoundary--\r\n"
+			}
+		}
+	}]}}`
+
+	imports, err := ReadHAR(strings.NewReader(har))
+	require.NoError(t, err)
+	require.Len(t, imports, 1)
+
+	req := imports[0].Request
+	defer req.Release()
+	require.Equal(t, "POST", string(req.Header.Method()))
+	require.Equal(t, "abc", string(req.Header.Peek("X-Token")))
+	require.Equal(t, "xyz", string(req.Header.Cookie("session")))
+	require.Empty(t, req.Header.Peek(":authority"))
+
+	require.Len(t, imports[0].Options, 1)
+	mf, ok := imports[0].Options[0].(*MultipartForm)
+	require.True(t, ok)
+	require.Equal(t, "----WebKitFormBoundary", mf.Boundary)
+	require.Equal(t, "bar", string(mf.Peek("foo")))
+	mf.Release()
+}
@@ -1,6 +1,7 @@
 package fastreq
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/valyala/fasthttp"
@@ -10,11 +11,16 @@ var headersPool sync.Pool
 
 // Headers is a wrapper for fasthttp.RequestHeader
 type Headers struct {
-	headers        fasthttp.RequestHeader
+	headers fasthttp.RequestHeader
+	// order are the header names in the order they were added, in their
+	// original casing
+	order          []string
+	ordered        bool
 	notAutoRelease bool
 }
 
-// NewHeaders creates a new Headers
+// NewHeaders creates a new Headers. The order of the headers is kept for
+// requests with ordered headers, see NewOrderedHeaders.
 func NewHeaders(kv ...string) *Headers {
 	var h *Headers
 	v := headersPool.Get()
@@ -25,23 +31,41 @@ func NewHeaders(kv ...string) *Headers {
 	}
 
 	for i := 1; i < len(kv); i += 2 {
-		h.headers.Add(kv[i-1], kv[i])
+		h.Add(kv[i-1], kv[i])
 	}
 
 	return h
 }
 
+// NewOrderedHeaders creates a new Headers which sends the request with ordered
+// headers: the headers are sent in the order and casing they were set with, by
+// Request.SetHeaders and Headers for example. Headers without order, like the
+// ones set by middlewares, follow them.
+//
+// See Client.SetOrderedHeaders to send all requests with ordered headers.
+func NewOrderedHeaders(kv ...string) *Headers {
+	h := NewHeaders(kv...)
+	h.ordered = true
+	return h
+}
+
 // BindRequest binds the headers to the given request
 func (h *Headers) BindRequest(req *Request) error {
 	h.headers.VisitAll(func(key, value []byte) {
 		req.Request.Header.AddBytesKV(key, value)
 	})
+	req.headerOrder = append(req.headerOrder, h.order...)
+	if h.ordered {
+		req.orderedHeaders = true
+	}
 	return nil
 }
 
 // Release frees the resources held by header
 func (h *Headers) Release() {
 	h.headers.Reset()
+	h.order = h.order[:0]
+	h.ordered = false
 	h.notAutoRelease = false
 	headersPool.Put(h)
 }
@@ -64,6 +88,7 @@ func (h *Headers) isAutoRelease() bool {
 // Use Set for setting a single header for the given key.
 func (h *Headers) Add(key, value string) {
 	h.headers.Add(key, value)
+	h.order = append(h.order, key)
 }
 
 // AddBytesK adds the given 'key: value' header.
@@ -72,6 +97,7 @@ func (h *Headers) Add(key, value string) {
 // Use SetBytesK for setting a single header for the given key.
 func (h *Headers) AddBytesK(key []byte, value string) {
 	h.headers.AddBytesK(key, value)
+	h.order = append(h.order, string(key))
 }
 
 // AddBytesV adds the given 'key: value' header.
@@ -80,6 +106,7 @@ func (h *Headers) AddBytesK(key []byte, value string) {
 // Use SetBytesV for setting a single header for the given key.
 func (h *Headers) AddBytesV(key string, value []byte) {
 	h.headers.AddBytesV(key, value)
+	h.order = append(h.order, key)
 }
 
 // AddBytesKV adds the given 'key: value' header.
@@ -92,6 +119,7 @@ func (h *Headers) AddBytesV(key string, value []byte) {
 // and will overwrite the previous value.
 func (h *Headers) AddBytesKV(key, value []byte) {
 	h.headers.AddBytesKV(key, value)
+	h.order = append(h.order, string(key))
 }
 
 // Set sets the given 'key: value' header.
@@ -99,6 +127,7 @@ func (h *Headers) AddBytesKV(key, value []byte) {
 // Use Add for setting multiple header values under the same key.
 func (h *Headers) Set(key, value string) {
 	h.headers.Set(key, value)
+	h.order = append(h.order, key)
 }
 
 // SetBytesK sets the given 'key: value' header.
@@ -106,6 +135,7 @@ func (h *Headers) Set(key, value string) {
 // Use AddBytesK for setting multiple header values under the same key.
 func (h *Headers) SetBytesK(key []byte, value string) {
 	h.headers.SetBytesK(key, value)
+	h.order = append(h.order, string(key))
 }
 
 // SetBytesV sets the given 'key: value' header.
@@ -113,6 +143,7 @@ func (h *Headers) SetBytesK(key []byte, value string) {
 // Use AddBytesV for setting multiple header values under the same key.
 func (h *Headers) SetBytesV(key string, value []byte) {
 	h.headers.SetBytesV(key, value)
+	h.order = append(h.order, key)
 }
 
 // SetBytesKV sets the given 'key: value' header.
@@ -120,6 +151,7 @@ func (h *Headers) SetBytesV(key string, value []byte) {
 // Use AddBytesKV for setting multiple header values under the same key.
 func (h *Headers) SetBytesKV(key, value []byte) {
 	h.headers.SetBytesKV(key, value)
+	h.order = append(h.order, string(key))
 }
 
 // Del deletes header with the given key.
@@ -169,3 +201,40 @@ func (h *Headers) PeekAll(key string) [][]byte {
 func (h *Headers) VisitAll(f func(key, value []byte)) {
 	h.headers.VisitAll(f)
 }
+
+// SetOrderedHeaders sets whether all requests are sent with ordered headers,
+// see NewOrderedHeaders. It sets DisableHeaderNamesNormalizing as well, so
+// that the headers of responses keep their casing too.
+func (c *Client) SetOrderedHeaders(enable bool) {
+	c.orderedHeaders = enable
+	c.DisableHeaderNamesNormalizing = enable
+	c.resetTransports()
+}
+
+// headerOrder returns the order the headers of req are sent in, which is the
+// one of its profile followed by the one of the request with ordered headers.
+// It returns false to leave the order to fasthttp.
+func (c *Client) headerOrder(req *Request, profile *BrowserProfile) ([]string, bool) {
+	var order []string
+	if profile != nil {
+		order = profile.order()
+	}
+	if c.orderedHeaders || req.orderedHeaders {
+		if profile == nil && !containsFold(req.headerOrder, fasthttp.HeaderHost) {
+			// Host leads the headers, unless its position was set
+			order = append(order, fasthttp.HeaderHost)
+		}
+		return append(order, req.headerOrder...), true
+	}
+	return order, profile != nil
+}
+
+// containsFold reports whether names contains name, ignoring case.
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
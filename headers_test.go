@@ -68,3 +68,58 @@ func Test_Headers_Del(t *testing.T) {
 	require.Empty(t, h.Peek("Content-Length"))
 	require.Empty(t, h.Peek("Cookie"))
 }
+
+func Test_Headers_Ordered(t *testing.T) {
+	client, requests := rawServer(t)
+
+	req := NewRequest(GET, "http://make.fasthttp.great/")
+	defer req.Release()
+	req.SetHeaders("x-api-KEY", "secret", "accept", "*/*")
+	resp, err := client.Do(req, NewOrderedHeaders("User-agent", "legacy", "HOST", "make.fasthttp.great"))
+	require.NoError(t, err)
+	resp.Release()
+	require.Equal(t, []string{
+		"GET / HTTP/1.1",
+		"x-api-KEY: secret",
+		"accept: */*",
+		"User-agent: legacy",
+		"HOST: make.fasthttp.great",
+	}, <-requests)
+
+	// without ordered headers, fasthttp normalizes and orders them
+	resp, err = client.Get("http://make.fasthttp.great/", NewHeaders("x-api-KEY", "secret"))
+	require.NoError(t, err)
+	resp.Release()
+	require.Equal(t, []string{
+		"GET / HTTP/1.1",
+		"User-Agent: " + defaultUserAgent,
+		"Host: make.fasthttp.great",
+		"X-Api-Key: secret",
+	}, <-requests)
+}
+
+func Test_Client_SetOrderedHeaders(t *testing.T) {
+	client, requests := rawServer(t)
+	client.SetOrderedHeaders(true)
+	require.True(t, client.DisableHeaderNamesNormalizing)
+
+	req := NewRequest(POST, "http://make.fasthttp.great/")
+	defer req.Release()
+	req.SetHeader("content-type", "text/plain")
+	req.AddHeader("X-b", "1")
+	req.AddHeader("x-A", "2")
+	req.SetBodyString("body")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Release()
+	// Host leads the headers without a given position, the others follow
+	require.Equal(t, []string{
+		"POST / HTTP/1.1",
+		"Host: make.fasthttp.great",
+		"content-type: text/plain",
+		"X-b: 1",
+		"x-A: 2",
+		"Content-Length: 4",
+		"User-Agent: " + defaultUserAgent,
+	}, <-requests)
+}
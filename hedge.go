@@ -0,0 +1,192 @@
+package fastreq
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// hedgeSamples is the number of recent latencies MiddlewareHedge keeps to compute
+// the percentile delay, which is updated every hedgeUpdateEvery samples.
+const (
+	hedgeSamples     = 512
+	hedgeUpdateEvery = 32
+)
+
+// hedgeWarmupDelay is the default delay of MiddlewareHedge with a Percentile,
+// until enough latencies have been observed.
+const hedgeWarmupDelay = time.Second
+
+// HedgeConfig configures MiddlewareHedge.
+type HedgeConfig struct {
+	// Delay is the time to wait for a response before a hedge is sent. With a
+	// Percentile, it is used until enough latencies have been observed, 1 second
+	// by default, so that the first requests are not all hedged right away.
+	Delay time.Duration
+	// Percentile sets the delay to the given percentile of the latencies observed
+	// recently, e.g. 95 to hedge the slowest 5% of the requests.
+	Percentile float64
+	// MinSamples is the number of latencies observed before the Percentile is
+	// used, 20 by default.
+	MinSamples int
+	// MaxHedges is the number of hedges sent for a request, 1 by default.
+	MaxHedges int
+	// Hosts are alternate hosts the hedges are sent to, in turn. Without hosts,
+	// hedges are sent to the host of the request.
+	Hosts []string
+}
+
+// hedger holds the state of a MiddlewareHedge.
+type hedger struct {
+	config HedgeConfig
+	delay  atomic.Int64
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	count   int
+}
+
+// hedgeResult is the result of a single attempt of a hedged request.
+type hedgeResult struct {
+	attempt int
+	ctx     *Ctx
+	err     error
+}
+
+// MiddlewareHedge returns a middleware which reduces the tail latency of requests
+// marked as idempotent, see NewIdempotent. If a request has not been answered
+// within the delay, a hedge, that is a copy of the request, is sent, and the
+// first response is used. Other requests are sent as usual.
+//
+// fasthttp can not abort a request in flight, so attempts which lose are not
+// waited for: their responses are dropped and released once they arrive. Hedges
+// which have not been sent yet are cancelled. The attempt which answered is
+// stored as ValueHedge.
+func MiddlewareHedge(config *HedgeConfig) Middleware {
+	h := &hedger{config: *config}
+	if h.config.MinSamples <= 0 {
+		h.config.MinSamples = 20
+	}
+	if h.config.MaxHedges <= 0 {
+		h.config.MaxHedges = 1
+	}
+	if h.config.Percentile > 0 && h.config.Delay <= 0 {
+		h.config.Delay = hedgeWarmupDelay
+	}
+	h.delay.Store(int64(h.config.Delay))
+
+	return func(ctx *Ctx) error {
+		if !ctx.Request.idempotent {
+			return ctx.Next()
+		}
+		return h.do(ctx)
+	}
+}
+
+// do sends the request of ctx and its hedges, and sets the first response on ctx.
+func (h *hedger) do(ctx *Ctx) error {
+	start := time.Now()
+	results := make(chan hedgeResult, 1+h.config.MaxHedges)
+	launch := func(attempt int) {
+		f := ctx.fork()
+		if attempt > 0 && len(h.config.Hosts) > 0 {
+			f.Request.URI().SetHost(h.config.Hosts[(attempt-1)%len(h.config.Hosts)])
+		}
+		go func() {
+			err := f.Next()
+			if attempt == 0 && err == nil {
+				// the latency of the request itself, also if a hedge answered first
+				h.observe(time.Since(start))
+			}
+			results <- hedgeResult{attempt: attempt, ctx: f, err: err}
+		}()
+	}
+
+	launch(0)
+	attempts, pending := 1, 1
+	timer := time.NewTimer(time.Duration(h.delay.Load()))
+	defer timer.Stop()
+
+	var err error
+	for {
+		select {
+		case <-timer.C:
+			if attempts <= h.config.MaxHedges {
+				launch(attempts)
+				attempts++
+				pending++
+				timer.Reset(time.Duration(h.delay.Load()))
+			}
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				err = r.err
+				releaseHedge(r)
+				if pending > 0 {
+					continue
+				}
+				if attempts <= h.config.MaxHedges {
+					// hedge right away instead of waiting for the delay
+					launch(attempts)
+					attempts++
+					pending++
+					continue
+				}
+				return err
+			}
+
+			ctx.Response = r.ctx.Response
+			ctx.Response.Request = ctx.fastRequest()
+			r.ctx.Response = nil
+			ctx.values = append(ctx.values[:0], r.ctx.values...)
+			ctx.SetValue(ValueHedge, r.attempt)
+			releaseHedge(r)
+
+			if pending > 0 {
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						releaseHedge(<-results)
+					}
+				}(pending)
+			}
+			return nil
+		}
+	}
+}
+
+// releaseHedge releases the Ctx of an attempt with its request and response.
+func releaseHedge(r hedgeResult) {
+	if r.ctx.Response != nil {
+		r.ctx.Response.Release()
+	}
+	r.ctx.Request.Release()
+	r.ctx.Release()
+}
+
+// observe records the latency of a request and updates the percentile delay.
+func (h *hedger) observe(latency time.Duration) {
+	if h.config.Percentile <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgeSamples {
+		h.samples = append(h.samples, latency)
+	} else {
+		h.samples[h.next] = latency
+		h.next = (h.next + 1) % hedgeSamples
+	}
+	h.count++
+	if h.count < h.config.MinSamples || h.count != h.config.MinSamples && h.count%hedgeUpdateEvery != 0 {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), h.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted)-1) * h.config.Percentile / 100)
+	h.delay.Store(int64(sorted[i]))
+}
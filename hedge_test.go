@@ -0,0 +1,123 @@
+package fastreq
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_MiddlewareHedge(t *testing.T) {
+	var calls atomic.Int64
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			// every first request of a pair is slow
+			if calls.Add(1)%2 == 1 {
+				time.Sleep(300 * time.Millisecond)
+			}
+			ctx.SetBodyString(string(ctx.Host()))
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	client.UseMiddleware("hedge", MiddlewareHedge(&HedgeConfig{
+		Delay: 20 * time.Millisecond,
+		Hosts: []string{"alt.fasthttp.great"},
+	}))
+
+	start := time.Now()
+	resp, err := client.Get("http://make.fasthttp.great/", NewIdempotent())
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 250*time.Millisecond)
+	require.Equal(t, "alt.fasthttp.great", string(resp.Body()))
+	attempt, _ := ValueOf[int](resp, ValueHedge)
+	require.Equal(t, 1, attempt)
+	require.Equal(t, "make.fasthttp.great", string(resp.Request.Host()))
+	resp.Release()
+
+	// the losing attempt is finished in the background
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+
+	// requests which are not marked as idempotent are not hedged
+	calls.Store(0)
+	start = time.Now()
+	resp, err = client.Get("http://make.fasthttp.great/")
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+	require.Equal(t, "make.fasthttp.great", string(resp.Body()))
+	require.Nil(t, resp.Value(ValueHedge))
+	resp.Release()
+	require.Equal(t, int64(1), calls.Load())
+}
+
+func Test_MiddlewareHedge_Error(t *testing.T) {
+	var dials atomic.Int64
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		dials.Add(1)
+		return nil, fasthttp.ErrDialTimeout
+	}
+	client.UseMiddleware("hedge", MiddlewareHedge(&HedgeConfig{Delay: time.Second, MaxHedges: 2}))
+
+	// failed attempts are hedged right away, the last error is returned
+	start := time.Now()
+	_, err := client.Get("http://make.fasthttp.great/", NewIdempotent())
+	require.ErrorIs(t, err, fasthttp.ErrDialTimeout)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int64(3), dials.Load())
+}
+
+func Test_MiddlewareHedge_Warmup(t *testing.T) {
+	var calls atomic.Int64
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go func() {
+		_ = fasthttp.Serve(ln, func(ctx *fasthttp.RequestCtx) {
+			calls.Add(1)
+			time.Sleep(50 * time.Millisecond)
+		})
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	client.UseMiddleware("hedge", MiddlewareHedge(&HedgeConfig{Percentile: 95}))
+
+	// without latencies, the requests are not hedged before the default delay
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("http://make.fasthttp.great/", NewIdempotent())
+		require.NoError(t, err)
+		attempt, _ := ValueOf[int](resp, ValueHedge)
+		require.Equal(t, 0, attempt)
+		resp.Release()
+	}
+	require.Equal(t, int64(3), calls.Load())
+}
+
+func Test_Hedger_Percentile(t *testing.T) {
+	h := &hedger{config: HedgeConfig{Delay: time.Second, Percentile: 90, MinSamples: 10}}
+	h.delay.Store(int64(time.Second))
+
+	for i := 1; i < 10; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	require.Equal(t, time.Second, time.Duration(h.delay.Load()))
+
+	h.observe(10 * time.Millisecond)
+	require.Equal(t, 9*time.Millisecond, time.Duration(h.delay.Load()))
+}
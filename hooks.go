@@ -0,0 +1,158 @@
+package fastreq
+
+// RequestHook is called once the request has been fully built and is about to
+// be sent. Returning an error aborts the request.
+type RequestHook func(ctx *Ctx) error
+
+// ResponseHook is called after a response has been received. Returning an error
+// makes the request fail, which allows hooks to validate responses.
+type ResponseHook func(ctx *Ctx) error
+
+// ErrorHook is called when a request fails with err.
+type ErrorHook func(ctx *Ctx, err error)
+
+// RetryHook is called before fasthttp retries a failed idempotent request.
+// attempt starts at 1 for the first retry.
+type RetryHook func(ctx *Ctx, attempt int)
+
+// Hooks holds lightweight callbacks invoked at fixed points of a request's
+// lifecycle. Hooks of the same kind are called in the order they were registered,
+// the Client's hooks always run before the hooks of a single request.
+//
+// A Hooks created by NewHooks can be passed to a request as a ReqOption.
+type Hooks struct {
+	onRequest      []RequestHook
+	onResponse     []ResponseHook
+	onError        []ErrorHook
+	onRetry        []RetryHook
+	notAutoRelease bool
+}
+
+// NewHooks creates a new Hooks object that can be used as a ReqOption.
+func NewHooks() *Hooks {
+	return &Hooks{}
+}
+
+// OnRequest registers hooks that are called when the request is built.
+func (h *Hooks) OnRequest(hooks ...RequestHook) *Hooks {
+	h.onRequest = append(h.onRequest, hooks...)
+	return h
+}
+
+// OnResponse registers hooks that are called when a response is received.
+func (h *Hooks) OnResponse(hooks ...ResponseHook) *Hooks {
+	h.onResponse = append(h.onResponse, hooks...)
+	return h
+}
+
+// OnError registers hooks that are called when the request fails.
+func (h *Hooks) OnError(hooks ...ErrorHook) *Hooks {
+	h.onError = append(h.onError, hooks...)
+	return h
+}
+
+// OnRetry registers hooks that are called before the request is retried.
+func (h *Hooks) OnRetry(hooks ...RetryHook) *Hooks {
+	h.onRetry = append(h.onRetry, hooks...)
+	return h
+}
+
+// BindRequest appends the hooks to the hooks of the given request.
+func (h *Hooks) BindRequest(req *Request) error {
+	if req.hooks == nil {
+		req.hooks = &Hooks{}
+	}
+	req.hooks.merge(h)
+	return nil
+}
+
+// Release frees the resources held by Hooks
+func (h *Hooks) Release() {
+	h.reset()
+	h.notAutoRelease = false
+}
+
+// AutoRelease sets whether Hooks should be automatically released when the
+// associated object is destroyed.
+func (h *Hooks) AutoRelease(auto bool) {
+	h.notAutoRelease = !auto
+}
+
+// isAutoRelease returns true if the Hooks instance is set to auto-release.
+func (h *Hooks) isAutoRelease() bool {
+	return !h.notAutoRelease
+}
+
+// merge appends all hooks of o to h.
+func (h *Hooks) merge(o *Hooks) {
+	h.onRequest = append(h.onRequest, o.onRequest...)
+	h.onResponse = append(h.onResponse, o.onResponse...)
+	h.onError = append(h.onError, o.onError...)
+	h.onRetry = append(h.onRetry, o.onRetry...)
+}
+
+// reset drops all registered hooks while keeping the allocated slices.
+func (h *Hooks) reset() {
+	h.onRequest = h.onRequest[:0]
+	h.onResponse = h.onResponse[:0]
+	h.onError = h.onError[:0]
+	h.onRetry = h.onRetry[:0]
+}
+
+// runRequestHooks calls the request hooks of the client and of the request.
+func runRequestHooks(ctx *Ctx) error {
+	for _, hook := range ctx.client.hooks.onRequest {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+	if ctx.Request.hooks != nil {
+		for _, hook := range ctx.Request.hooks.onRequest {
+			if err := hook(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runResponseHooks calls the response hooks of the client and of the request.
+func runResponseHooks(ctx *Ctx) error {
+	for _, hook := range ctx.client.hooks.onResponse {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+	if ctx.Request.hooks != nil {
+		for _, hook := range ctx.Request.hooks.onResponse {
+			if err := hook(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runErrorHooks calls the error hooks of the client and of the request.
+func runErrorHooks(ctx *Ctx, err error) {
+	for _, hook := range ctx.client.hooks.onError {
+		hook(ctx, err)
+	}
+	if ctx.Request.hooks != nil {
+		for _, hook := range ctx.Request.hooks.onError {
+			hook(ctx, err)
+		}
+	}
+}
+
+// runRetryHooks calls the retry hooks of the client and of the request.
+func runRetryHooks(ctx *Ctx, attempt int) {
+	for _, hook := range ctx.client.hooks.onRetry {
+		hook(ctx, attempt)
+	}
+	if ctx.Request.hooks != nil {
+		for _, hook := range ctx.Request.hooks.onRetry {
+			hook(ctx, attempt)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package fastreq
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_Hooks_Order(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			require.Equal(t, "client,request", string(ctx.Request.Header.Peek("X-Hooks")))
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	var calls []string
+	client.Hooks().
+		OnRequest(func(ctx *Ctx) error {
+			calls = append(calls, "client request")
+			ctx.Request.SetHeader("X-Hooks", "client")
+			return nil
+		}).
+		OnResponse(func(ctx *Ctx) error {
+			calls = append(calls, "client response")
+			return nil
+		})
+
+	hooks := NewHooks().
+		OnRequest(func(ctx *Ctx) error {
+			calls = append(calls, "request request")
+			ctx.Request.SetHeader("X-Hooks", string(ctx.Request.Header.Peek("X-Hooks"))+",request")
+			return nil
+		}).
+		OnResponse(func(ctx *Ctx) error {
+			calls = append(calls, "request response")
+			require.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+			return nil
+		})
+
+	resp, err := client.Get("http://make.fasthttp.great", hooks)
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Equal(t, []string{"client request", "request request", "client response", "request response"}, calls)
+}
+
+func Test_Hooks_Response_Validation(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	errStatus := errors.New("unexpected status code")
+	var hookErr error
+	client.Hooks().OnError(func(ctx *Ctx, err error) {
+		hookErr = err
+	})
+
+	hooks := NewHooks().OnResponse(func(ctx *Ctx) error {
+		if ctx.Response.StatusCode() != fasthttp.StatusOK {
+			return errStatus
+		}
+		return nil
+	})
+
+	resp, err := client.Get("http://make.fasthttp.great", hooks)
+	require.ErrorIs(t, err, errStatus)
+	require.Nil(t, resp)
+	require.ErrorIs(t, hookErr, errStatus)
+}
+
+func Test_Hooks_Retry(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	dials := 0
+	client.Dial = func(addr string) (net.Conn, error) {
+		dials++
+		if dials <= 2 {
+			// the first connections are broken, so the request is retried
+			c1, c2 := net.Pipe()
+			_ = c2.Close()
+			return c1, nil
+		}
+		return ln.Dial()
+	}
+
+	var attempts []int
+	client.Hooks().OnRetry(func(ctx *Ctx, attempt int) {
+		attempts = append(attempts, attempt)
+	})
+
+	resp, err := client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Equal(t, []int{1, 2}, attempts)
+}
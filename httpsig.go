@@ -0,0 +1,928 @@
+package fastreq
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HTTPSigAlgorithm is an algorithm of HTTP message signatures, see RFC 9421
+// section 3.3.
+type HTTPSigAlgorithm string
+
+const (
+	HTTPSigHMACSHA256      HTTPSigAlgorithm = "hmac-sha256"
+	HTTPSigEd25519         HTTPSigAlgorithm = "ed25519"
+	HTTPSigECDSAP256SHA256 HTTPSigAlgorithm = "ecdsa-p256-sha256"
+	HTTPSigRSAPSSSHA512    HTTPSigAlgorithm = "rsa-pss-sha512"
+)
+
+// ErrHTTPSignature is returned, wrapped with the reason, for messages without
+// valid signature.
+var ErrHTTPSignature = errors.New("fastreq: invalid HTTP message signature")
+
+// HTTPSigner signs requests with HTTP message signatures, see RFC 9421.
+type HTTPSigner struct {
+	// Label of the signature, "sig1" if empty.
+	Label     string
+	KeyID     string
+	Algorithm HTTPSigAlgorithm
+	// Key is the secret of HMAC-SHA256 as []byte, or an ed25519.PrivateKey,
+	// *ecdsa.PrivateKey or *rsa.PrivateKey.
+	Key crypto.PrivateKey
+	// Components are the covered components, like "@method", "@authority",
+	// `@query-param;name="id"` or lower case header names. The Content-Digest
+	// header is set from the body if "content-digest" is covered. If empty,
+	// "@method" and "@target-uri" are covered.
+	Components []string
+	// IncludeAlg adds the algorithm as alg parameter.
+	IncludeAlg bool
+	// Expires adds the expires parameter, the given duration after creation.
+	Expires time.Duration
+	// Nonce adds a random nonce parameter.
+	Nonce bool
+	// Tag is the tag parameter of the application, left out if empty.
+	Tag string
+}
+
+// MiddlewareHTTPSignature generates a middleware function that signs the
+// requests with HTTP message signatures. The middleware should be the last one
+// which changes the requests.
+func MiddlewareHTTPSignature(s *HTTPSigner) Middleware {
+	return func(ctx *Ctx) error {
+		if err := s.Sign(ctx.Request, time.Now()); err != nil {
+			return err
+		}
+		return ctx.Next()
+	}
+}
+
+// Sign sets the Signature-Input and Signature headers of req, signed at the
+// given time. Signatures of req set before are replaced.
+func (s *HTTPSigner) Sign(req *Request, t time.Time) error {
+	names := s.Components
+	if len(names) == 0 {
+		names = []string{"@method", "@target-uri"}
+	}
+	components := make([]httpSigComponent, len(names))
+	for i, name := range names {
+		c, err := parseHTTPSigComponent(name)
+		if err != nil {
+			return err
+		}
+		components[i] = c
+		if c.name == "content-digest" && len(req.Header.Peek("Content-Digest")) == 0 {
+			req.Header.Set("Content-Digest", contentDigest(req.Body()))
+		}
+	}
+
+	var params strings.Builder
+	params.WriteByte('(')
+	for i, c := range components {
+		if i > 0 {
+			params.WriteByte(' ')
+		}
+		params.WriteString(c.String())
+	}
+	fmt.Fprintf(&params, ");created=%d", t.Unix())
+	if s.Expires > 0 {
+		fmt.Fprintf(&params, ";expires=%d", t.Add(s.Expires).Unix())
+	}
+	if s.Nonce {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		fmt.Fprintf(&params, ";nonce=%s", quoteString(base64.RawURLEncoding.EncodeToString(b)))
+	}
+	if s.IncludeAlg {
+		fmt.Fprintf(&params, ";alg=%s", quoteString(string(s.Algorithm)))
+	}
+	if s.KeyID != "" {
+		fmt.Fprintf(&params, ";keyid=%s", quoteString(s.KeyID))
+	}
+	if s.Tag != "" {
+		fmt.Fprintf(&params, ";tag=%s", quoteString(s.Tag))
+	}
+
+	base, err := httpSigMessage{req: req.Request}.base(components, params.String())
+	if err != nil {
+		return err
+	}
+	signature, err := httpSigSign(s.Algorithm, s.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+
+	label := s.Label
+	if label == "" {
+		label = "sig1"
+	}
+	req.Header.Set("Signature-Input", label+"="+params.String())
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
+
+// HTTPSigVerifier verifies HTTP message signatures, see RFC 9421.
+type HTTPSigVerifier struct {
+	// Label of the signature to verify. If empty, the first signature is verified.
+	Label string
+	// Key returns the algorithm and the key for the keyid of a signature. The
+	// key is the secret of HMAC-SHA256 as []byte, or an ed25519.PublicKey,
+	// *ecdsa.PublicKey or *rsa.PublicKey.
+	Key func(keyID string) (HTTPSigAlgorithm, crypto.PublicKey, error)
+	// Required are the components the signature must cover, in the form of
+	// HTTPSigner.Components.
+	Required []string
+	// MaxAge rejects signatures created longer ago. 0 does not check the
+	// creation time.
+	MaxAge time.Duration
+}
+
+// MiddlewareVerifyHTTPSignature generates a middleware function that verifies
+// the signatures of the responses. Responses without valid signature are
+// released, and an error wrapping ErrHTTPSignature is returned instead.
+func MiddlewareVerifyHTTPSignature(v *HTTPSigVerifier) Middleware {
+	return func(ctx *Ctx) error {
+		if err := ctx.Next(); err != nil {
+			return err
+		}
+		return v.verify(httpSigMessage{req: ctx.Request.Request, resp: ctx.Response.Response}, time.Now())
+	}
+}
+
+// VerifyRequest verifies the signature of a request.
+func (v *HTTPSigVerifier) VerifyRequest(req *fasthttp.Request) error {
+	return v.verify(httpSigMessage{req: req}, time.Now())
+}
+
+// VerifyResponse verifies the signature of a response. Components of the
+// request are taken from resp.Request.
+func (v *HTTPSigVerifier) VerifyResponse(resp *Response) error {
+	return v.verify(httpSigMessage{req: resp.Request, resp: resp.Response}, time.Now())
+}
+
+func (v *HTTPSigVerifier) verify(m httpSigMessage, now time.Time) error {
+	inputs, err := parseHTTPSigInputs(string(bytes.Join(m.header("Signature-Input"), []byte(", "))))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHTTPSignature, err)
+	}
+	signatures, err := parseSFByteSequences(string(bytes.Join(m.header("Signature"), []byte(", "))))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHTTPSignature, err)
+	}
+
+	var in *httpSigInput
+	for _, input := range inputs {
+		if v.Label == "" || input.label == v.Label {
+			in = input
+			break
+		}
+	}
+	if in == nil {
+		return fmt.Errorf("%w: no signature", ErrHTTPSignature)
+	}
+	signature, ok := signatures[in.label]
+	if !ok {
+		return fmt.Errorf("%w: no value of signature %q", ErrHTTPSignature, in.label)
+	}
+
+	covered := make(map[string]bool, len(in.components))
+	for _, c := range in.components {
+		covered[c.String()] = true
+	}
+	for _, name := range v.Required {
+		c, err := parseHTTPSigComponent(name)
+		if err != nil {
+			return err
+		}
+		if !covered[c.String()] {
+			return fmt.Errorf("%w: component %s is not covered", ErrHTTPSignature, c)
+		}
+	}
+
+	if created, ok := sfParamValue(in.params, "created"); ok {
+		sec, err := strconv.ParseInt(created, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid created %q", ErrHTTPSignature, created)
+		}
+		if v.MaxAge > 0 && now.Sub(time.Unix(sec, 0)) > v.MaxAge {
+			return fmt.Errorf("%w: created too long ago", ErrHTTPSignature)
+		}
+	} else if v.MaxAge > 0 {
+		return fmt.Errorf("%w: no created parameter", ErrHTTPSignature)
+	}
+	if expires, ok := sfParamValue(in.params, "expires"); ok {
+		sec, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: invalid expires %q", ErrHTTPSignature, expires)
+		}
+		if now.After(time.Unix(sec, 0)) {
+			return fmt.Errorf("%w: expired", ErrHTTPSignature)
+		}
+	}
+
+	if v.Key == nil {
+		return errors.New("fastreq: HTTPSigVerifier without Key")
+	}
+	keyID, _ := sfParamValue(in.params, "keyid")
+	alg, key, err := v.Key(keyID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHTTPSignature, err)
+	}
+	if a, ok := sfParamValue(in.params, "alg"); ok && a != string(alg) {
+		return fmt.Errorf("%w: algorithm %q instead of %q", ErrHTTPSignature, a, alg)
+	}
+
+	base, err := m.base(in.components, in.raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHTTPSignature, err)
+	}
+	if err := httpSigVerify(alg, key, []byte(base), signature); err != nil {
+		return err
+	}
+
+	if covered[`"content-digest"`] {
+		body := m.req.Body()
+		if m.resp != nil {
+			body = m.resp.Body()
+		}
+		return verifyContentDigest(string(bytes.Join(m.header("Content-Digest"), []byte(", "))), body)
+	}
+	return nil
+}
+
+// httpSigSign signs the signature base with the key.
+func httpSigSign(alg HTTPSigAlgorithm, key crypto.PrivateKey, base []byte) ([]byte, error) {
+	switch alg {
+	case HTTPSigHMACSHA256:
+		if k, ok := key.([]byte); ok {
+			h := hmac.New(sha256.New, k)
+			h.Write(base)
+			return h.Sum(nil), nil
+		}
+	case HTTPSigEd25519:
+		if k, ok := key.(ed25519.PrivateKey); ok {
+			return ed25519.Sign(k, base), nil
+		}
+	case HTTPSigECDSAP256SHA256:
+		if k, ok := key.(*ecdsa.PrivateKey); ok && k.Curve == elliptic.P256() {
+			digest := sha256.Sum256(base)
+			r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+			if err != nil {
+				return nil, err
+			}
+			// the signature is r and s as fixed size integers
+			signature := make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+			return signature, nil
+		}
+	case HTTPSigRSAPSSSHA512:
+		if k, ok := key.(*rsa.PrivateKey); ok {
+			digest := sha512.Sum512(base)
+			return rsa.SignPSS(rand.Reader, k, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: 64})
+		}
+	default:
+		return nil, fmt.Errorf("fastreq: unsupported HTTP signature algorithm %q", alg)
+	}
+	return nil, fmt.Errorf("fastreq: key of type %T does not fit HTTP signature algorithm %q", key, alg)
+}
+
+// httpSigVerify verifies the signature of the signature base with the key.
+func httpSigVerify(alg HTTPSigAlgorithm, key crypto.PublicKey, base, signature []byte) error {
+	var fits, valid bool
+	switch alg {
+	case HTTPSigHMACSHA256:
+		if k, ok := key.([]byte); ok {
+			h := hmac.New(sha256.New, k)
+			h.Write(base)
+			fits, valid = true, hmac.Equal(h.Sum(nil), signature)
+		}
+	case HTTPSigEd25519:
+		if k, ok := key.(ed25519.PublicKey); ok {
+			fits, valid = true, ed25519.Verify(k, base, signature)
+		}
+	case HTTPSigECDSAP256SHA256:
+		if k, ok := key.(*ecdsa.PublicKey); ok && k.Curve == elliptic.P256() {
+			digest := sha256.Sum256(base)
+			fits, valid = true, len(signature) == 64 && ecdsa.Verify(k, digest[:],
+				new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:]))
+		}
+	case HTTPSigRSAPSSSHA512:
+		if k, ok := key.(*rsa.PublicKey); ok {
+			digest := sha512.Sum512(base)
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}
+			fits, valid = true, rsa.VerifyPSS(k, crypto.SHA512, digest[:], signature, opts) == nil
+		}
+	default:
+		return fmt.Errorf("fastreq: unsupported HTTP signature algorithm %q", alg)
+	}
+	if !fits {
+		return fmt.Errorf("fastreq: key of type %T does not fit HTTP signature algorithm %q", key, alg)
+	}
+	if !valid {
+		return fmt.Errorf("%w: signature mismatch", ErrHTTPSignature)
+	}
+	return nil
+}
+
+// contentDigest returns the Content-Digest header of a body, see RFC 9530.
+func contentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+// verifyContentDigest checks the sha-256 and sha-512 digests of a
+// Content-Digest header against the body.
+func verifyContentDigest(header string, body []byte) error {
+	digests, err := parseSFByteSequences(header)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHTTPSignature, err)
+	}
+	verified := false
+	for alg, digest := range digests {
+		var sum []byte
+		switch alg {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		if !bytes.Equal(sum, digest) {
+			return fmt.Errorf("%w: content digest mismatch", ErrHTTPSignature)
+		}
+		verified = true
+	}
+	if !verified {
+		return fmt.Errorf("%w: no supported content digest", ErrHTTPSignature)
+	}
+	return nil
+}
+
+// httpSigMessage is the signed message, a request, or a response with the
+// request it answers.
+type httpSigMessage struct {
+	req  *fasthttp.Request
+	resp *fasthttp.Response
+}
+
+// header returns the values of a header of the message.
+func (m httpSigMessage) header(name string) [][]byte {
+	if m.resp != nil {
+		return m.resp.Header.PeekAll(name)
+	}
+	return m.req.Header.PeekAll(name)
+}
+
+// base returns the signature base of the components, see RFC 9421 section 2.5.
+func (m httpSigMessage) base(components []httpSigComponent, params string) (string, error) {
+	var b strings.Builder
+	seen := make(map[string]bool, len(components))
+	for _, c := range components {
+		id := c.String()
+		if seen[id] {
+			return "", fmt.Errorf("fastreq: signature component %s is covered twice", id)
+		}
+		seen[id] = true
+
+		value, err := m.value(c)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(id)
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(params)
+	return b.String(), nil
+}
+
+// value returns the value of a component of the message.
+func (m httpSigMessage) value(c httpSigComponent) (string, error) {
+	fromRequest := m.resp == nil
+	var name *string
+	for i, p := range c.params {
+		switch p.key {
+		case "req":
+			if m.resp == nil {
+				return "", fmt.Errorf("fastreq: signature component %s of a request with req parameter", c)
+			}
+			fromRequest = true
+		case "name":
+			name = &c.params[i].value
+		default:
+			return "", fmt.Errorf("fastreq: unsupported parameter of signature component %s", c)
+		}
+	}
+	if fromRequest && m.req == nil {
+		return "", fmt.Errorf("fastreq: no request for signature component %s", c)
+	}
+
+	if c.name == "@status" {
+		if fromRequest {
+			return "", fmt.Errorf("fastreq: signature component %s of a request", c)
+		}
+		return strconv.Itoa(m.resp.StatusCode()), nil
+	}
+	if strings.HasPrefix(c.name, "@") {
+		if !fromRequest {
+			return "", fmt.Errorf("fastreq: signature component %s of a response without req parameter", c)
+		}
+		return httpSigDerived(m.req, c.name, name)
+	}
+
+	var values [][]byte
+	if fromRequest {
+		values = m.req.Header.PeekAll(c.name)
+	} else {
+		values = m.resp.Header.PeekAll(c.name)
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("fastreq: no header for signature component %s", c)
+	}
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = string(bytes.TrimSpace(v))
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// httpSigDerived returns the value of a derived component of a request, see
+// RFC 9421 section 2.2.
+func httpSigDerived(req *fasthttp.Request, component string, name *string) (string, error) {
+	u := req.URI()
+	requestURI := string(u.RequestURI())
+	path, query, _ := strings.Cut(requestURI, "?")
+
+	switch component {
+	case "@method":
+		return string(req.Header.Method()), nil
+	case "@target-uri":
+		return strings.ToLower(string(u.Scheme())) + "://" + string(u.Host()) + requestURI, nil
+	case "@authority":
+		return canonicalHost(u), nil
+	case "@scheme":
+		return strings.ToLower(string(u.Scheme())), nil
+	case "@request-target":
+		return requestURI, nil
+	case "@path":
+		return path, nil
+	case "@query":
+		return "?" + query, nil
+	case "@query-param":
+		if name == nil {
+			return "", errors.New("fastreq: signature component @query-param without name")
+		}
+		var values []string
+		u.QueryArgs().VisitAll(func(key, value []byte) {
+			if string(key) == *name {
+				values = append(values, escapeRFC3986(string(value)))
+			}
+		})
+		if len(values) != 1 {
+			return "", fmt.Errorf("fastreq: query parameter %q for signature found %d times", *name, len(values))
+		}
+		return values[0], nil
+	}
+	return "", fmt.Errorf("fastreq: unsupported signature component %q", component)
+}
+
+// httpSigComponent is a component identifier, see RFC 9421 section 2.
+type httpSigComponent struct {
+	name   string
+	params []sfParam
+}
+
+// String returns the serialized component identifier.
+func (c httpSigComponent) String() string {
+	var b strings.Builder
+	b.WriteString(quoteString(c.name))
+	for _, p := range c.params {
+		b.WriteByte(';')
+		b.WriteString(p.key)
+		switch {
+		case p.quoted:
+			b.WriteByte('=')
+			b.WriteString(quoteString(p.value))
+		case p.value != "":
+			b.WriteByte('=')
+			b.WriteString(p.value)
+		}
+	}
+	return b.String()
+}
+
+// parseHTTPSigComponent parses a component identifier, whose name may be
+// unquoted.
+func parseHTTPSigComponent(s string) (httpSigComponent, error) {
+	if !strings.HasPrefix(s, `"`) {
+		name, params, _ := strings.Cut(s, ";")
+		s = quoteString(name)
+		if params != "" {
+			s += ";" + params
+		}
+	}
+	p := &sfParser{s: s}
+	c, err := p.component()
+	if err == nil && !p.eof() {
+		err = p.err()
+	}
+	return c, err
+}
+
+// httpSigInput is a signature of a Signature-Input header.
+type httpSigInput struct {
+	label      string
+	components []httpSigComponent
+	params     []sfParam
+	// raw are the signature parameters as received
+	raw string
+}
+
+// parseHTTPSigInputs parses a Signature-Input header.
+func parseHTTPSigInputs(header string) ([]*httpSigInput, error) {
+	var inputs []*httpSigInput
+	p := &sfParser{s: header}
+	for {
+		p.skip(" \t")
+		if p.eof() {
+			return inputs, nil
+		}
+		label, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != '=' {
+			return nil, p.err()
+		}
+		p.i++
+		start := p.i
+		if p.peek() != '(' {
+			return nil, p.err()
+		}
+		p.i++
+
+		in := &httpSigInput{label: label}
+		for {
+			p.skip(" ")
+			if p.peek() == ')' {
+				p.i++
+				break
+			}
+			c, err := p.component()
+			if err != nil {
+				return nil, err
+			}
+			in.components = append(in.components, c)
+		}
+		if in.params, err = p.params(); err != nil {
+			return nil, err
+		}
+		in.raw = header[start:p.i]
+		inputs = append(inputs, in)
+
+		p.skip(" \t")
+		if !p.eof() && p.peek() != ',' {
+			return nil, p.err()
+		}
+		p.i++
+	}
+}
+
+// parseSFByteSequences parses a dictionary of byte sequences, like a Signature
+// or Content-Digest header. Parameters of the members are ignored.
+func parseSFByteSequences(header string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	p := &sfParser{s: header}
+	for {
+		p.skip(" \t")
+		if p.eof() {
+			return values, nil
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != '=' {
+			return nil, p.err()
+		}
+		p.i++
+		if p.peek() != ':' {
+			return nil, p.err()
+		}
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end < 0 {
+			return nil, p.err()
+		}
+		value, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+		if err != nil {
+			return nil, p.err()
+		}
+		values[key] = value
+		p.i += end + 2
+		if _, err := p.params(); err != nil {
+			return nil, err
+		}
+
+		p.skip(" \t")
+		if !p.eof() && p.peek() != ',' {
+			return nil, p.err()
+		}
+		p.i++
+	}
+}
+
+// sfParam is a parameter of a structured field, see RFC 8941. Boolean true
+// parameters have an empty value.
+type sfParam struct {
+	key    string
+	value  string
+	quoted bool
+}
+
+// sfParamValue returns the value of the parameter with the given key.
+func sfParamValue(params []sfParam, key string) (string, bool) {
+	for _, p := range params {
+		if p.key == key {
+			return p.value, true
+		}
+	}
+	return "", false
+}
+
+// sfParser parses the parts of structured fields used by HTTP message
+// signatures, see RFC 8941.
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) skip(chars string) {
+	for !p.eof() && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *sfParser) err() error {
+	return fmt.Errorf("fastreq: invalid structured field %q", p.s)
+}
+
+// key parses a dictionary or parameter key.
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	for !p.eof() {
+		c := p.s[p.i]
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.' || c == '*') {
+			break
+		}
+		p.i++
+	}
+	if p.i == start {
+		return "", p.err()
+	}
+	return p.s[start:p.i], nil
+}
+
+// quoted parses a string.
+func (p *sfParser) quoted() (string, error) {
+	if p.peek() != '"' {
+		return "", p.err()
+	}
+	p.i++
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.i]
+		p.i++
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.err()
+			}
+			b.WriteByte(p.s[p.i])
+			p.i++
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.err()
+}
+
+// params parses the parameters of an item.
+func (p *sfParser) params() ([]sfParam, error) {
+	var params []sfParam
+	for p.peek() == ';' {
+		p.i++
+		p.skip(" ")
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		param := sfParam{key: key}
+		if p.peek() == '=' {
+			p.i++
+			if p.peek() == '"' {
+				param.quoted = true
+				if param.value, err = p.quoted(); err != nil {
+					return nil, err
+				}
+			} else {
+				// tokens, integers and booleans are kept as written
+				start := p.i
+				for !p.eof() && strings.IndexByte(" \t;,()=\"", p.s[p.i]) < 0 {
+					p.i++
+				}
+				if p.i == start {
+					return nil, p.err()
+				}
+				if param.value = p.s[start:p.i]; param.value == "?1" {
+					param.value = ""
+				}
+			}
+		}
+		params = append(params, param)
+	}
+	return params, nil
+}
+
+// component parses a component identifier.
+func (p *sfParser) component() (httpSigComponent, error) {
+	name, err := p.quoted()
+	if err != nil {
+		return httpSigComponent{}, err
+	}
+	params, err := p.params()
+	return httpSigComponent{name: name, params: params}, err
+}
+
+// HMACSigner signs requests with an HMAC over a canonical string, for APIs with
+// signature schemes of their own.
+type HMACSigner struct {
+	Key []byte
+	// Hash is the hash function of the HMAC, sha256.New if nil.
+	Hash func() hash.Hash
+	// Components are the parts of the canonical string: "method", "host",
+	// "path", "query" with sorted parameters, "body", "body-hash" as hex hash
+	// with Hash, "timestamp", "nonce" and "header:<name>". Other values are
+	// used literally.
+	Components []string
+	// Separator joins the components, "\n" if empty.
+	Separator string
+	// Canonical builds the canonical string instead of Components.
+	Canonical func(req *Request, timestamp, nonce string) (string, error)
+	// Header is the request header of the signature, "X-Signature" if empty.
+	Header string
+	// Prefix is written in front of the signature, like "HMAC ".
+	Prefix string
+	// Base64 encodes the signature with base64 instead of lower case hex.
+	Base64 bool
+	// TimestampHeader sends the Unix time of the signature in the header.
+	TimestampHeader string
+	// NonceHeader sends a random nonce in the header.
+	NonceHeader string
+}
+
+// MiddlewareHMAC generates a middleware function that signs the requests with
+// an HMACSigner. The middleware should be the last one which changes the
+// requests.
+func MiddlewareHMAC(s *HMACSigner) Middleware {
+	return func(ctx *Ctx) error {
+		if err := s.Sign(ctx.Request, time.Now()); err != nil {
+			return err
+		}
+		return ctx.Next()
+	}
+}
+
+// Sign sets the signature header of req, signed at the given time.
+func (s *HMACSigner) Sign(req *Request, t time.Time) error {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	if s.TimestampHeader != "" {
+		req.Header.Set(s.TimestampHeader, timestamp)
+	}
+	if s.NonceHeader != "" {
+		req.Header.Set(s.NonceHeader, nonce)
+	}
+
+	var canonical string
+	if s.Canonical != nil {
+		var err error
+		if canonical, err = s.Canonical(req, timestamp, nonce); err != nil {
+			return err
+		}
+	} else {
+		canonical = s.canonical(req, timestamp, nonce)
+	}
+
+	newHash := s.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	h := hmac.New(newHash, s.Key)
+	h.Write([]byte(canonical))
+	var signature string
+	if s.Base64 {
+		signature = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	} else {
+		signature = hex.EncodeToString(h.Sum(nil))
+	}
+
+	header := s.Header
+	if header == "" {
+		header = "X-Signature"
+	}
+	req.Header.Set(header, s.Prefix+signature)
+	return nil
+}
+
+// canonical returns the canonical string of req built from the Components.
+func (s *HMACSigner) canonical(req *Request, timestamp, nonce string) string {
+	parts := make([]string, len(s.Components))
+	for i, c := range s.Components {
+		switch c {
+		case "method":
+			parts[i] = string(req.Header.Method())
+		case "host":
+			parts[i] = canonicalHost(req.URI())
+		case "path":
+			path, _, _ := strings.Cut(string(req.URI().RequestURI()), "?")
+			parts[i] = path
+		case "query":
+			var params []string
+			req.URI().QueryArgs().VisitAll(func(key, value []byte) {
+				params = append(params, escapeRFC3986(string(key))+"="+escapeRFC3986(string(value)))
+			})
+			sort.Strings(params)
+			parts[i] = strings.Join(params, "&")
+		case "body":
+			parts[i] = string(req.Body())
+		case "body-hash":
+			newHash := s.Hash
+			if newHash == nil {
+				newHash = sha256.New
+			}
+			h := newHash()
+			h.Write(req.Body())
+			parts[i] = hex.EncodeToString(h.Sum(nil))
+		case "timestamp":
+			parts[i] = timestamp
+		case "nonce":
+			parts[i] = nonce
+		default:
+			if name, ok := strings.CutPrefix(c, "header:"); ok {
+				parts[i] = string(req.Header.Peek(name))
+			} else {
+				parts[i] = c
+			}
+		}
+	}
+
+	separator := s.Separator
+	if separator == "" {
+		separator = "\n"
+	}
+	return strings.Join(parts, separator)
+}
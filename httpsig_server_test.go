@@ -0,0 +1,109 @@
+package fastreq_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"github.com/wnanbei/fastreq/fastreqtest"
+)
+
+func Test_MiddlewareHTTPSignature(t *testing.T) {
+	secret := []byte("secret")
+	verifier := &fastreq.HTTPSigVerifier{
+		Key: func(keyID string) (fastreq.HTTPSigAlgorithm, crypto.PublicKey, error) {
+			if keyID != "client" {
+				return "", nil, errors.New("unknown key")
+			}
+			return fastreq.HTTPSigHMACSHA256, secret, nil
+		},
+		Required: []string{"@method", "@target-uri", "content-digest"},
+	}
+
+	handle := func(ctx *fasthttp.RequestCtx) {
+		if err := verifier.VerifyRequest(&ctx.Request); err != nil {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+			return
+		}
+
+		// the response signature covers the status, its body and the request
+		ctx.SetBodyString("signed")
+		ctx.Response.Header.Set("Content-Digest", fastreq.ContentDigest(ctx.Response.Body()))
+		if string(ctx.Path()) == "/tampered" {
+			ctx.SetBodyString("tampered")
+		}
+		require.NoError(t, fastreq.SignHTTPResponse(&ctx.Request, &ctx.Response,
+			[]string{"@status", "content-digest", `"@method";req`, `"@target-uri";req`},
+			`("@status" "content-digest" "@method";req "@target-uri";req);created=1;keyid="server"`,
+			fastreq.HTTPSigHMACSHA256, secret))
+	}
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/ok").WithQuery("a", "1").Once().Handle(handle)
+	srv.On(fastreq.POST, "/upload").Once().Handle(handle)
+	srv.On(fastreq.POST, "/tampered").Once().Handle(handle)
+
+	client := srv.Client()
+	client.SetHTTPSignature(&fastreq.HTTPSigner{
+		KeyID:      "client",
+		Algorithm:  fastreq.HTTPSigHMACSHA256,
+		Key:        secret,
+		Components: []string{"@method", "@target-uri", "content-digest"},
+	})
+	responses := &fastreq.HTTPSigVerifier{
+		Key: func(keyID string) (fastreq.HTTPSigAlgorithm, crypto.PublicKey, error) {
+			require.Equal(t, "server", keyID)
+			return fastreq.HTTPSigHMACSHA256, secret, nil
+		},
+		Required: []string{"@status", "content-digest", `"@method";req`},
+	}
+	client.AddMiddleware(fastreq.MiddlewareVerifyHTTPSignature(responses))
+
+	resp, err := client.Post("http://make.fasthttp.great/ok?a=1", fastreq.NewBody([]byte("body")))
+	require.NoError(t, err)
+	require.Equal(t, "signed", string(resp.Body()))
+	require.NoError(t, responses.VerifyResponse(resp))
+	resp.Release()
+
+	// the content digest covers the multipart body as it is sent
+	mf := fastreq.NewMultipartForm("fastreq", "foo", "bar")
+	mf.AddFile("txt", "file.txt", []byte("fastreq"))
+	resp, err = client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	resp.Release()
+
+	_, err = client.Post("http://make.fasthttp.great/tampered", fastreq.NewBody([]byte("body")))
+	require.ErrorIs(t, err, fastreq.ErrHTTPSignature)
+}
+
+func Test_MiddlewareHMAC_Multipart(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/upload").Once().Handle(func(ctx *fasthttp.RequestCtx) {
+		bodyHash := sha256.Sum256(ctx.PostBody())
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(hex.EncodeToString(bodyHash[:]) + "\n" + string(ctx.Request.Header.Peek("X-Timestamp"))))
+		if hex.EncodeToString(mac.Sum(nil)) != string(ctx.Request.Header.Peek("X-Signature")) {
+			ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+		}
+	})
+
+	client := srv.Client()
+	client.SetHMACSignature(&fastreq.HMACSigner{
+		Key:             []byte("secret"),
+		Components:      []string{"body-hash", "timestamp"},
+		TimestampHeader: "X-Timestamp",
+	})
+
+	mf := fastreq.NewMultipartForm("fastreq", "foo", "bar")
+	mf.AddFile("txt", "file.txt", []byte("fastreq"))
+	resp, err := client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	resp.Release()
+}
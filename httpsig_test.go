@@ -0,0 +1,299 @@
+package fastreq
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_HTTPSig_HMAC(t *testing.T) {
+	// RFC 9421 appendix B.2.5
+	secret, err := base64.StdEncoding.DecodeString(
+		"uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	require.NoError(t, err)
+
+	req := NewRequest(POST, "https://example.com/foo?param=Value&Pet=dog")
+	req.SetHeaders("Date", "Tue, 20 Apr 2021 02:07:55 GMT", "Content-Type", "application/json")
+	req.SetBodyString(`{"hello": "world"}`)
+
+	s := &HTTPSigner{
+		Label:      "sig-b25",
+		KeyID:      "test-shared-secret",
+		Algorithm:  HTTPSigHMACSHA256,
+		Key:        secret,
+		Components: []string{"date", "@authority", "content-type"},
+	}
+	require.NoError(t, s.Sign(req, time.Unix(1618884473, 0)))
+	require.Equal(t, `sig-b25=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`,
+		string(req.Header.Peek("Signature-Input")))
+	require.Equal(t, "sig-b25=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:", string(req.Header.Peek("Signature")))
+
+	v := &HTTPSigVerifier{
+		Key: func(keyID string) (HTTPSigAlgorithm, crypto.PublicKey, error) {
+			require.Equal(t, "test-shared-secret", keyID)
+			return HTTPSigHMACSHA256, secret, nil
+		},
+	}
+	require.NoError(t, v.VerifyRequest(req.Request))
+
+	req.Header.Set("Content-Type", "text/plain")
+	require.ErrorIs(t, v.VerifyRequest(req.Request), ErrHTTPSignature)
+}
+
+func Test_HTTPSig_Components(t *testing.T) {
+	// RFC 9421 section 2.2
+	req := NewRequest(POST, "https://www.Example.com:443/path?param=value&foo=bar&baz=bat%2Dman&var=this%20is%20a%20big%0Avalue")
+	req.SetHeaders("X-Value", " a ")
+	req.AddHeader("X-Value", "b")
+
+	var components []httpSigComponent
+	for _, name := range []string{"@method", "@target-uri", "@authority", "@scheme", "@request-target",
+		"@path", "@query", `@query-param;name="var"`, `"x-value"`} {
+		c, err := parseHTTPSigComponent(name)
+		require.NoError(t, err)
+		components = append(components, c)
+	}
+	base, err := httpSigMessage{req: req.Request}.base(components, `("@method");created=1`)
+	require.NoError(t, err)
+	require.Equal(t, `"@method": POST
+"@target-uri": https://www.example.com:443/path?param=value&foo=bar&baz=bat%2Dman&var=this%20is%20a%20big%0Avalue
+"@authority": www.example.com
+"@scheme": https
+"@request-target": /path?param=value&foo=bar&baz=bat%2Dman&var=this%20is%20a%20big%0Avalue
+"@path": /path
+"@query": ?param=value&foo=bar&baz=bat%2Dman&var=this%20is%20a%20big%0Avalue
+"@query-param";name="var": this%20is%20a%20big%0Avalue
+"x-value": a, b
+"@signature-params": ("@method");created=1`, base)
+
+	for _, name := range []string{"x-missing", "@status", `"@method";req`, "@query-param", `@query-param;name="none"`, "@unknown"} {
+		c, err := parseHTTPSigComponent(name)
+		require.NoError(t, err)
+		_, err = httpSigMessage{req: req.Request}.base([]httpSigComponent{c}, "()")
+		require.Error(t, err, name)
+	}
+	_, err = httpSigMessage{req: req.Request}.base(components[:1:1], "()")
+	require.NoError(t, err)
+	_, err = httpSigMessage{req: req.Request}.base(append(components[:1:1], components[0]), "()")
+	require.Error(t, err)
+}
+
+func Test_HTTPSig_Inputs(t *testing.T) {
+	inputs, err := parseHTTPSigInputs(`sig1=("@method" "@path";req "@query-param";name="a\"b");created=1;keyid="k", ` +
+		`sig2=();tag="x";alg="ed25519"`)
+	require.NoError(t, err)
+	require.Len(t, inputs, 2)
+	require.Equal(t, "sig1", inputs[0].label)
+	require.Equal(t, `("@method" "@path";req "@query-param";name="a\"b");created=1;keyid="k"`, inputs[0].raw)
+	require.Len(t, inputs[0].components, 3)
+	require.Equal(t, `"@path";req`, inputs[0].components[1].String())
+	require.Equal(t, `"@query-param";name="a\"b"`, inputs[0].components[2].String())
+	keyID, _ := sfParamValue(inputs[0].params, "keyid")
+	require.Equal(t, "k", keyID)
+	require.Equal(t, "sig2", inputs[1].label)
+	require.Empty(t, inputs[1].components)
+
+	for _, header := range []string{`sig1`, `sig1=("@method"`, `sig1=("@method") sig2=()`, `Sig1=()`, `sig1=(@method)`} {
+		_, err := parseHTTPSigInputs(header)
+		require.Error(t, err, header)
+	}
+
+	values, err := parseSFByteSequences("sha-256=:AAE=:;x, sha-512=:Ag==:")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"sha-256": {0, 1}, "sha-512": {2}}, values)
+	_, err = parseSFByteSequences("sha-256=:AAE=")
+	require.Error(t, err)
+}
+
+func Test_HTTPSig_Algorithms(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		alg     HTTPSigAlgorithm
+		private crypto.PrivateKey
+		public  crypto.PublicKey
+	}{
+		{HTTPSigHMACSHA256, []byte("secret"), []byte("secret")},
+		{HTTPSigEd25519, edPrivate, edPublic},
+		{HTTPSigECDSAP256SHA256, ecKey, &ecKey.PublicKey},
+		{HTTPSigRSAPSSSHA512, rsaKey, &rsaKey.PublicKey},
+	} {
+		req := NewRequest(POST, "https://example.com/foo?a=1")
+		req.SetBodyString(`{"hello": "world"}`)
+		s := &HTTPSigner{
+			KeyID:      "key",
+			Algorithm:  tc.alg,
+			Key:        tc.private,
+			Components: []string{"@method", "@target-uri", "content-digest"},
+			IncludeAlg: true,
+			Expires:    time.Minute,
+			Nonce:      true,
+			Tag:        "app",
+		}
+		require.NoError(t, s.Sign(req, time.Now()), tc.alg)
+		require.Equal(t, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", string(req.Header.Peek("Content-Digest")))
+
+		v := &HTTPSigVerifier{
+			Key: func(keyID string) (HTTPSigAlgorithm, crypto.PublicKey, error) {
+				return tc.alg, tc.public, nil
+			},
+			Required: []string{"@method", "content-digest"},
+			MaxAge:   time.Minute,
+		}
+		require.NoError(t, v.VerifyRequest(req.Request), tc.alg)
+
+		// the body is covered by the content digest
+		req.SetBodyString(`{"hello": "you"}`)
+		require.ErrorIs(t, v.VerifyRequest(req.Request), ErrHTTPSignature, tc.alg)
+		req.SetBodyString(`{"hello": "world"}`)
+
+		req.URI().SetPath("/bar")
+		require.ErrorIs(t, v.VerifyRequest(req.Request), ErrHTTPSignature, tc.alg)
+	}
+
+	// keys which do not fit the algorithm
+	s := &HTTPSigner{Algorithm: HTTPSigEd25519, Key: []byte("secret")}
+	require.Error(t, s.Sign(NewRequest(GET, "http://example.com"), time.Now()))
+	s = &HTTPSigner{Algorithm: "hmac-sha1", Key: []byte("secret")}
+	require.Error(t, s.Sign(NewRequest(GET, "http://example.com"), time.Now()))
+	s = &HTTPSigner{Algorithm: HTTPSigECDSAP256SHA256, Key: ecKey}
+	req := NewRequest(GET, "http://example.com")
+	require.NoError(t, s.Sign(req, time.Now()))
+	v := &HTTPSigVerifier{
+		Key: func(string) (HTTPSigAlgorithm, crypto.PublicKey, error) {
+			return HTTPSigECDSAP256SHA256, &rsaKey.PublicKey, nil
+		},
+	}
+	err = v.VerifyRequest(req.Request)
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrHTTPSignature))
+}
+
+func Test_HTTPSig_Verify(t *testing.T) {
+	secret := []byte("secret")
+	key := func(string) (HTTPSigAlgorithm, crypto.PublicKey, error) {
+		return HTTPSigHMACSHA256, secret, nil
+	}
+	sign := func(s *HTTPSigner, at time.Time) *Request {
+		req := NewRequest(GET, "http://example.com/foo")
+		s.Key = secret
+		s.Algorithm = HTTPSigHMACSHA256
+		require.NoError(t, s.Sign(req, at))
+		return req
+	}
+
+	// the signature of the label is verified
+	req := sign(&HTTPSigner{Label: "first"}, time.Now())
+	other := sign(&HTTPSigner{Label: "second", Components: []string{"@path"}}, time.Now())
+	req.Header.Add("Signature-Input", string(other.Header.Peek("Signature-Input")))
+	req.Header.Add("Signature", string(other.Header.Peek("Signature")))
+	require.NoError(t, (&HTTPSigVerifier{Key: key}).VerifyRequest(req.Request))
+	require.NoError(t, (&HTTPSigVerifier{Key: key, Label: "second", Required: []string{"@path"}}).VerifyRequest(req.Request))
+	require.ErrorIs(t, (&HTTPSigVerifier{Key: key, Label: "second", Required: []string{"@method"}}).VerifyRequest(req.Request), ErrHTTPSignature)
+	require.ErrorIs(t, (&HTTPSigVerifier{Key: key, Label: "third"}).VerifyRequest(req.Request), ErrHTTPSignature)
+
+	// the age of signatures
+	req = sign(&HTTPSigner{}, time.Now().Add(-time.Hour))
+	require.NoError(t, (&HTTPSigVerifier{Key: key}).VerifyRequest(req.Request))
+	require.ErrorIs(t, (&HTTPSigVerifier{Key: key, MaxAge: time.Minute}).VerifyRequest(req.Request), ErrHTTPSignature)
+	req = sign(&HTTPSigner{Expires: time.Minute}, time.Now().Add(-time.Hour))
+	require.ErrorIs(t, (&HTTPSigVerifier{Key: key}).VerifyRequest(req.Request), ErrHTTPSignature)
+
+	// the algorithm of the signature has to match the key
+	req = sign(&HTTPSigner{IncludeAlg: true}, time.Now())
+	require.NoError(t, (&HTTPSigVerifier{Key: key}).VerifyRequest(req.Request))
+	require.ErrorIs(t, (&HTTPSigVerifier{
+		Key: func(string) (HTTPSigAlgorithm, crypto.PublicKey, error) {
+			return HTTPSigEd25519, secret, nil
+		},
+	}).VerifyRequest(req.Request), ErrHTTPSignature)
+
+	require.ErrorIs(t, (&HTTPSigVerifier{Key: key}).VerifyRequest(NewRequest(GET, "http://example.com").Request), ErrHTTPSignature)
+
+	// errors of the key lookup are signature errors as well
+	err := (&HTTPSigVerifier{
+		Key: func(string) (HTTPSigAlgorithm, crypto.PublicKey, error) {
+			return "", nil, errors.New("unknown key")
+		},
+	}).VerifyRequest(req.Request)
+	require.ErrorIs(t, err, ErrHTTPSignature)
+	require.ErrorContains(t, err, "unknown key")
+}
+
+func Test_HMACSigner(t *testing.T) {
+	req := NewRequest(POST, "https://API.example.com/v1/orders?b=2&a=x%20y")
+	req.SetHeader("X-Account", "acc")
+	req.SetBodyString(`{"id":1}`)
+
+	s := &HMACSigner{
+		Key:             []byte("secret"),
+		Components:      []string{"method", "host", "path", "query", "body-hash", "timestamp", "nonce", "header:X-Account", "v1"},
+		TimestampHeader: "X-Timestamp",
+		NonceHeader:     "X-Nonce",
+	}
+	require.NoError(t, s.Sign(req, time.Unix(1700000000, 0)))
+	require.Equal(t, "1700000000", string(req.Header.Peek("X-Timestamp")))
+	nonce := string(req.Header.Peek("X-Nonce"))
+	require.Len(t, nonce, 32)
+
+	bodyHash := sha256.Sum256([]byte(`{"id":1}`))
+	canonical := "POST\napi.example.com\n/v1/orders\na=x%20y&b=2\n" + hex.EncodeToString(bodyHash[:]) +
+		"\n1700000000\n" + nonce + "\nacc\nv1"
+	require.Equal(t, canonical, s.canonical(req, "1700000000", nonce))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(canonical))
+	require.Equal(t, hex.EncodeToString(mac.Sum(nil)), string(req.Header.Peek("X-Signature")))
+
+	// a custom canonical string, hash and encoding
+	s = &HMACSigner{
+		Key:  []byte("secret"),
+		Hash: sha1.New,
+		Canonical: func(req *Request, timestamp, nonce string) (string, error) {
+			return string(req.Header.Method()) + "|" + timestamp, nil
+		},
+		Header: "Authorization",
+		Prefix: "HMAC ",
+		Base64: true,
+	}
+	require.NoError(t, s.Sign(req, time.Unix(1700000000, 0)))
+	mac = hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte("POST|1700000000"))
+	require.Equal(t, "HMAC "+base64.StdEncoding.EncodeToString(mac.Sum(nil)), string(req.Header.Peek("Authorization")))
+
+	// the Components are not used along with a custom canonical string
+	hashes := 0
+	s.Hash = func() hash.Hash {
+		hashes++
+		return sha1.New()
+	}
+	require.NoError(t, s.Sign(req, time.Unix(1700000000, 0)))
+	withoutComponents := hashes
+	hashes = 0
+	s.Components = []string{"body-hash"}
+	require.NoError(t, s.Sign(req, time.Unix(1700000000, 0)))
+	require.Equal(t, withoutComponents, hashes)
+
+	s.Canonical = func(*Request, string, string) (string, error) {
+		return "", errors.New("no canonical string")
+	}
+	require.Error(t, s.Sign(req, time.Now()))
+}
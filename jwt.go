@@ -0,0 +1,283 @@
+package fastreq
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// JWTAlgorithm is a signature algorithm of JSON Web Tokens, see RFC 7518.
+type JWTAlgorithm string
+
+const (
+	JWTHS256 JWTAlgorithm = "HS256"
+	JWTRS256 JWTAlgorithm = "RS256"
+	JWTES256 JWTAlgorithm = "ES256"
+	JWTEdDSA JWTAlgorithm = "EdDSA"
+)
+
+// JWTClientAssertionType is the client_assertion_type of JWT client
+// assertions, see RFC 7523 section 2.2.
+const JWTClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+const (
+	jwtDefaultTTL         = 5 * time.Minute
+	jwtDefaultExpiryDelta = 30 * time.Second
+)
+
+// JWTSigner mints short-lived JSON Web Tokens, see RFC 7519.
+type JWTSigner struct {
+	Algorithm JWTAlgorithm
+	// Key is the secret of HS256 as []byte, or an *rsa.PrivateKey,
+	// *ecdsa.PrivateKey or ed25519.PrivateKey, see LoadPrivateKeyFile.
+	Key crypto.PrivateKey
+	// KeyID is the kid header, left out if empty.
+	KeyID string
+
+	Issuer  string
+	Subject string
+	// Audience returns the aud claim for a request, the scheme and host of the
+	// request by default, or its URL for client assertions.
+	Audience func(req *Request) string
+	// Claims are added to every token.
+	Claims map[string]any
+	// TTL is the lifetime of the tokens, 5 minutes by default.
+	TTL time.Duration
+	// ExpiryDelta is how long before their expiry cached tokens are renewed,
+	// 30 seconds by default.
+	ExpiryDelta time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]jwtToken // by audience
+}
+
+type jwtToken struct {
+	token  string
+	expiry time.Time
+}
+
+// JWTAttach is where MiddlewareJWT attaches the tokens.
+type JWTAttach int
+
+const (
+	// JWTAsBearer sends the tokens as bearer tokens.
+	JWTAsBearer JWTAttach = iota
+	// JWTAsClientAssertion adds the tokens as client_assertion to the form
+	// body, see RFC 7523 section 2.2.
+	JWTAsClientAssertion
+)
+
+// MiddlewareJWT generates a middleware function that authenticates the
+// requests with tokens of the signer, which are cached per audience. Client
+// assertions are signed per request instead, as authorization servers may
+// reject reused ones.
+func MiddlewareJWT(s *JWTSigner, attach JWTAttach) Middleware {
+	return func(ctx *Ctx) error {
+		var token string
+		var err error
+		if attach == JWTAsClientAssertion {
+			token, err = s.Sign(s.assertionAudience(ctx.Request), time.Now())
+		} else {
+			token, err = s.Token(s.audience(ctx.Request))
+		}
+		if err != nil {
+			return err
+		}
+
+		switch attach {
+		case JWTAsClientAssertion:
+			args := fasthttp.AcquireArgs()
+			args.ParseBytes(ctx.Request.Body())
+			args.Set("client_assertion_type", JWTClientAssertionType)
+			args.Set("client_assertion", token)
+			ctx.Request.Header.SetContentType(MIMEApplicationForm)
+			ctx.Request.SetBody(args.QueryString())
+			fasthttp.ReleaseArgs(args)
+		default:
+			ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+token)
+		}
+		return ctx.Next()
+	}
+}
+
+// Token returns a token for the audience, which is cached until ExpiryDelta
+// before it expires.
+func (s *JWTSigner) Token(audience string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delta := s.ExpiryDelta
+	if delta <= 0 {
+		delta = jwtDefaultExpiryDelta
+	}
+	now := time.Now()
+	if t, ok := s.tokens[audience]; ok && now.Add(delta).Before(t.expiry) {
+		return t.token, nil
+	}
+
+	token, err := s.Sign(audience, now)
+	if err != nil {
+		return "", err
+	}
+	if s.tokens == nil {
+		s.tokens = make(map[string]jwtToken)
+	}
+	s.tokens[audience] = jwtToken{token: token, expiry: now.Add(s.ttl())}
+	return token, nil
+}
+
+// Sign returns a new token for the audience issued at the given time, with a
+// unique jti claim.
+func (s *JWTSigner) Sign(audience string, now time.Time) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	claims := make(map[string]any, len(s.Claims)+6)
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+	if s.Issuer != "" {
+		claims["iss"] = s.Issuer
+	}
+	if s.Subject != "" {
+		claims["sub"] = s.Subject
+	}
+	if audience != "" {
+		claims["aud"] = audience
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.ttl()).Unix()
+	claims["jti"] = hex.EncodeToString(jti)
+
+	header := map[string]string{"alg": string(s.Algorithm), "typ": "JWT"}
+	if s.KeyID != "" {
+		header["kid"] = s.KeyID
+	}
+	h, err := jsonMarshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := jsonMarshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	signature, err := jwtSign(s.Algorithm, s.Key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (s *JWTSigner) audience(req *Request) string {
+	if s.Audience != nil {
+		return s.Audience(req)
+	}
+	return string(req.URI().Scheme()) + "://" + canonicalHost(req.URI())
+}
+
+// assertionAudience returns the aud claim of client assertions, which is the
+// URL of the token endpoint by default, see RFC 7523 section 3.
+func (s *JWTSigner) assertionAudience(req *Request) string {
+	if s.Audience != nil {
+		return s.Audience(req)
+	}
+	u := req.URI()
+	return string(u.Scheme()) + "://" + canonicalHost(u) + string(u.RequestURI())
+}
+
+func (s *JWTSigner) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return jwtDefaultTTL
+	}
+	return s.TTL
+}
+
+// jwtSign signs the signing input of a token with the key, see RFC 7518
+// section 3 and RFC 8037 section 3.1.
+func jwtSign(alg JWTAlgorithm, key crypto.PrivateKey, input []byte) ([]byte, error) {
+	switch alg {
+	case JWTHS256:
+		if k, ok := key.([]byte); ok {
+			h := hmac.New(sha256.New, k)
+			h.Write(input)
+			return h.Sum(nil), nil
+		}
+	case JWTRS256:
+		if k, ok := key.(*rsa.PrivateKey); ok {
+			digest := sha256.Sum256(input)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+	case JWTES256:
+		if k, ok := key.(*ecdsa.PrivateKey); ok && k.Curve == elliptic.P256() {
+			digest := sha256.Sum256(input)
+			r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+			if err != nil {
+				return nil, err
+			}
+			// the signature is r and s as fixed size integers
+			signature := make([]byte, 64)
+			r.FillBytes(signature[:32])
+			s.FillBytes(signature[32:])
+			return signature, nil
+		}
+	case JWTEdDSA:
+		if k, ok := key.(ed25519.PrivateKey); ok {
+			return ed25519.Sign(k, input), nil
+		}
+	default:
+		return nil, fmt.Errorf("fastreq: unsupported JWT algorithm %q", alg)
+	}
+	return nil, fmt.Errorf("fastreq: key of type %T does not fit JWT algorithm %q", key, alg)
+}
+
+// LoadPrivateKeyFile loads a private key from a PEM file, see
+// ParsePrivateKeyPEM.
+func LoadPrivateKeyFile(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKeyPEM(data)
+}
+
+// ParsePrivateKeyPEM parses the first private key of PEM data, in PKCS #8,
+// PKCS #1 or SEC 1 form. It returns an *rsa.PrivateKey, *ecdsa.PrivateKey or
+// ed25519.PrivateKey.
+func ParsePrivateKeyPEM(data []byte) (crypto.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("fastreq: no private key in PEM data")
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			return x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package fastreq_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"github.com/wnanbei/fastreq/fastreqtest"
+)
+
+func Test_MiddlewareJWT(t *testing.T) {
+	srv := fastreqtest.NewServer(t)
+	echo := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+	}
+	srv.On(fastreq.GET, "/path").Once().Handle(echo)
+	srv.On(fastreq.GET, "/other").Once().Handle(echo)
+	srv.On(fastreq.POST, "/token").Times(2).Handle(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(string(ctx.PostArgs().Peek("client_assertion_type")) + " " +
+			string(ctx.PostArgs().Peek("client_assertion")) + " " + string(ctx.PostArgs().Peek("a")))
+	})
+	client := srv.Client()
+	s := &fastreq.JWTSigner{Algorithm: fastreq.JWTHS256, Key: []byte("secret"), Issuer: "client"}
+	client.SetJWT(s, fastreq.JWTAsBearer)
+
+	resp, err := client.Get("http://api.fasthttp.great:80/path")
+	require.NoError(t, err)
+	token, ok := strings.CutPrefix(string(resp.Body()), "Bearer ")
+	require.True(t, ok)
+	resp.Release()
+	_, claims := fastreq.JWTVerify(t, token, fastreq.JWTHS256, []byte("secret"))
+	require.Equal(t, "http://api.fasthttp.great", claims["aud"])
+
+	// the token is cached
+	resp, err = client.Get("http://api.fasthttp.great/other")
+	require.NoError(t, err)
+	require.Equal(t, "Bearer "+token, string(resp.Body()))
+	resp.Release()
+
+	// client assertions are signed per request, for the token endpoint
+	client.SetJWT(s, fastreq.JWTAsClientAssertion)
+	var jtis []any
+	for i := 0; i < 2; i++ {
+		resp, err = client.Post("http://api.fasthttp.great:80/token", fastreq.NewBody([]byte("a=1")))
+		require.NoError(t, err)
+		fields := strings.Fields(string(resp.Body()))
+		resp.Release()
+		require.Len(t, fields, 3)
+		require.Equal(t, []string{fastreq.JWTClientAssertionType, "1"}, []string{fields[0], fields[2]})
+		_, claims = fastreq.JWTVerify(t, fields[1], fastreq.JWTHS256, []byte("secret"))
+		require.Equal(t, "http://api.fasthttp.great/token", claims["aud"])
+		jtis = append(jtis, claims["jti"])
+	}
+	require.NotEqual(t, jtis[0], jtis[1])
+}
+
+func Test_Oauth2_ClientAssertion(t *testing.T) {
+	signer := &fastreq.JWTSigner{Algorithm: fastreq.JWTHS256, Key: []byte("secret"), Issuer: "client", Subject: "client"}
+	var assertions []string
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/token").Times(2).Handle(func(ctx *fasthttp.RequestCtx) {
+		require.Empty(t, ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+		require.Equal(t, "client", string(ctx.PostArgs().Peek("client_id")))
+		require.Equal(t, fastreq.JWTClientAssertionType, string(ctx.PostArgs().Peek("client_assertion_type")))
+		assertion := string(ctx.PostArgs().Peek("client_assertion"))
+		_, claims := fastreq.JWTVerify(t, assertion, fastreq.JWTHS256, []byte("secret"))
+		require.Equal(t, "http://auth.fasthttp.great/token", claims["aud"])
+		assertions = append(assertions, assertion)
+
+		ctx.SetContentType("application/json")
+		ctx.SetBodyString(`{"access_token":"t","token_type":"bearer","expires_in":1}`)
+	})
+
+	o := &fastreq.Oauth2{
+		ClientID:        "client",
+		TokenURL:        "http://auth.fasthttp.great/token",
+		ClientAssertion: signer,
+		Client:          srv.Client(),
+	}
+	for i := 0; i < 2; i++ {
+		token, err := o.Token()
+		require.NoError(t, err)
+		require.Equal(t, "t", token.AccessToken)
+	}
+	// every token request has a new assertion
+	require.Len(t, assertions, 2)
+	require.NotEqual(t, assertions[0], assertions[1])
+}
@@ -0,0 +1,167 @@
+package fastreq
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jwtVerify checks the signature of a token and returns its header and claims.
+func jwtVerify(t *testing.T, token string, alg JWTAlgorithm, key crypto.PublicKey) (map[string]any, map[string]any) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	input := []byte(parts[0] + "." + parts[1])
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+
+	digest := sha256.Sum256(input)
+	switch alg {
+	case JWTHS256:
+		h := hmac.New(sha256.New, key.([]byte))
+		h.Write(input)
+		require.Equal(t, h.Sum(nil), signature)
+	case JWTRS256:
+		require.NoError(t, rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature))
+	case JWTES256:
+		require.Len(t, signature, 64)
+		require.True(t, ecdsa.Verify(key.(*ecdsa.PublicKey), digest[:],
+			new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])))
+	case JWTEdDSA:
+		require.True(t, ed25519.Verify(key.(ed25519.PublicKey), input, signature))
+	}
+
+	var header, claims map[string]any
+	for i, v := range []*map[string]any{&header, &claims} {
+		b, err := base64.RawURLEncoding.DecodeString(parts[i])
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, v))
+	}
+	return header, claims
+}
+
+func Test_JWT_Sign(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	for _, tc := range []struct {
+		alg     JWTAlgorithm
+		private crypto.PrivateKey
+		public  crypto.PublicKey
+	}{
+		{JWTHS256, []byte("secret"), []byte("secret")},
+		{JWTRS256, rsaKey, &rsaKey.PublicKey},
+		{JWTES256, ecKey, &ecKey.PublicKey},
+		{JWTEdDSA, edPrivate, edPublic},
+	} {
+		s := &JWTSigner{
+			Algorithm: tc.alg,
+			Key:       tc.private,
+			KeyID:     "key-1",
+			Issuer:    "issuer",
+			Subject:   "service",
+			Claims:    map[string]any{"scope": "read", "iss": "overridden"},
+			TTL:       time.Minute,
+		}
+		token, err := s.Sign("https://api.example.com", now)
+		require.NoError(t, err, tc.alg)
+
+		header, claims := jwtVerify(t, token, tc.alg, tc.public)
+		require.Equal(t, map[string]any{"alg": string(tc.alg), "typ": "JWT", "kid": "key-1"}, header)
+		require.Equal(t, "issuer", claims["iss"])
+		require.Equal(t, "service", claims["sub"])
+		require.Equal(t, "https://api.example.com", claims["aud"])
+		require.Equal(t, "read", claims["scope"])
+		require.Equal(t, float64(1700000000), claims["iat"])
+		require.Equal(t, float64(1700000060), claims["exp"])
+		require.Len(t, claims["jti"], 32)
+
+		other, err := s.Sign("https://api.example.com", now)
+		require.NoError(t, err)
+		_, otherClaims := jwtVerify(t, other, tc.alg, tc.public)
+		require.NotEqual(t, claims["jti"], otherClaims["jti"])
+	}
+
+	_, err = (&JWTSigner{Algorithm: JWTES256, Key: rsaKey}).Sign("", now)
+	require.Error(t, err)
+	_, err = (&JWTSigner{Algorithm: "none"}).Sign("", now)
+	require.Error(t, err)
+}
+
+func Test_JWT_Token(t *testing.T) {
+	s := &JWTSigner{Algorithm: JWTHS256, Key: []byte("secret"), TTL: time.Minute}
+
+	first, err := s.Token("https://a.example.com")
+	require.NoError(t, err)
+	cached, err := s.Token("https://a.example.com")
+	require.NoError(t, err)
+	require.Equal(t, first, cached)
+	other, err := s.Token("https://b.example.com")
+	require.NoError(t, err)
+	require.NotEqual(t, first, other)
+
+	// tokens are renewed ExpiryDelta before they expire
+	s.ExpiryDelta = time.Minute
+	renewed, err := s.Token("https://a.example.com")
+	require.NoError(t, err)
+	require.NotEqual(t, first, renewed)
+}
+
+func Test_JWT_PrivateKeyPEM(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		// keys may follow other blocks, like certificates
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("not a key")})
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})...)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return path
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	key, err := LoadPrivateKeyFile(write("rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)))
+	require.NoError(t, err)
+	require.True(t, rsaKey.Equal(key))
+	key, err = LoadPrivateKeyFile(write("ec.pem", "EC PRIVATE KEY", ecDER))
+	require.NoError(t, err)
+	require.True(t, ecKey.Equal(key))
+	key, err = LoadPrivateKeyFile(write("ed.pem", "PRIVATE KEY", edDER))
+	require.NoError(t, err)
+	require.True(t, edKey.Equal(key))
+
+	_, err = ParsePrivateKeyPEM([]byte("no PEM"))
+	require.Error(t, err)
+	_, err = LoadPrivateKeyFile(filepath.Join(dir, "missing.pem"))
+	require.Error(t, err)
+}
@@ -0,0 +1,520 @@
+package fastreq
+
+import (
+	"crypto/tls"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// lbReplicas is the number of points an upstream with weight 1 has on the ring
+// of LBConsistentHash.
+const lbReplicas = 160
+
+// LBStrategy is the strategy a LoadBalancer picks the upstream of a request with.
+type LBStrategy int
+
+const (
+	// LBRoundRobin sends the requests to the upstreams in turn.
+	LBRoundRobin LBStrategy = iota
+	// LBLeastInflight sends a request to the upstream with the fewest requests
+	// in flight.
+	LBLeastInflight
+	// LBWeighted sends the requests to the upstreams in turn, in proportion to
+	// their weights.
+	LBWeighted
+	// LBConsistentHash sends requests with the same key to the same upstream,
+	// see LBConfig.HashKey. Only the keys of an ejected upstream move to others.
+	LBConsistentHash
+)
+
+// Upstream is an address of a load balanced service.
+type Upstream struct {
+	// Addr is the host and port of the upstream, e.g. "10.0.0.1:8080".
+	Addr string
+	// Weight is the share of the requests of the upstream for LBWeighted and
+	// LBConsistentHash, 1 by default.
+	Weight int
+}
+
+// UpstreamStatus is the state of an upstream, as returned by LoadBalancer.Status.
+type UpstreamStatus struct {
+	Addr     string
+	Weight   int
+	Healthy  bool
+	Inflight int64
+	// Fails is the number of consecutive failed requests.
+	Fails int
+}
+
+// LBConfig configures a LoadBalancer.
+type LBConfig struct {
+	Upstreams []Upstream
+	Strategy  LBStrategy
+	// HashKey returns the key of a request for LBConsistentHash, the request URI
+	// by default.
+	HashKey func(req *Request) string
+
+	// MaxFails is the number of consecutive failed requests after which an
+	// upstream is ejected, 3 by default. A negative value disables ejection.
+	MaxFails int
+	// EjectDuration is the time an ejected upstream gets no requests, 30 seconds
+	// by default.
+	EjectDuration time.Duration
+	// IsFailure reports whether a request failed. By default, errors and
+	// responses with a status code of 500 and above are failures.
+	IsFailure func(resp *fasthttp.Response, err error) bool
+
+	// HealthCheckInterval is the interval upstreams are probed in, 0 disables
+	// active health checks. Upstreams which fail a probe get no requests until a
+	// probe succeeds.
+	HealthCheckInterval time.Duration
+	// HealthCheckPath is the path probed with a GET request, "/" by default. The
+	// probe succeeds on a 2xx or 3xx response.
+	HealthCheckPath string
+	// HealthCheckTimeout is the timeout of a probe, 5 seconds by default.
+	HealthCheckTimeout time.Duration
+	// HealthCheckTLS probes the upstreams over https.
+	HealthCheckTLS bool
+	// HealthCheckHost is the host of the probes, which is sent as their Host
+	// header and verified by the TLS certificates of the upstreams. By default,
+	// it is the host of the last balanced request, or the address of the
+	// upstream before the first one.
+	HealthCheckHost string
+}
+
+// upstream is the state of an Upstream of a LoadBalancer.
+type upstream struct {
+	Upstream
+	inflight atomic.Int64
+
+	// guarded by LoadBalancer.mu
+	fails        int
+	ejectedUntil time.Time
+	down         bool // failed the last active health check
+	current      int  // smooth weighted round-robin state
+
+	clientsMu sync.Mutex
+	clients   map[upstreamKey]*fasthttp.HostClient
+}
+
+// upstreamKey identifies a connection pool of an upstream.
+type upstreamKey struct {
+	transportKey
+	isTLS bool
+	// serverName is the host of the request URL, which the TLS certificate of
+	// the upstream is verified for.
+	serverName string
+}
+
+// lbRingNode is a point of an upstream on the consistent hash ring.
+type lbRingNode struct {
+	hash     uint32
+	upstream *upstream
+}
+
+// LoadBalancer spreads the requests of a Client over the upstreams of a single
+// logical service, see Client.SetLoadBalancer.
+type LoadBalancer struct {
+	config    LBConfig
+	upstreams []*upstream
+	ring      []lbRingNode
+	next      atomic.Uint64
+	client    atomic.Pointer[Client]
+	host      atomic.Pointer[string] // host of the last balanced request
+
+	mu sync.Mutex
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLoadBalancer returns a LoadBalancer for the given upstreams. If active
+// health checks are configured, the LoadBalancer probes its upstreams until it
+// is closed.
+func NewLoadBalancer(config *LBConfig) (*LoadBalancer, error) {
+	if len(config.Upstreams) == 0 {
+		return nil, errors.New("fastreq: no upstreams to balance")
+	}
+
+	lb := &LoadBalancer{config: *config, stop: make(chan struct{})}
+	if lb.config.MaxFails == 0 {
+		lb.config.MaxFails = 3
+	}
+	if lb.config.EjectDuration <= 0 {
+		lb.config.EjectDuration = 30 * time.Second
+	}
+	if lb.config.IsFailure == nil {
+		lb.config.IsFailure = isLBFailure
+	}
+	if lb.config.HashKey == nil {
+		lb.config.HashKey = func(req *Request) string { return string(req.URI().RequestURI()) }
+	}
+	if lb.config.HealthCheckPath == "" {
+		lb.config.HealthCheckPath = "/"
+	}
+	if lb.config.HealthCheckTimeout <= 0 {
+		lb.config.HealthCheckTimeout = 5 * time.Second
+	}
+
+	for _, u := range config.Upstreams {
+		if u.Addr == "" {
+			return nil, errors.New("fastreq: upstream without address")
+		}
+		if u.Weight <= 0 {
+			u.Weight = 1
+		}
+		lb.upstreams = append(lb.upstreams, &upstream{Upstream: u})
+	}
+	if lb.config.Strategy == LBConsistentHash {
+		lb.buildRing()
+	}
+
+	if lb.config.HealthCheckInterval > 0 {
+		go lb.probeLoop()
+	}
+	return lb, nil
+}
+
+// isLBFailure is the default LBConfig.IsFailure.
+func isLBFailure(resp *fasthttp.Response, err error) bool {
+	return err != nil || resp.StatusCode() >= fasthttp.StatusInternalServerError
+}
+
+// SetLoadBalancer makes the Client send all requests to the upstreams of lb,
+// which are picked per request. The host of the request URL is still sent as
+// the Host header, and as server name for TLS unless the TLS config has one, so
+// that certificates and pins are verified for it rather than the upstream.
+// The upstream a request was sent to is stored as ValueUpstream.
+//
+// A LoadBalancer must not be shared by Clients. Passing nil disables load
+// balancing.
+func (c *Client) SetLoadBalancer(lb *LoadBalancer) {
+	if c.balancer != nil && c.balancer != lb {
+		c.balancer.client.CompareAndSwap(c, nil)
+	}
+	c.balancer = lb
+	if lb != nil {
+		lb.client.Store(c)
+		lb.reset()
+	}
+}
+
+// Close stops the active health checks and closes the idle connections to the
+// upstreams.
+func (lb *LoadBalancer) Close() {
+	lb.closeOnce.Do(func() {
+		close(lb.stop)
+	})
+	lb.reset()
+}
+
+// Status returns the state of the upstreams.
+func (lb *LoadBalancer) Status() []UpstreamStatus {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := time.Now()
+	status := make([]UpstreamStatus, len(lb.upstreams))
+	for i, u := range lb.upstreams {
+		status[i] = UpstreamStatus{
+			Addr:     u.Addr,
+			Weight:   u.Weight,
+			Healthy:  u.healthy(now),
+			Inflight: u.inflight.Load(),
+			Fails:    u.fails,
+		}
+	}
+	return status
+}
+
+// do sends the request of ctx to an upstream and fills resp.
+func (lb *LoadBalancer) do(c *Client, ctx *Ctx, resp *Response) error {
+	u := lb.pick(ctx.Request)
+	hc, err := u.hostClient(c, ctx.Request)
+	if err != nil {
+		return err
+	}
+	ctx.SetValue(ValueUpstream, u.Addr)
+	if host := ctx.Request.URI().Host(); lb.lastHost() != string(host) {
+		h := string(host)
+		lb.host.Store(&h)
+	}
+
+	u.inflight.Add(1)
+	err = hc.DoTimeout(ctx.fastRequest(), resp.Response, c.timeout)
+	u.inflight.Add(-1)
+
+	lb.report(u, lb.config.IsFailure(resp.Response, err))
+	return err
+}
+
+// lastHost returns the host of the last balanced request, if any.
+func (lb *LoadBalancer) lastHost() string {
+	if h := lb.host.Load(); h != nil {
+		return *h
+	}
+	return ""
+}
+
+// pick returns the upstream for req. If all upstreams are unhealthy, it picks
+// from all of them rather than failing the request.
+func (lb *LoadBalancer) pick(req *Request) *upstream {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := time.Now()
+	if lb.config.Strategy == LBConsistentHash {
+		return lb.pickHash(req, now)
+	}
+
+	candidates := make([]*upstream, 0, len(lb.upstreams))
+	for _, u := range lb.upstreams {
+		if u.healthy(now) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = lb.upstreams
+	}
+
+	switch lb.config.Strategy {
+	case LBLeastInflight:
+		// start at a rotating offset, so that ties are spread as well
+		offset := int(lb.next.Add(1) % uint64(len(candidates)))
+		best := candidates[offset]
+		for i := 1; i < len(candidates); i++ {
+			u := candidates[(offset+i)%len(candidates)]
+			if u.inflight.Load() < best.inflight.Load() {
+				best = u
+			}
+		}
+		return best
+	case LBWeighted:
+		// smooth weighted round-robin, which interleaves the upstreams
+		total := 0
+		var best *upstream
+		for _, u := range candidates {
+			u.current += u.Weight
+			total += u.Weight
+			if best == nil || u.current > best.current {
+				best = u
+			}
+		}
+		best.current -= total
+		return best
+	}
+	return candidates[(lb.next.Add(1)-1)%uint64(len(candidates))]
+}
+
+// pickHash returns the first healthy upstream on the ring after the hash of the
+// key of req.
+func (lb *LoadBalancer) pickHash(req *Request, now time.Time) *upstream {
+	h := lbHash(lb.config.HashKey(req))
+	i := sort.Search(len(lb.ring), func(i int) bool { return lb.ring[i].hash >= h })
+	for n := 0; n < len(lb.ring); n++ {
+		if u := lb.ring[(i+n)%len(lb.ring)].upstream; u.healthy(now) {
+			return u
+		}
+	}
+	return lb.ring[i%len(lb.ring)].upstream
+}
+
+// buildRing places the upstreams on the consistent hash ring.
+func (lb *LoadBalancer) buildRing() {
+	for _, u := range lb.upstreams {
+		for i := 0; i < lbReplicas*u.Weight; i++ {
+			lb.ring = append(lb.ring, lbRingNode{hash: lbHash(u.Addr + "#" + strconv.Itoa(i)), upstream: u})
+		}
+	}
+	sort.Slice(lb.ring, func(i, j int) bool { return lb.ring[i].hash < lb.ring[j].hash })
+}
+
+// lbHash is the hash of the consistent hash ring.
+func lbHash(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// report records the outcome of a request for the passive health check.
+func (lb *LoadBalancer) report(u *upstream, failed bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if !failed {
+		u.fails = 0
+		return
+	}
+	u.fails++
+	if lb.config.MaxFails > 0 && u.fails >= lb.config.MaxFails {
+		u.fails = 0
+		u.ejectedUntil = time.Now().Add(lb.config.EjectDuration)
+	}
+}
+
+// probeLoop runs the active health checks until the LoadBalancer is closed.
+func (lb *LoadBalancer) probeLoop() {
+	ticker := time.NewTicker(lb.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		lb.probe()
+		select {
+		case <-lb.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe checks all upstreams at once and updates their health.
+func (lb *LoadBalancer) probe() {
+	c := lb.client.Load()
+	if c == nil {
+		return
+	}
+
+	scheme := "http://"
+	if lb.config.HealthCheckTLS {
+		scheme = "https://"
+	}
+	host := lb.config.HealthCheckHost
+	if host == "" {
+		host = lb.lastHost()
+	}
+
+	var wg sync.WaitGroup
+	for _, u := range lb.upstreams {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+
+			req := fasthttp.AcquireRequest()
+			resp := fasthttp.AcquireResponse()
+			defer fasthttp.ReleaseRequest(req)
+			defer fasthttp.ReleaseResponse(resp)
+			if host != "" {
+				req.SetRequestURI(scheme + host + lb.config.HealthCheckPath)
+			} else {
+				req.SetRequestURI(scheme + u.Addr + lb.config.HealthCheckPath)
+			}
+
+			healthy := false
+			hc, err := u.hostClient(c, &Request{Request: req})
+			if err == nil {
+				err = hc.DoTimeout(req, resp, lb.config.HealthCheckTimeout)
+				healthy = err == nil && resp.StatusCode() < fasthttp.StatusBadRequest
+			}
+
+			lb.mu.Lock()
+			u.down = !healthy
+			if healthy {
+				u.fails = 0
+				u.ejectedUntil = time.Time{}
+			}
+			lb.mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+}
+
+// reset closes the connection pools of the upstreams, so that they are recreated
+// with the current settings of the Client.
+func (lb *LoadBalancer) reset() {
+	for _, u := range lb.upstreams {
+		u.clientsMu.Lock()
+		for _, hc := range u.clients {
+			hc.CloseIdleConnections()
+		}
+		u.clients = nil
+		u.clientsMu.Unlock()
+	}
+}
+
+// healthy reports whether the upstream gets requests. Must be called with
+// LoadBalancer.mu held.
+func (u *upstream) healthy(now time.Time) bool {
+	return !u.down && !now.Before(u.ejectedUntil)
+}
+
+// hostClient returns the connection pool of the upstream for req. The pools
+// take the settings of the transport of the request, see Client.transport, as
+// fasthttp.Client passes them to its own pools.
+func (u *upstream) hostClient(c *Client, req *Request) (*fasthttp.HostClient, error) {
+	key := upstreamKey{
+		transportKey: transportKey{proxy: req.proxy, insecure: req.insecureSkipVerify},
+		isTLS:        string(req.URI().Scheme()) == "https",
+	}
+	if key.isTLS {
+		key.serverName = uriHostname(req.URI())
+	}
+
+	u.clientsMu.Lock()
+	hc, ok := u.clients[key]
+	u.clientsMu.Unlock()
+	if ok {
+		return hc, nil
+	}
+
+	t, err := c.transport(req)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := t.TLSConfig
+	if key.isTLS && (tlsConfig == nil || tlsConfig.ServerName == "") {
+		// fasthttp would use the address of the upstream
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{} // #nosec G402
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		tlsConfig.ServerName = key.serverName
+	}
+	hc = &fasthttp.HostClient{
+		Addr:                          u.Addr,
+		Name:                          t.Name,
+		NoDefaultUserAgentHeader:      t.NoDefaultUserAgentHeader,
+		Dial:                          t.Dial,
+		DialDualStack:                 t.DialDualStack,
+		IsTLS:                         key.isTLS,
+		TLSConfig:                     tlsConfig,
+		MaxConns:                      t.MaxConnsPerHost,
+		MaxConnDuration:               t.MaxConnDuration,
+		MaxIdleConnDuration:           t.MaxIdleConnDuration,
+		MaxIdemponentCallAttempts:     t.MaxIdemponentCallAttempts,
+		ReadBufferSize:                t.ReadBufferSize,
+		WriteBufferSize:               t.WriteBufferSize,
+		ReadTimeout:                   t.ReadTimeout,
+		WriteTimeout:                  t.WriteTimeout,
+		MaxResponseBodySize:           t.MaxResponseBodySize,
+		DisableHeaderNamesNormalizing: t.DisableHeaderNamesNormalizing,
+		DisablePathNormalizing:        t.DisablePathNormalizing,
+		MaxConnWaitTimeout:            t.MaxConnWaitTimeout,
+		RetryIf:                       t.RetryIf,
+		ConnPoolStrategy:              t.ConnPoolStrategy,
+		StreamResponseBody:            t.StreamResponseBody,
+	}
+	if t.ConfigureClient != nil {
+		if err := t.ConfigureClient(hc); err != nil {
+			return nil, err
+		}
+	}
+
+	u.clientsMu.Lock()
+	defer u.clientsMu.Unlock()
+	if existing, ok := u.clients[key]; ok {
+		return existing, nil
+	}
+	if u.clients == nil {
+		u.clients = make(map[upstreamKey]*fasthttp.HostClient)
+	}
+	u.clients[key] = hc
+	return hc, nil
+}
@@ -0,0 +1,375 @@
+package fastreq
+
+import (
+	"crypto/x509"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// lbServers starts an in-memory server per address and returns a client which
+// dials them by address. The handler gets the address of the server.
+func lbServers(t *testing.T, addrs []string, handler func(addr string, ctx *fasthttp.RequestCtx)) *Client {
+	lns := make(map[string]*fasthttputil.InmemoryListener)
+	for _, addr := range addrs {
+		addr := addr
+		ln := fasthttputil.NewInmemoryListener()
+		lns[addr] = ln
+		s := &fasthttp.Server{
+			Handler: func(ctx *fasthttp.RequestCtx) {
+				handler(addr, ctx)
+			},
+		}
+		go func() {
+			err := s.Serve(ln)
+			if err != nil {
+				return
+			}
+		}()
+		t.Cleanup(func() { _ = ln.Close() })
+	}
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		ln, ok := lns[addr]
+		if !ok {
+			return nil, fasthttp.ErrNoFreeConns
+		}
+		return ln.Dial()
+	}
+	return client
+}
+
+func Test_LoadBalancer_RoundRobin(t *testing.T) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}
+	client := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(addr + " " + string(ctx.Host()))
+	})
+
+	lb, err := NewLoadBalancer(&LBConfig{Upstreams: []Upstream{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}}})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	for i := 0; i < 6; i++ {
+		resp, err := client.Get("http://service.fasthttp.great/")
+		require.NoError(t, err)
+		// the host of the URL is kept as Host header
+		require.Equal(t, addrs[i%3]+" service.fasthttp.great", string(resp.Body()))
+		upstream, _ := ValueOf[string](resp, ValueUpstream)
+		require.Equal(t, addrs[i%3], upstream)
+		resp.Release()
+	}
+
+	resp, err := client.Post("http://service.fasthttp.great/", NewBody([]byte("hello")))
+	require.NoError(t, err)
+	require.Equal(t, addrs[0]+" service.fasthttp.great", string(resp.Body()))
+	resp.Release()
+
+	_, err = NewLoadBalancer(&LBConfig{})
+	require.Error(t, err)
+}
+
+func Test_LoadBalancer_Weighted(t *testing.T) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	client := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(addr)
+	})
+
+	lb, err := NewLoadBalancer(&LBConfig{
+		Upstreams: []Upstream{{Addr: addrs[0], Weight: 3}, {Addr: addrs[1]}},
+		Strategy:  LBWeighted,
+	})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	var got []string
+	for i := 0; i < 8; i++ {
+		resp, err := client.Get("http://service.fasthttp.great/")
+		require.NoError(t, err)
+		got = append(got, string(resp.Body()))
+		resp.Release()
+	}
+	// smooth weighted round-robin interleaves the upstreams
+	a, b := addrs[0], addrs[1]
+	require.Equal(t, []string{a, a, b, a, a, a, b, a}, got)
+}
+
+func Test_LoadBalancer_LeastInflight(t *testing.T) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	block := make(chan struct{})
+	client := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/slow" {
+			<-block
+		}
+		ctx.SetBodyString(addr)
+	})
+
+	lb, err := NewLoadBalancer(&LBConfig{
+		Upstreams: []Upstream{{Addr: addrs[0]}, {Addr: addrs[1]}},
+		Strategy:  LBLeastInflight,
+	})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	var slow string
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := client.Get("http://service.fasthttp.great/slow")
+		if err == nil {
+			slow = string(resp.Body())
+			resp.Release()
+		}
+	}()
+	require.Eventually(t, func() bool {
+		for _, s := range lb.Status() {
+			if s.Inflight == 1 {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+
+	var busy string
+	for _, s := range lb.Status() {
+		if s.Inflight == 1 {
+			busy = s.Addr
+		}
+	}
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get("http://service.fasthttp.great/")
+		require.NoError(t, err)
+		require.NotEqual(t, busy, string(resp.Body()))
+		resp.Release()
+	}
+
+	close(block)
+	wg.Wait()
+	require.Equal(t, busy, slow)
+}
+
+func Test_LoadBalancer_ConsistentHash(t *testing.T) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80", "10.0.0.3:80"}
+	var failing atomic.Value
+	failing.Store("")
+	client := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		if addr == failing.Load().(string) {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		}
+		ctx.SetBodyString(addr)
+	})
+
+	lb, err := NewLoadBalancer(&LBConfig{
+		Upstreams: []Upstream{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}},
+		Strategy:  LBConsistentHash,
+		HashKey: func(req *Request) string {
+			return string(req.Header.Peek("X-User"))
+		},
+		MaxFails: 1,
+	})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	get := func(user string) string {
+		resp, err := client.Get("http://service.fasthttp.great/", NewHeaders("X-User", user))
+		require.NoError(t, err)
+		defer resp.Release()
+		return string(resp.Body())
+	}
+
+	users := []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi"}
+	placed := make(map[string]string)
+	used := make(map[string]bool)
+	for _, user := range users {
+		placed[user] = get(user)
+		used[placed[user]] = true
+		require.Equal(t, placed[user], get(user))
+	}
+	require.Greater(t, len(used), 1)
+
+	// the default key is the request URI
+	hashed, err := NewLoadBalancer(&LBConfig{
+		Upstreams: []Upstream{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}},
+		Strategy:  LBConsistentHash,
+	})
+	require.NoError(t, err)
+	defer hashed.Close()
+	other := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(addr)
+	})
+	other.SetLoadBalancer(hashed)
+	for _, path := range []string{"/a", "/b?c=d"} {
+		resp, err := other.Get("http://service.fasthttp.great" + path)
+		require.NoError(t, err)
+		first := string(resp.Body())
+		resp.Release()
+		resp, err = other.Get("http://service.fasthttp.great" + path)
+		require.NoError(t, err)
+		require.Equal(t, first, resp.BodyString())
+		resp.Release()
+	}
+
+	// once the upstream of alice is ejected, only its keys move
+	failing.Store(placed["alice"])
+	get("alice")
+	for _, user := range users {
+		if placed[user] == placed["alice"] {
+			require.NotEqual(t, placed["alice"], get(user))
+		} else {
+			require.Equal(t, placed[user], get(user))
+		}
+	}
+}
+
+func Test_LoadBalancer_PassiveHealthCheck(t *testing.T) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	var calls atomic.Int64
+	client := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		if addr == addrs[0] {
+			calls.Add(1)
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		}
+		ctx.SetBodyString(addr)
+	})
+
+	lb, err := NewLoadBalancer(&LBConfig{
+		Upstreams:     []Upstream{{Addr: addrs[0]}, {Addr: addrs[1]}},
+		MaxFails:      2,
+		EjectDuration: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	get := func() {
+		resp, err := client.Get("http://service.fasthttp.great/")
+		require.NoError(t, err)
+		resp.Release()
+	}
+
+	for i := 0; i < 10; i++ {
+		get()
+	}
+	require.Equal(t, int64(2), calls.Load())
+	require.False(t, lb.Status()[0].Healthy)
+	require.True(t, lb.Status()[1].Healthy)
+
+	// the upstream gets requests again once the ejection is over
+	time.Sleep(150 * time.Millisecond)
+	require.True(t, lb.Status()[0].Healthy)
+	get()
+	get()
+	require.Equal(t, int64(3), calls.Load())
+}
+
+func Test_LoadBalancer_ActiveHealthCheck(t *testing.T) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	var down atomic.Bool
+	down.Store(true)
+	client := lbServers(t, addrs, func(addr string, ctx *fasthttp.RequestCtx) {
+		if string(ctx.Path()) == "/health" && addr == addrs[0] && down.Load() {
+			ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		}
+		ctx.SetBodyString(addr)
+	})
+
+	lb, err := NewLoadBalancer(&LBConfig{
+		Upstreams:           []Upstream{{Addr: addrs[0]}, {Addr: addrs[1]}},
+		HealthCheckInterval: 10 * time.Millisecond,
+		HealthCheckPath:     "/health",
+	})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	require.Eventually(t, func() bool { return !lb.Status()[0].Healthy }, time.Second, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get("http://service.fasthttp.great/")
+		require.NoError(t, err)
+		require.Equal(t, addrs[1], string(resp.Body()))
+		resp.Release()
+	}
+
+	down.Store(false)
+	require.Eventually(t, func() bool { return lb.Status()[0].Healthy }, time.Second, time.Millisecond)
+}
+
+func Test_LoadBalancer_TLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	client := mtlsServer(t, ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client.SetRootCAs(pool)
+	cert, err := LoadClientCertificate(newTestCert(t, "a", ca).write(t, t.TempDir(), "client"))
+	require.NoError(t, err)
+	client.SetClientCertificate(cert)
+
+	lb, err := NewLoadBalancer(&LBConfig{Upstreams: []Upstream{{Addr: "10.0.0.1:443"}}})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+
+	// the certificate is verified for the host of the request, not the upstream
+	require.Equal(t, "a", get(t, client))
+
+	// the pins of the host apply as well
+	client.SetSPKIPins("localhost", "bm90IHRoZSBwaW4=")
+	_, err = client.Get("https://localhost/")
+	var pinErr *PinMismatchError
+	require.True(t, errors.As(err, &pinErr), err)
+	require.Equal(t, "localhost", pinErr.Host)
+
+	client.SetSPKIPins("localhost", SPKIPin(ca.cert))
+	require.Equal(t, "a", get(t, client))
+}
+
+func Test_LoadBalancer_TLSHealthCheck(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	client := mtlsServer(t, ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client.SetRootCAs(pool)
+	cert, err := LoadClientCertificate(newTestCert(t, "a", ca).write(t, t.TempDir(), "client"))
+	require.NoError(t, err)
+	client.SetClientCertificate(cert)
+
+	config := &LBConfig{
+		Upstreams:           []Upstream{{Addr: "10.0.0.1:443"}},
+		HealthCheckInterval: 10 * time.Millisecond,
+		HealthCheckTLS:      true,
+	}
+	lb, err := NewLoadBalancer(config)
+	require.NoError(t, err)
+	client.SetLoadBalancer(lb)
+
+	// the certificate doesn't match the address of the upstream
+	require.Eventually(t, func() bool { return !lb.Status()[0].Healthy }, time.Second, time.Millisecond)
+
+	// the probes take the host of the balanced requests
+	require.Equal(t, "a", get(t, client))
+	require.Eventually(t, func() bool { return lb.Status()[0].Healthy }, time.Second, time.Millisecond)
+	lb.Close()
+
+	// unless one is configured
+	config.HealthCheckHost = "service.fasthttp.great"
+	lb, err = NewLoadBalancer(config)
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+	require.Equal(t, "a", get(t, client))
+	require.Eventually(t, func() bool { return !lb.Status()[0].Healthy }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, lb.Status()[0].Healthy)
+}
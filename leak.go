@@ -0,0 +1,145 @@
+package fastreq
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// Leak describes a pooled object which was not released, or released more than once.
+type Leak struct {
+	// Kind is the type of the object: "Request", "Response" or "Ctx".
+	Kind string
+	// DoubleRelease is true if the object was released more than once,
+	// otherwise it has not been released yet.
+	DoubleRelease bool
+	// AcquireStack is the stack trace of the acquisition of the object.
+	AcquireStack string
+	// ReleaseStack is the stack trace of the first release of the object.
+	// It is empty for objects which were not released.
+	ReleaseStack string
+	// DoubleReleaseStack is the stack trace of the second release of the object.
+	DoubleReleaseStack string
+}
+
+// String returns a human-readable description of the leak, including the stack traces.
+func (l Leak) String() string {
+	if l.DoubleRelease {
+		return fmt.Sprintf(
+			"%s released twice\nacquired at:\n%s\nreleased at:\n%s\nreleased again at:\n%s",
+			l.Kind, l.AcquireStack, l.ReleaseStack, l.DoubleReleaseStack,
+		)
+	}
+	return fmt.Sprintf("%s not released\nacquired at:\n%s", l.Kind, l.AcquireStack)
+}
+
+// trackedObject is the state of an object tracked by the leak detector.
+type trackedObject struct {
+	kind         string
+	acquireStack string
+	releaseStack string
+	released     bool
+}
+
+// leakDetector tracks acquired Request, Response and Ctx objects while the leak
+// detection is enabled. It is meant for debugging and tests only, as recording
+// stack traces is expensive.
+var leakDetector struct {
+	enabled atomic.Bool
+	mu      sync.Mutex
+	objects map[any]*trackedObject
+	double  []Leak
+}
+
+// SetLeakDetection enables or disables the leak detection for Request, Response and
+// Ctx objects. Only objects acquired while the detection is enabled are tracked.
+func SetLeakDetection(enabled bool) {
+	leakDetector.enabled.Store(enabled)
+}
+
+// Leaks returns the tracked objects which have not been released yet, followed by
+// the objects which were released more than once.
+func Leaks() []Leak {
+	leakDetector.mu.Lock()
+	defer leakDetector.mu.Unlock()
+
+	var leaks []Leak
+	for _, o := range leakDetector.objects {
+		if !o.released {
+			leaks = append(leaks, Leak{Kind: o.kind, AcquireStack: o.acquireStack})
+		}
+	}
+	return append(leaks, leakDetector.double...)
+}
+
+// ResetLeaks forgets all tracked objects and reported leaks.
+func ResetLeaks() {
+	leakDetector.mu.Lock()
+	leakDetector.objects = nil
+	leakDetector.double = nil
+	leakDetector.mu.Unlock()
+}
+
+// leakKind returns the Kind reported for obj.
+func leakKind(obj any) string {
+	switch obj.(type) {
+	case *Request:
+		return "Request"
+	case *Response:
+		return "Response"
+	case *Ctx:
+		return "Ctx"
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+// trackAcquire records the acquisition of obj.
+func trackAcquire(obj any) {
+	if !leakDetector.enabled.Load() {
+		return
+	}
+	stack := string(debug.Stack())
+
+	leakDetector.mu.Lock()
+	if leakDetector.objects == nil {
+		leakDetector.objects = make(map[any]*trackedObject)
+	}
+	leakDetector.objects[obj] = &trackedObject{kind: leakKind(obj), acquireStack: stack}
+	leakDetector.mu.Unlock()
+}
+
+// trackRelease records the release of obj.
+func trackRelease(obj any) {
+	if !leakDetector.enabled.Load() {
+		return
+	}
+	stack := string(debug.Stack())
+
+	leakDetector.mu.Lock()
+	defer leakDetector.mu.Unlock()
+
+	if o, ok := leakDetector.objects[obj]; ok {
+		o.released = true
+		o.releaseStack = stack
+	}
+}
+
+// trackDoubleRelease records an object which is released although it has been
+// released already.
+func trackDoubleRelease(obj any) {
+	if !leakDetector.enabled.Load() {
+		return
+	}
+	stack := string(debug.Stack())
+
+	leakDetector.mu.Lock()
+	defer leakDetector.mu.Unlock()
+
+	leak := Leak{Kind: leakKind(obj), DoubleRelease: true, DoubleReleaseStack: stack}
+	if o, ok := leakDetector.objects[obj]; ok {
+		leak.AcquireStack = o.acquireStack
+		leak.ReleaseStack = o.releaseStack
+	}
+	leakDetector.double = append(leakDetector.double, leak)
+}
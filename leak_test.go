@@ -0,0 +1,89 @@
+package fastreq
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_Leak_Detection(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	SetLeakDetection(true)
+	defer SetLeakDetection(false)
+	defer ResetLeaks()
+
+	// the response owns the request created by Get
+	resp, err := client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	resp.Release()
+	require.Empty(t, Leaks())
+
+	// the caller owns the request passed to Do
+	req := NewRequest(GET, "http://make.fasthttp.great")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Release()
+	require.Len(t, Leaks(), 1)
+	require.Equal(t, "Request", Leaks()[0].Kind)
+	require.False(t, Leaks()[0].DoubleRelease)
+	require.Contains(t, Leaks()[0].AcquireStack, "Test_Leak_Detection")
+
+	req.Release()
+	require.Empty(t, Leaks())
+
+	req.Release()
+	leaks := Leaks()
+	require.Len(t, leaks, 1)
+	require.Equal(t, "Request", leaks[0].Kind)
+	require.True(t, leaks[0].DoubleRelease)
+	require.NotEmpty(t, leaks[0].ReleaseStack)
+	require.NotEmpty(t, leaks[0].DoubleReleaseStack)
+	ResetLeaks()
+
+	// failed requests release everything but the request passed to Do
+	req = NewRequest(GET, "http://make.fasthttp.great")
+	_, err = client.Do(req, NewMiddlewares(func(ctx *Ctx) error {
+		if err := ctx.Next(); err != nil {
+			return err
+		}
+		return fasthttp.ErrTimeout
+	}))
+	require.ErrorIs(t, err, fasthttp.ErrTimeout)
+	req.Release()
+	require.Empty(t, Leaks())
+}
+
+func Test_Leak_Ctx_Double_Release(t *testing.T) {
+	SetLeakDetection(true)
+	defer SetLeakDetection(false)
+	defer ResetLeaks()
+
+	ctx := NewCtx()
+	require.Len(t, Leaks(), 1)
+	require.Equal(t, "Ctx", Leaks()[0].Kind)
+
+	ctx.Release()
+	ctx.Release()
+	leaks := Leaks()
+	require.Len(t, leaks, 1)
+	require.Equal(t, "Ctx", leaks[0].Kind)
+	require.True(t, leaks[0].DoubleRelease)
+}
@@ -1,14 +1,151 @@
 package fastreq
 
+import "github.com/valyala/fasthttp"
+
 type Middleware func(ctx *Ctx) error
 
+// Names of the middlewares installed by the Client itself.
+const (
+	MiddlewareNameOauth1        = "oauth1"
+	MiddlewareNameOauth2        = "oauth2"
+	MiddlewareNameBearer        = "bearer"
+	MiddlewareNameAPIKey        = "apikey"
+	MiddlewareNameDigest        = "digest"
+	MiddlewareNameSigV4         = "sigv4"
+	MiddlewareNameHTTPSignature = "httpsig"
+	MiddlewareNameHMAC          = "hmac"
+	MiddlewareNameJWT           = "jwt"
+)
+
+// namedMiddleware is a middleware registered on a Client. Middlewares added by
+// AddMiddleware have an empty name and can not be replaced or removed.
+type namedMiddleware struct {
+	name    string
+	handler Middleware
+}
+
+// Middlewares is a ReqOption which adds middlewares to a single request and skips
+// named middlewares of the Client for it.
+type Middlewares struct {
+	handlers       []Middleware
+	skipped        []string
+	notAutoRelease bool
+}
+
+// NewMiddlewares creates a new Middlewares object. The middlewares are called
+// after the middlewares of the Client, in the order they are provided.
+func NewMiddlewares(middlewares ...Middleware) *Middlewares {
+	return &Middlewares{handlers: middlewares}
+}
+
+// Skip skips the Client middlewares with the given names for the request.
+func (m *Middlewares) Skip(names ...string) *Middlewares {
+	m.skipped = append(m.skipped, names...)
+	return m
+}
+
+// BindRequest binds the Middlewares to a Request object
+func (m *Middlewares) BindRequest(req *Request) error {
+	req.middlewares = append(req.middlewares, m.handlers...)
+	req.skipped = append(req.skipped, m.skipped...)
+	return nil
+}
+
+// Release frees the resources held by Middlewares
+func (m *Middlewares) Release() {
+	m.handlers = nil
+	m.skipped = nil
+	m.notAutoRelease = false
+}
+
+// AutoRelease sets whether Middlewares should be automatically released when the
+// associated object is destroyed.
+func (m *Middlewares) AutoRelease(auto bool) {
+	m.notAutoRelease = !auto
+}
+
+// isAutoRelease returns true if the Middlewares instance is set to auto-release.
+func (m *Middlewares) isAutoRelease() bool {
+	return !m.notAutoRelease
+}
+
 // MiddlewareOauth1 generates a middleware function that adds an OAuth1
 // authorization header to incoming requests. The middleware uses the given
-// Oauth1 object o to generate the header.
+// Oauth1 object o to sign the request.
 func MiddlewareOauth1(o *Oauth1) Middleware {
 	return func(ctx *Ctx) error {
-		auth := o.GenHeader(ctx.Request)
-		ctx.Request.Header.SetBytesV("Authorization", auth)
+		if err := o.Sign(ctx.Request); err != nil {
+			return err
+		}
+		return ctx.Next()
+	}
+}
+
+// MiddlewareOauth2 generates a middleware function that adds the bearer token of
+// o to the requests. If the server responds with 401 Unauthorized, the token is
+// dropped and the request is sent once more with a fresh token.
+func MiddlewareOauth2(o *Oauth2) Middleware {
+	return func(ctx *Ctx) error {
+		token, err := o.Token()
+		if err != nil {
+			return err
+		}
+		ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+token.AccessToken)
+
+		index := ctx.indexMiddleware
+		err = ctx.Next()
+		if err != nil || ctx.Response.StatusCode() != fasthttp.StatusUnauthorized {
+			return err
+		}
+
+		// the token may have been revoked, the 401 response is kept if no fresh
+		// token can be obtained
+		o.invalidate(token)
+		fresh, err := o.Token()
+		if err != nil || fresh.AccessToken == token.AccessToken {
+			return nil
+		}
+		ctx.Response.Release()
+		ctx.Response = nil
+		ctx.indexMiddleware = index
+		ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+fresh.AccessToken)
+		return ctx.Next()
+	}
+}
+
+// MiddlewareBearer generates a middleware function that adds a bearer token to
+// the requests. The token is returned by the given function for every request,
+// so that it can be rotated.
+func MiddlewareBearer(token func() (string, error)) Middleware {
+	return func(ctx *Ctx) error {
+		t, err := token()
+		if err != nil {
+			return err
+		}
+		ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+t)
+		return ctx.Next()
+	}
+}
+
+// APIKeyIn is where MiddlewareAPIKey puts the API key.
+type APIKeyIn int
+
+const (
+	// APIKeyInHeader sends the API key as request header.
+	APIKeyInHeader APIKeyIn = iota
+	// APIKeyInQuery sends the API key as query parameter.
+	APIKeyInQuery
+)
+
+// MiddlewareAPIKey generates a middleware function that adds an API key to the
+// requests, as header or query parameter with the given name.
+func MiddlewareAPIKey(in APIKeyIn, name, key string) Middleware {
+	return func(ctx *Ctx) error {
+		if in == APIKeyInQuery {
+			ctx.Request.URI().QueryArgs().Set(name, key)
+		} else {
+			ctx.Request.Header.Set(name, key)
+		}
 		return ctx.Next()
 	}
 }
@@ -0,0 +1,130 @@
+package fastreq
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func headerMiddleware(value string) Middleware {
+	return func(ctx *Ctx) error {
+		ctx.Request.AddHeader("X-Chain", value)
+		return ctx.Next()
+	}
+}
+
+func Test_Middleware_Named(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			var chain []string
+			for _, v := range ctx.Request.Header.PeekAll("X-Chain") {
+				chain = append(chain, string(v))
+			}
+			_, err := ctx.WriteString(strings.Join(chain, ","))
+			require.NoError(t, err)
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	client.UseMiddleware("first", headerMiddleware("first"))
+	client.AddMiddleware(headerMiddleware("anonymous"))
+	client.UseMiddleware("second", headerMiddleware("second"))
+
+	resp, err := client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "first,anonymous,second", resp.BodyString())
+
+	// replacing keeps the position in the chain
+	client.UseMiddleware("first", headerMiddleware("replaced"))
+	resp, err = client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "replaced,anonymous,second", resp.BodyString())
+
+	require.True(t, client.RemoveMiddleware("second"))
+	require.False(t, client.RemoveMiddleware("second"))
+	resp, err = client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "replaced,anonymous", resp.BodyString())
+
+	// per-request middlewares run after the client middlewares
+	resp, err = client.Get(
+		"http://make.fasthttp.great",
+		NewMiddlewares(headerMiddleware("request")).Skip("first"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "anonymous,request", resp.BodyString())
+
+	resp, err = client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "replaced,anonymous", resp.BodyString())
+}
+
+func Test_Middleware_Oauth1_Replaced(t *testing.T) {
+	client := NewClient()
+	client.SetOauth1(&Oauth1{ConsumerKey: "1"})
+	client.SetOauth1(&Oauth1{ConsumerKey: "2"})
+	require.Len(t, client.middlewares, 1)
+	require.Equal(t, MiddlewareNameOauth1, client.middlewares[0].name)
+}
+
+func Test_Middleware_BearerAPIKey(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			_, err := ctx.WriteString(string(ctx.Request.Header.Peek("Authorization")) + "|" +
+				string(ctx.Request.Header.Peek("X-Api-Key")) + "|" + string(ctx.QueryArgs().Peek("api_key")))
+			require.NoError(t, err)
+		},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	tokens := []string{"first", "second"}
+	client.SetBearer(func() (string, error) {
+		token := tokens[0]
+		tokens = tokens[1:]
+		return token, nil
+	})
+	client.SetAPIKey(APIKeyInHeader, "X-Api-Key", "secret")
+
+	resp, err := client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "Bearer first|secret|", resp.BodyString())
+	resp.Release()
+
+	// the token is requested for every request
+	client.SetAPIKey(APIKeyInQuery, "api_key", "s&cret")
+	resp, err = client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "Bearer second||s&cret", resp.BodyString())
+	resp.Release()
+
+	client.SetBearer(func() (string, error) { return "", errors.New("no token") })
+	_, err = client.Get("http://make.fasthttp.great")
+	require.EqualError(t, err, "no token")
+}
@@ -0,0 +1,400 @@
+package fastreq
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	utls "github.com/refraction-networking/utls"
+	"github.com/valyala/fasthttp"
+)
+
+// HeaderField is a header with its name in the casing it is sent with.
+type HeaderField struct {
+	Key   string
+	Value string
+}
+
+// UserAgent is a User-Agent of a BrowserProfile, with the headers which go
+// along with it, like the sec-ch-ua-platform client hint of Chrome.
+type UserAgent struct {
+	Value   string
+	Headers []HeaderField
+}
+
+// BrowserProfile makes requests look like the ones of a browser. The headers
+// are sent in the order and casing of the browser, with its default headers,
+// and TLS connections are established with its ClientHello. See
+// Client.SetBrowserProfile and NewProfile.
+type BrowserProfile struct {
+	Name string
+	// Headers are the headers of the browser in the order it sends them. The
+	// ones with a value are added to requests which don't have them, the others
+	// only define the position of a header, like Host, Cookie or Content-Length.
+	// Headers the profile doesn't know are sent after the others.
+	//
+	// An Accept-Encoding header lets servers send compressed bodies, see
+	// Response.BodyUncompressed.
+	Headers []HeaderField
+	// UserAgents are the User-Agents of the browser. The first one is sent
+	// unless RotateUserAgents is set, and only to requests without User-Agent.
+	UserAgents []UserAgent
+	// RotateUserAgents sends a random User-Agent of UserAgents with each
+	// request.
+	RotateUserAgents bool
+	// ClientHello is the TLS ClientHello of the browser. The ALPN extension
+	// only offers HTTP/1.1, which is the only protocol of fasthttp. The zero
+	// value keeps the ClientHello of crypto/tls.
+	ClientHello utls.ClientHelloID
+}
+
+// ChromeProfile returns a profile of Chrome 120 on Windows, macOS and Linux.
+func ChromeProfile() *BrowserProfile {
+	const ua = "Mozilla/5.0 (%s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	return &BrowserProfile{
+		Name: "chrome",
+		Headers: []HeaderField{
+			{Key: "Host"},
+			{Key: "Connection", Value: "keep-alive"},
+			{Key: "Content-Length"},
+			{Key: "Cache-Control"},
+			{Key: "sec-ch-ua", Value: `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`},
+			{Key: "sec-ch-ua-mobile", Value: "?0"},
+			{Key: "sec-ch-ua-platform", Value: `"Windows"`},
+			{Key: "Origin"},
+			{Key: "Content-Type"},
+			{Key: "Upgrade-Insecure-Requests", Value: "1"},
+			{Key: "User-Agent"},
+			{Key: "Accept", Value: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{Key: "Sec-Fetch-Site", Value: "none"},
+			{Key: "Sec-Fetch-Mode", Value: "navigate"},
+			{Key: "Sec-Fetch-User", Value: "?1"},
+			{Key: "Sec-Fetch-Dest", Value: "document"},
+			{Key: "Referer"},
+			{Key: "Accept-Encoding", Value: "gzip, deflate, br"},
+			{Key: "Accept-Language", Value: "en-US,en;q=0.9"},
+			{Key: "Cookie"},
+		},
+		UserAgents: []UserAgent{
+			{
+				Value:   fmt.Sprintf(ua, "Windows NT 10.0; Win64; x64"),
+				Headers: []HeaderField{{Key: "sec-ch-ua-platform", Value: `"Windows"`}},
+			},
+			{
+				Value:   fmt.Sprintf(ua, "Macintosh; Intel Mac OS X 10_15_7"),
+				Headers: []HeaderField{{Key: "sec-ch-ua-platform", Value: `"macOS"`}},
+			},
+			{
+				Value:   fmt.Sprintf(ua, "X11; Linux x86_64"),
+				Headers: []HeaderField{{Key: "sec-ch-ua-platform", Value: `"Linux"`}},
+			},
+		},
+		ClientHello: utls.HelloChrome_120,
+	}
+}
+
+// FirefoxProfile returns a profile of Firefox 120 on Windows, macOS and Linux.
+func FirefoxProfile() *BrowserProfile {
+	const ua = "Mozilla/5.0 (%s; rv:120.0) Gecko/20100101 Firefox/120.0"
+	return &BrowserProfile{
+		Name: "firefox",
+		Headers: []HeaderField{
+			{Key: "Host"},
+			{Key: "User-Agent"},
+			{Key: "Accept", Value: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"},
+			{Key: "Accept-Language", Value: "en-US,en;q=0.5"},
+			{Key: "Accept-Encoding", Value: "gzip, deflate, br"},
+			{Key: "Content-Type"},
+			{Key: "Content-Length"},
+			{Key: "Origin"},
+			{Key: "Connection", Value: "keep-alive"},
+			{Key: "Referer"},
+			{Key: "Cookie"},
+			{Key: "Upgrade-Insecure-Requests", Value: "1"},
+			{Key: "Sec-Fetch-Dest", Value: "document"},
+			{Key: "Sec-Fetch-Mode", Value: "navigate"},
+			{Key: "Sec-Fetch-Site", Value: "none"},
+			{Key: "Sec-Fetch-User", Value: "?1"},
+		},
+		UserAgents: []UserAgent{
+			{Value: fmt.Sprintf(ua, "Windows NT 10.0; Win64; x64")},
+			{Value: fmt.Sprintf(ua, "Macintosh; Intel Mac OS X 10.15")},
+			{Value: fmt.Sprintf(ua, "X11; Linux x86_64")},
+		},
+		ClientHello: utls.HelloFirefox_120,
+	}
+}
+
+// SafariProfile returns a profile of Safari 16 on macOS.
+func SafariProfile() *BrowserProfile {
+	return &BrowserProfile{
+		Name: "safari",
+		Headers: []HeaderField{
+			{Key: "Host"},
+			{Key: "Content-Type"},
+			{Key: "Origin"},
+			{Key: "Cookie"},
+			{Key: "Content-Length"},
+			{Key: "Accept", Value: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{Key: "User-Agent"},
+			{Key: "Accept-Language", Value: "en-US,en;q=0.9"},
+			{Key: "Referer"},
+			{Key: "Accept-Encoding", Value: "gzip, deflate, br"},
+			{Key: "Connection", Value: "keep-alive"},
+		},
+		UserAgents: []UserAgent{
+			{Value: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Safari/605.1.15"},
+		},
+		ClientHello: utls.HelloSafari_16_0,
+	}
+}
+
+// SetBrowserProfile makes the requests of the Client look like the ones of a
+// browser, see BrowserProfile. Passing nil disables the profile.
+//
+// The ClientHello of the profile is not used for requests sent by a
+// LoadBalancer. Connections with the ClientHello of a profile keep the root
+// CAs, client certificates and SPKI pins of the TLS config of the Client, but
+// not its other settings like cipher suites and versions.
+func (c *Client) SetBrowserProfile(p *BrowserProfile) {
+	c.profile = p
+}
+
+// profileOf returns the profile of req, which is the one of the request or of
+// the Client.
+func (c *Client) profileOf(req *Request) *BrowserProfile {
+	if req.profileSet {
+		return req.profile
+	}
+	return c.profile
+}
+
+// userAgent returns the User-Agent for the next request, nil if the profile
+// has none.
+func (p *BrowserProfile) userAgent() *UserAgent {
+	switch {
+	case len(p.UserAgents) == 0:
+		return nil
+	case p.RotateUserAgents:
+		return &p.UserAgents[rand.Intn(len(p.UserAgents))] // #nosec G404
+	}
+	return &p.UserAgents[0]
+}
+
+// setDefaults adds the default headers of the profile to the headers req
+// doesn't have.
+func (p *BrowserProfile) setDefaults(req *Request) {
+	var headers []HeaderField
+	if len(req.Header.UserAgent()) == 0 {
+		if ua := p.userAgent(); ua != nil {
+			req.Header.SetUserAgent(ua.Value)
+			headers = ua.Headers
+		}
+	}
+
+	for _, h := range p.Headers {
+		if h.Value == "" || len(req.Header.Peek(h.Key)) > 0 {
+			continue
+		}
+		value := h.Value
+		for _, o := range headers {
+			if strings.EqualFold(o.Key, h.Key) {
+				value = o.Value
+			}
+		}
+		req.Header.Set(h.Key, value)
+	}
+}
+
+// order returns the header names of the profile in order.
+func (p *BrowserProfile) order() []string {
+	order := make([]string, len(p.Headers))
+	for i, h := range p.Headers {
+		order[i] = h.Key
+	}
+	return order
+}
+
+// dialer returns a dial function which establishes TLS connections with the
+// ClientHello of the profile over the connections of dial.
+func (p *BrowserProfile) dialer(dial fasthttp.DialFunc, config *tls.Config) fasthttp.DialFunc {
+	if dial == nil {
+		dial = fasthttp.Dial
+	}
+	return func(addr string) (net.Conn, error) {
+		spec, err := utls.UTLSIdToSpec(p.ClientHello)
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = []string{"http/1.1"}
+			}
+		}
+
+		conn, err := dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		uconfig := utlsConfig(config, addr)
+
+		uconn := utls.UClient(conn, uconfig, utls.HelloCustom)
+		if err := uconn.ApplyPreset(&spec); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		// the handshake runs on the first write, within the deadlines of fasthttp
+		return uconn, nil
+	}
+}
+
+// utlsConfig returns the uTLS config for a connection to addr with the TLS
+// config of the Client, with its certificate authorities, client certificates
+// and verification.
+func utlsConfig(config *tls.Config, addr string) *utls.Config {
+	uconfig := &utls.Config{}
+	if config != nil {
+		uconfig.ServerName = config.ServerName
+	}
+	if uconfig.ServerName == "" {
+		uconfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	if config == nil {
+		return uconfig
+	}
+	uconfig.RootCAs = config.RootCAs
+	uconfig.InsecureSkipVerify = config.InsecureSkipVerify // #nosec G402
+	uconfig.VerifyPeerCertificate = config.VerifyPeerCertificate
+	for i := range config.Certificates {
+		uconfig.Certificates = append(uconfig.Certificates, utlsCertificate(&config.Certificates[i]))
+	}
+	if get := config.GetClientCertificate; get != nil {
+		uconfig.GetClientCertificate = func(info *utls.CertificateRequestInfo) (*utls.Certificate, error) {
+			schemes := make([]tls.SignatureScheme, len(info.SignatureSchemes))
+			for i, scheme := range info.SignatureSchemes {
+				schemes[i] = tls.SignatureScheme(scheme)
+			}
+			cert, err := get(&tls.CertificateRequestInfo{
+				AcceptableCAs:    info.AcceptableCAs,
+				SignatureSchemes: schemes,
+				Version:          info.Version,
+			})
+			if err != nil || cert == nil {
+				return nil, err
+			}
+			ucert := utlsCertificate(cert)
+			return &ucert, nil
+		}
+	}
+	if verify := config.VerifyConnection; verify != nil {
+		// SPKI pins, see Client.SetSPKIPins. uTLS doesn't set the server name
+		// of client connections.
+		serverName := uconfig.ServerName
+		uconfig.VerifyConnection = func(cs utls.ConnectionState) error {
+			return verify(tls.ConnectionState{
+				Version:                     cs.Version,
+				HandshakeComplete:           cs.HandshakeComplete,
+				DidResume:                   cs.DidResume,
+				CipherSuite:                 cs.CipherSuite,
+				NegotiatedProtocol:          cs.NegotiatedProtocol,
+				ServerName:                  serverName,
+				PeerCertificates:            cs.PeerCertificates,
+				VerifiedChains:              cs.VerifiedChains,
+				SignedCertificateTimestamps: cs.SignedCertificateTimestamps,
+				OCSPResponse:                cs.OCSPResponse,
+			})
+		}
+	}
+	return uconfig
+}
+
+// utlsCertificate converts a certificate of crypto/tls to uTLS.
+func utlsCertificate(cert *tls.Certificate) utls.Certificate {
+	ucert := utls.Certificate{
+		Certificate:                 cert.Certificate,
+		PrivateKey:                  cert.PrivateKey,
+		OCSPStaple:                  cert.OCSPStaple,
+		SignedCertificateTimestamps: cert.SignedCertificateTimestamps,
+		Leaf:                        cert.Leaf,
+	}
+	for _, scheme := range cert.SupportedSignatureAlgorithms {
+		ucert.SupportedSignatureAlgorithms = append(ucert.SupportedSignatureAlgorithms, utls.SignatureScheme(scheme))
+	}
+	return ucert
+}
+
+var requestHeaderPool sync.Pool
+
+// orderHeaders rewrites the header of req so that the headers are sent in the
+// given order and casing, followed by the other headers in their order. It
+// returns the original header, which restoreHeaders puts back once the request
+// was sent.
+func orderHeaders(req *fasthttp.Request, order []string) *fasthttp.RequestHeader {
+	saved, _ := requestHeaderPool.Get().(*fasthttp.RequestHeader)
+	if saved == nil {
+		saved = &fasthttp.RequestHeader{}
+	}
+	req.Header.CopyTo(saved)
+
+	// without special headers, fasthttp doesn't write Host and Content-Length
+	host := saved.Host()
+	if len(host) == 0 || !req.UseHostHeader {
+		host = req.URI().Host()
+	}
+	fields := []HeaderField{{Key: fasthttp.HeaderHost, Value: string(host)}}
+	if !req.IsBodyStream() {
+		length := len(req.Body())
+		if length == 0 {
+			length = len(req.PostArgs().QueryString())
+		}
+		if length > 0 || !(saved.IsGet() || saved.IsHead()) {
+			fields = append(fields, HeaderField{Key: fasthttp.HeaderContentLength, Value: strconv.Itoa(length)})
+		}
+	}
+	saved.VisitAll(func(key, value []byte) {
+		// names are not normalized with ordered headers
+		if !strings.EqualFold(string(key), fasthttp.HeaderHost) &&
+			!strings.EqualFold(string(key), fasthttp.HeaderContentLength) {
+			fields = append(fields, HeaderField{Key: string(key), Value: string(value)})
+		}
+	})
+
+	req.Header.Reset()
+	req.Header.SetMethodBytes(saved.Method())
+	req.Header.SetRequestURIBytes(saved.RequestURI())
+	req.Header.SetProtocolBytes(saved.Protocol())
+	if saved.ConnectionClose() {
+		req.Header.SetConnectionClose()
+	}
+	req.Header.DisableNormalizing()
+	req.Header.DisableSpecialHeader()
+
+	sent := make([]bool, len(fields))
+	for _, name := range order {
+		for i := range fields {
+			if !sent[i] && strings.EqualFold(fields[i].Key, name) {
+				req.Header.Add(name, fields[i].Value)
+				sent[i] = true
+			}
+		}
+	}
+	for i := range fields {
+		if !sent[i] {
+			req.Header.Add(fields[i].Key, fields[i].Value)
+		}
+	}
+	return saved
+}
+
+// restoreHeaders puts back the header returned by orderHeaders.
+func restoreHeaders(req *fasthttp.Request, saved *fasthttp.RequestHeader) {
+	// Reset keeps special headers disabled
+	req.Header.EnableSpecialHeader()
+	saved.CopyTo(&req.Header)
+	saved.Reset()
+	requestHeaderPool.Put(saved)
+}
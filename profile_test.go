@@ -0,0 +1,252 @@
+package fastreq
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// rawServer starts a server on an in-memory listener which sends the raw
+// header lines of each request it receives to the returned channel.
+func rawServer(t *testing.T) (*Client, <-chan []string) {
+	ln := fasthttputil.NewInmemoryListener()
+	t.Cleanup(func() { _ = ln.Close() })
+
+	requests := make(chan []string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					var lines []string
+					length := 0
+					for {
+						line, err := br.ReadString('\n')
+						if err != nil {
+							return
+						}
+						line = strings.TrimSuffix(line, "\r\n")
+						if line == "" {
+							break
+						}
+						if k, v, ok := strings.Cut(line, ": "); ok && strings.EqualFold(k, fasthttp.HeaderContentLength) {
+							length, _ = strconv.Atoi(v)
+						}
+						lines = append(lines, line)
+					}
+					if _, err := br.Discard(length); err != nil {
+						return
+					}
+					requests <- lines
+					_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok"))
+				}
+			}()
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	return client, requests
+}
+
+func Test_BrowserProfile_Headers(t *testing.T) {
+	client, requests := rawServer(t)
+	chrome := ChromeProfile()
+	client.SetBrowserProfile(chrome)
+
+	req := NewRequest(POST, "http://make.fasthttp.great/path?q=1")
+	defer req.Release()
+	req.Header.Set("X-Custom", "1")
+	req.Header.SetContentType("text/plain")
+	req.SetBodyString("body")
+	resp, err := client.Do(req, NewCookies("a", "b"))
+	require.NoError(t, err)
+	resp.Release()
+
+	expected := []string{
+		"POST /path?q=1 HTTP/1.1",
+		"Host: make.fasthttp.great",
+		"Connection: keep-alive",
+		"Content-Length: 4",
+		`sec-ch-ua: "Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+		"sec-ch-ua-mobile: ?0",
+		`sec-ch-ua-platform: "Windows"`,
+		"Content-Type: text/plain",
+		"Upgrade-Insecure-Requests: 1",
+		"User-Agent: " + chrome.UserAgents[0].Value,
+		"Accept: " + chrome.Headers[11].Value,
+		"Sec-Fetch-Site: none",
+		"Sec-Fetch-Mode: navigate",
+		"Sec-Fetch-User: ?1",
+		"Sec-Fetch-Dest: document",
+		"Accept-Encoding: gzip, deflate, br",
+		"Accept-Language: en-US,en;q=0.9",
+		"Cookie: a=b",
+		"X-Custom: 1",
+	}
+	require.Equal(t, expected, <-requests)
+
+	// the header of the request is restored after it was sent
+	require.Equal(t, "text/plain", string(req.Header.ContentType()))
+	require.Equal(t, "1", string(req.Header.Peek("x-custom")))
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Release()
+	require.Equal(t, expected, <-requests)
+
+	// the profile of the Client is overridden per request
+	resp, err = client.Get("http://make.fasthttp.great/", NewProfile(SafariProfile()))
+	require.NoError(t, err)
+	resp.Release()
+	lines := <-requests
+	require.Equal(t, "Host: make.fasthttp.great", lines[1])
+	require.Equal(t, "Accept: text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", lines[2])
+	require.Contains(t, lines[3], "Version/16.0 Safari")
+
+	resp, err = client.Get("http://make.fasthttp.great/", NewProfile(nil))
+	require.NoError(t, err)
+	resp.Release()
+	require.Equal(t, []string{"GET / HTTP/1.1", "User-Agent: " + defaultUserAgent, "Host: make.fasthttp.great"}, <-requests)
+}
+
+func Test_BrowserProfile_RotateUserAgents(t *testing.T) {
+	client, requests := rawServer(t)
+	chrome := ChromeProfile()
+	chrome.RotateUserAgents = true
+	client.SetBrowserProfile(chrome)
+
+	platforms := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		resp, err := client.Get("http://make.fasthttp.great/")
+		require.NoError(t, err)
+		resp.Release()
+
+		var ua, platform string
+		for _, line := range <-requests {
+			k, v, _ := strings.Cut(line, ": ")
+			switch k {
+			case "User-Agent":
+				ua = v
+			case "sec-ch-ua-platform":
+				platform = v
+			}
+		}
+		platforms[ua] = platform
+	}
+
+	// the client hints go along with the User-Agent
+	require.Equal(t, map[string]string{
+		chrome.UserAgents[0].Value: `"Windows"`,
+		chrome.UserAgents[1].Value: `"macOS"`,
+		chrome.UserAgents[2].Value: `"Linux"`,
+	}, platforms)
+
+	// requests with a User-Agent keep it
+	resp, err := client.Get("http://make.fasthttp.great/", NewHeaders("User-Agent", "custom"))
+	require.NoError(t, err)
+	resp.Release()
+	require.Contains(t, <-requests, "User-Agent: custom")
+}
+
+func Test_BrowserProfile_ClientHello(t *testing.T) {
+	cert, key, err := fasthttp.GenerateTestCertificate("make.fasthttp.great")
+	require.NoError(t, err)
+	pair, err := tls.X509KeyPair(cert, key)
+	require.NoError(t, err)
+
+	hellos := make(chan *tls.ClientHelloInfo, 4)
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	tlsLn := tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			select {
+			case hellos <- hello:
+			default:
+			}
+			return nil, nil
+		},
+		MinVersion: tls.VersionTLS12,
+	})
+	go func() {
+		_ = fasthttp.Serve(tlsLn, func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(ctx.Request.Header.String())
+		})
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	client.SetBrowserProfile(ChromeProfile())
+
+	resp, err := client.Get("https://make.fasthttp.great/", NewInsecureSkipVerify())
+	require.NoError(t, err)
+	require.Contains(t, resp.BodyString(), "Sec-Fetch-Mode: navigate")
+	resp.Release()
+
+	hello := <-hellos
+	require.Equal(t, "make.fasthttp.great", hello.ServerName)
+	require.Equal(t, []string{"http/1.1"}, hello.SupportedProtos)
+	// Chrome sends GREASE values, crypto/tls never does
+	require.True(t, isGREASE(hello.CipherSuites[0]), hello.CipherSuites)
+
+	// without profile, the ClientHello of crypto/tls is sent
+	resp, err = client.Get("https://make.fasthttp.great/", NewInsecureSkipVerify(), NewProfile(nil))
+	require.NoError(t, err)
+	resp.Release()
+	hello = <-hellos
+	for _, suite := range hello.CipherSuites {
+		require.False(t, isGREASE(suite))
+	}
+
+	// the certificate is still verified
+	_, err = client.Get("https://make.fasthttp.great/")
+	require.Error(t, err)
+}
+
+func Test_BrowserProfile_MutualTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	client := mtlsServer(t, ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client.SetRootCAs(pool)
+	cert, err := LoadClientCertificate(newTestCert(t, "a", ca).write(t, t.TempDir(), "client"))
+	require.NoError(t, err)
+	client.SetClientCertificate(cert)
+	client.SetBrowserProfile(ChromeProfile())
+
+	// the client certificate is sent with the ClientHello of the profile
+	require.Equal(t, "a", get(t, client))
+
+	// and the pins are verified
+	client.SetSPKIPins("localhost", "bm90IHRoZSBwaW4=")
+	_, err = client.Get("https://localhost/")
+	var pinErr *PinMismatchError
+	require.True(t, errors.As(err, &pinErr), err)
+	require.Contains(t, pinErr.Pins, SPKIPin(ca.cert))
+
+	client.SetSPKIPins("localhost", SPKIPin(ca.cert))
+	require.Equal(t, "a", get(t, client))
+}
+
+// isGREASE reports whether v is a GREASE value of RFC 8701.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
@@ -0,0 +1,263 @@
+package fastreq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// connectProxy starts an HTTP CONNECT proxy which answers the tunneled requests
+// itself with the given status code and its name. It returns its address.
+func connectProxy(t *testing.T, name string, status int) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == "\r\n" {
+						break
+					}
+				}
+				_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+				_ = fasthttp.ServeConn(conn, func(ctx *fasthttp.RequestCtx) {
+					ctx.SetStatusCode(status)
+					ctx.SetBodyString(name)
+				})
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// socks5Proxy starts a SOCKS5 proxy which requires the given credentials and
+// answers the tunneled requests itself with the requested address.
+func socks5Proxy(t *testing.T, user, password string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	readString := func(r io.Reader) string {
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return ""
+		}
+		b := make([]byte, n[0])
+		_, _ = io.ReadFull(r, b)
+		return string(b)
+	}
+	handshake := func(conn net.Conn) (string, bool) {
+		// greeting, the client must offer username/password authentication
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return "", false
+		}
+		methods := make([]byte, header[1])
+		if _, err := io.ReadFull(conn, methods); err != nil || !strings.Contains(string(methods), "\x02") {
+			_, _ = conn.Write([]byte{5, 0xff})
+			return "", false
+		}
+		_, _ = conn.Write([]byte{5, 2})
+
+		// RFC 1929 username/password authentication
+		version := make([]byte, 1)
+		if _, err := io.ReadFull(conn, version); err != nil {
+			return "", false
+		}
+		if readString(conn) != user || readString(conn) != password {
+			_, _ = conn.Write([]byte{1, 1})
+			return "", false
+		}
+		_, _ = conn.Write([]byte{1, 0})
+
+		// CONNECT request with a domain name or an IPv4 address
+		request := make([]byte, 4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return "", false
+		}
+		var host string
+		switch request[3] {
+		case 3:
+			host = readString(conn)
+		case 1:
+			ip := make([]byte, 4)
+			_, _ = io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		}
+		port := make([]byte, 2)
+		if _, err := io.ReadFull(conn, port); err != nil {
+			return "", false
+		}
+		_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				addr, ok := handshake(conn)
+				if !ok {
+					return
+				}
+				_ = fasthttp.ServeConn(conn, func(ctx *fasthttp.RequestCtx) {
+					ctx.SetBodyString("socks5 " + addr)
+				})
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// proxied sends a request and returns the response body and the proxy it was
+// sent through.
+func proxied(t *testing.T, client *Client, url string, opts ...ReqOption) (string, string) {
+	resp, err := client.Get(url, opts...)
+	require.NoError(t, err)
+	defer resp.Release()
+	proxy, _ := ValueOf[string](resp, ValueProxy)
+	return string(resp.Body()), proxy
+}
+
+func Test_ProxyPool_RoundRobin(t *testing.T) {
+	a, b := connectProxy(t, "a", fasthttp.StatusOK), connectProxy(t, "b", fasthttp.StatusTooManyRequests)
+	pool, err := NewProxyPool(&ProxyPoolConfig{
+		Proxies:  []string{"user:secret@" + a, "http://" + b},
+		MaxFails: 1,
+	})
+	require.NoError(t, err)
+
+	client := NewClient()
+	client.SetProxyPool(pool)
+
+	body, proxy := proxied(t, client, "http://make.fasthttp.great/")
+	require.Equal(t, "a", body)
+	require.Equal(t, "http://user:xxxxx@"+a, proxy)
+
+	// the banned proxy is ejected after its first failure
+	body, proxy = proxied(t, client, "http://make.fasthttp.great/")
+	require.Equal(t, "b", body)
+	require.Equal(t, "http://"+b, proxy)
+	for i := 0; i < 3; i++ {
+		body, _ = proxied(t, client, "http://make.fasthttp.great/")
+		require.Equal(t, "a", body)
+	}
+	require.Equal(t, []ProxyStatus{
+		{Proxy: "http://user:xxxxx@" + a, Healthy: true},
+		{Proxy: "http://" + b, Healthy: false},
+	}, pool.Status())
+
+	// requests without a pool record the proxy of the Client
+	client.SetProxyPool(nil)
+	client.SetHTTPProxy(a)
+	body, proxy = proxied(t, client, "http://make.fasthttp.great/")
+	require.Equal(t, "a", body)
+	require.Equal(t, "http://"+a, proxy)
+
+	_, err = NewProxyPool(&ProxyPoolConfig{})
+	require.Error(t, err)
+	_, err = NewProxyPool(&ProxyPoolConfig{Proxies: []string{"ftp://" + a}})
+	require.ErrorContains(t, err, "unsupported proxy scheme")
+}
+
+func Test_ProxyPool_Random(t *testing.T) {
+	a, b := connectProxy(t, "a", fasthttp.StatusOK), connectProxy(t, "b", fasthttp.StatusOK)
+	pool, err := NewProxyPool(&ProxyPoolConfig{
+		Proxies:       []string{a, b},
+		Strategy:      ProxyRandom,
+		EjectDuration: time.Minute,
+	})
+	require.NoError(t, err)
+
+	client := NewClient()
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		body, _ := proxied(t, client, "http://make.fasthttp.great/", NewProxyFromPool(pool))
+		seen[body] = true
+	}
+	require.Equal(t, map[string]bool{"a": true, "b": true}, seen)
+
+	// requests without the option are not proxied
+	client.Dial = func(addr string) (net.Conn, error) {
+		return nil, errors.New("dialed " + addr)
+	}
+	_, err = client.Get("http://make.fasthttp.great/")
+	require.ErrorContains(t, err, "dialed make.fasthttp.great:80")
+}
+
+func Test_Client_SetProxyRules(t *testing.T) {
+	a, b, c := connectProxy(t, "a", fasthttp.StatusOK), connectProxy(t, "b", fasthttp.StatusOK),
+		connectProxy(t, "c", fasthttp.StatusOK)
+	pool, err := NewProxyPool(&ProxyPoolConfig{Proxies: []string{b}})
+	require.NoError(t, err)
+	fallback, err := NewProxyPool(&ProxyPoolConfig{Proxies: []string{c}})
+	require.NoError(t, err)
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return nil, errors.New("dialed " + addr)
+	}
+	client.SetProxyPool(fallback)
+	require.NoError(t, client.SetProxyRules(
+		ProxyRule{Host: "*.a.great", Proxy: a},
+		ProxyRule{Host: "b.great", Pool: pool},
+		ProxyRule{Host: "direct.great"},
+	))
+
+	for url, want := range map[string]string{
+		"http://www.A.great:8080/": "a",
+		"http://b.great/":          "b",
+		"http://other.great/":      "c",
+	} {
+		body, _ := proxied(t, client, url)
+		require.Equal(t, want, body, url)
+	}
+
+	// the proxy of the request takes precedence
+	body, _ := proxied(t, client, "http://b.great/", NewProxy(a))
+	require.Equal(t, "a", body)
+
+	// hosts without proxy are dialed directly
+	_, err = client.Get("http://direct.great/")
+	require.ErrorContains(t, err, "dialed direct.great:80")
+
+	require.Error(t, client.SetProxyRules(ProxyRule{Host: "[", Proxy: a}))
+	require.Error(t, client.SetProxyRules(ProxyRule{Host: "*", Proxy: "ftp://" + a}))
+}
+
+func Test_Proxy_Socks5Auth(t *testing.T) {
+	addr := socks5Proxy(t, "user", "p@ss")
+	client := NewClient()
+
+	body, proxy := proxied(t, client, "http://make.fasthttp.great/", NewProxy("socks5://user:p%40ss@"+addr))
+	require.Equal(t, "socks5 make.fasthttp.great:80", body)
+	require.Equal(t, "socks5://user:xxxxx@"+addr, proxy)
+
+	_, err := client.Get("http://make.fasthttp.great/", NewProxy("socks5://user:wrong@"+addr))
+	require.Error(t, err)
+}
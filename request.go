@@ -15,22 +15,41 @@ type Request struct {
 	*fasthttp.Request
 	mw           *multipart.Writer
 	formFilesNum int
+	hooks        *Hooks
+	middlewares  []Middleware
+	skipped      []string
+	// per-request transport settings, see Client.transport
+	proxy              string
+	proxyPool          *ProxyPool
+	insecureSkipVerify bool
+	// profile overrides the profile of the Client if profileSet
+	profile    *BrowserProfile
+	profileSet bool
+	// headerOrder are the names of the headers in the order they were set, in
+	// their original casing; they are sent in this order if orderedHeaders
+	headerOrder    []string
+	orderedHeaders bool
+	// idempotent marks requests which can safely be sent more than once
+	idempotent bool
 }
 
 // NewRequest creates a new HTTP request with the given method and URL.
 func NewRequest(method HTTPMethod, url string) *Request {
-	req := &Request{Request: fasthttp.AcquireRequest()}
+	req := NewRequestFromFastHTTP(fasthttp.AcquireRequest())
 	req.SetMethod(method)
 	req.SetRequestURI(url)
 	return req
 }
 
 // NewRequestFromFastHTTP returns a new Request object created from the given
-// fasthttp.Request object.
+// fasthttp.Request object. The Request takes over the ownership of req, which is
+// released together with it.
 func NewRequestFromFastHTTP(req *fasthttp.Request) *Request {
-	return &Request{
+	r := &Request{
 		Request: req,
 	}
+	trackAcquire(r)
+	return r
 }
 
 // SetHost sets the host of the request
@@ -77,21 +96,25 @@ func (r *Request) SetContentType(contentType string) {
 	r.Header.SetContentType(contentType)
 }
 
-// SetHeaders sets the headers of a request object with key-value pairs.
+// SetHeaders sets the headers of a request object with key-value pairs. With
+// ordered headers, they are sent in the given order and casing, see
+// NewOrderedHeaders.
 func (r *Request) SetHeaders(kv ...string) {
 	for i := 1; i < len(kv); i += 2 {
-		r.Header.Set(kv[i-1], kv[i])
+		r.SetHeader(kv[i-1], kv[i])
 	}
 }
 
 // SetHeader sets the header with the given key-value pair in the HTTP request.
 func (r *Request) SetHeader(k, v string) {
 	r.Header.Set(k, v)
+	r.headerOrder = append(r.headerOrder, k)
 }
 
 // AddHeader adds a header to the request.
 func (r *Request) AddHeader(k, v string) {
 	r.Header.Add(k, v)
+	r.headerOrder = append(r.headerOrder, k)
 }
 
 // SetCookies sets the cookies of the request
@@ -150,6 +173,18 @@ func (r *Request) SetBoundary(boundary string) error {
 	return r.mw.SetBoundary(boundary)
 }
 
+// closeMultipart completes the multipart body of the request, if any, so that
+// it is sent as it is. Retries of the request must not complete it again.
+func (r *Request) closeMultipart() error {
+	if r.mw == nil {
+		return nil
+	}
+	r.Header.SetMultipartFormBoundary(r.mw.Boundary())
+	err := r.mw.Close()
+	r.mw = nil
+	return err
+}
+
 // AddMFField writes a form field to a multipart request. If the request's
 // multipart writer is not initialized, it initializes it before writing the
 // field.
@@ -177,11 +212,21 @@ func (r *Request) AddMFFile(fieldName, filePath string) error {
 		return err
 	}
 
+	return r.AddMFFileBytes(fieldName, filepath.Base(filePath), content)
+}
+
+// AddMFFileBytes adds a multipart/form-data file with the given file name and
+// content to the request body.
+func (r *Request) AddMFFileBytes(fieldName, fileName string, content []byte) error {
+	if r.mw == nil {
+		r.mw = multipart.NewWriter(r.BodyWriter())
+	}
+
 	if fieldName == "" { // default field name
 		fieldName = "file" + strconv.Itoa(r.formFilesNum+1)
 	}
 
-	w, err := r.mw.CreateFormFile(fieldName, filepath.Base(filePath))
+	w, err := r.mw.CreateFormFile(fieldName, fileName)
 	if err != nil {
 		return err
 	}
@@ -193,18 +238,61 @@ func (r *Request) AddMFFile(fieldName, filePath string) error {
 	return nil
 }
 
-// Copy returns a new instance of the Request struct with the same values as r.
+// Copy returns a new instance of the Request struct with the same values as r,
+// including its proxy, TLS and browser profile settings and the idempotent mark.
 // The returned value should be properly released to the pool via Release() when no
 // longer needed.
 func (r *Request) Copy() *Request {
 	req := fasthttp.AcquireRequest()
 	r.CopyTo(req)
 
-	return NewRequestFromFastHTTP(req)
+	c := NewRequestFromFastHTTP(req)
+	c.proxy = r.proxy
+	c.proxyPool = r.proxyPool
+	c.insecureSkipVerify = r.insecureSkipVerify
+	c.profile = r.profile
+	c.profileSet = r.profileSet
+	c.headerOrder = append(c.headerOrder, r.headerOrder...)
+	c.orderedHeaders = r.orderedHeaders
+	c.idempotent = r.idempotent
+	return c
 }
 
 // Release frees the resources associated with the Request object.
+// A Request must be released exactly once, it must not be used afterwards.
 func (r *Request) Release() {
+	if r.Request == nil {
+		trackDoubleRelease(r)
+		return
+	}
+	trackRelease(r)
+
 	fasthttp.ReleaseRequest(r.Request)
+	r.Request = nil
 	r.mw = nil
+	r.hooks = nil
+	r.middlewares = nil
+	r.skipped = nil
+	r.proxy = ""
+	r.proxyPool = nil
+	r.insecureSkipVerify = false
+	r.profile = nil
+	r.profileSet = false
+	r.headerOrder = r.headerOrder[:0]
+	r.orderedHeaders = false
+	r.idempotent = false
+}
+
+// isMiddlewareSkipped reports whether the named client middleware is skipped
+// for this request.
+func (r *Request) isMiddlewareSkipped(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, s := range r.skipped {
+		if s == name {
+			return true
+		}
+	}
+	return false
 }
@@ -3,10 +3,13 @@ package fastreq
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/tidwall/gjson"
@@ -16,15 +19,25 @@ import (
 // Response represents an HTTP response.
 type Response struct {
 	*fasthttp.Response
-	Request *fasthttp.Request
-	dom     *goquery.Document
+	// Request is the request which produced the response. It is only valid as
+	// long as the request has not been released.
+	Request      *fasthttp.Request
+	ownedRequest *Request
+	dom          *goquery.Document
+	values       []keyValue
 }
 
 // NewResponse initializes and returns a new Response object.
 func NewResponse() *Response {
-	return &Response{
-		Response: fasthttp.AcquireResponse(),
-	}
+	return newResponse(fasthttp.AcquireResponse())
+}
+
+// newResponse wraps the given fasthttp.Response, which is owned by the Response
+// from now on.
+func newResponse(resp *fasthttp.Response) *Response {
+	r := &Response{Response: resp}
+	trackAcquire(r)
+	return r
 }
 
 // BodyString returns the response body as a string.
@@ -82,12 +95,19 @@ func (r *Response) Dom() (*goquery.Document, error) {
 	return r.dom, nil
 }
 
+// Value returns the value stored under the given key by the middlewares which
+// handled the request, or nil if there is none.
+func (r *Response) Value(key string) any {
+	return getValue(r.values, key)
+}
+
 // Copy creates a new Response instance that is a copy of the current one.
 func (r *Response) Copy() *Response {
-	resp := fasthttp.AcquireResponse()
-	r.CopyTo(resp)
+	resp := newResponse(fasthttp.AcquireResponse())
+	r.CopyTo(resp.Response)
+	resp.values = append(resp.values, r.values...)
 
-	return &Response{Response: resp}
+	return resp
 }
 
 // FileName extracts the filename from the Content-Disposition header in the
@@ -114,12 +134,21 @@ func (r *Response) FileName() string {
 }
 
 // Saves the response body to a file at the given path with the given filename.
+// Without filename, the file name of the Content-Disposition header is used,
+// which must not contain a path.
 func (r *Response) SaveToFile(path, filename string) error {
 	if filename == "" {
 		filename = r.FileName()
+		if filename == "" {
+			return errors.New("fastreq: no file name to save the response to")
+		}
+		// the name is chosen by the server, it must not leave path
+		if strings.ContainsAny(filename, `/\`) || filename == "." || filename == ".." {
+			return fmt.Errorf("fastreq: invalid file name %q in the Content-Disposition", filename)
+		}
 	}
 
-	file, err := os.OpenFile(filepath.Join(path, filename), os.O_WRONLY|os.O_CREATE, 0664)
+	file, err := os.OpenFile(filepath.Join(path, filename), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 	if err != nil {
 		return err
 	}
@@ -137,11 +166,26 @@ func (r *Response) SaveToFile(path, filename string) error {
 	return nil
 }
 
-// Release releases the resources associated with the Response by releasing both
-// the Request and Response objects.
+// Release releases the resources associated with the Response. The request which
+// produced it is released as well if it was created by the Client itself, as done
+// by Client.Get and the other helpers. Requests passed to Client.Do are owned by
+// the caller and are never released here.
+//
+// A Response must be released exactly once, it must not be used afterwards.
 func (r *Response) Release() {
-	if r.Request != nil {
-		fasthttp.ReleaseRequest(r.Request)
+	if r.Response == nil {
+		trackDoubleRelease(r)
+		return
+	}
+	trackRelease(r)
+
+	if r.ownedRequest != nil {
+		r.ownedRequest.Release()
+		r.ownedRequest = nil
 	}
 	fasthttp.ReleaseResponse(r.Response)
+	r.Response = nil
+	r.Request = nil
+	r.dom = nil
+	r.values = resetValues(r.values)
 }
@@ -0,0 +1,390 @@
+package fastreq
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Payload hashes of SigV4 for bodies which are not hashed as a whole.
+const (
+	SigV4UnsignedPayload  = "UNSIGNED-PAYLOAD"
+	SigV4StreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4DateFormat = "20060102"
+	// sigV4EmptyHash is the SHA-256 hash of an empty payload.
+	sigV4EmptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// sigV4IgnoredHeaders are request headers which are not signed, because they are
+// changed on the way to the server.
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"content-length":    true,
+	"connection":        true,
+	"expect":            true,
+	"transfer-encoding": true,
+	"x-amzn-trace-id":   true,
+}
+
+// AWSCredentials are the credentials requests are signed with by a SigV4Signer.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is sent as X-Amz-Security-Token for temporary credentials.
+	SessionToken string
+	// Expires is the time temporary credentials expire.
+	Expires time.Time
+}
+
+// StaticAWSCredentials returns a credentials provider for fixed credentials.
+func StaticAWSCredentials(accessKeyID, secretAccessKey, sessionToken string) func() (*AWSCredentials, error) {
+	creds := &AWSCredentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey, SessionToken: sessionToken}
+	return func() (*AWSCredentials, error) {
+		return creds, nil
+	}
+}
+
+// RefreshingAWSCredentials returns a credentials provider which caches the
+// credentials returned by fetch, and fetches new ones 5 minutes before they
+// expire. Concurrent calls wait for a single fetch.
+func RefreshingAWSCredentials(fetch func() (*AWSCredentials, error)) func() (*AWSCredentials, error) {
+	var (
+		mu    sync.Mutex
+		creds *AWSCredentials
+	)
+	return func() (*AWSCredentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if creds != nil && (creds.Expires.IsZero() || time.Now().Add(5*time.Minute).Before(creds.Expires)) {
+			return creds, nil
+		}
+		c, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		creds = c
+		return creds, nil
+	}
+}
+
+// SigV4Signer signs requests with AWS Signature Version 4.
+type SigV4Signer struct {
+	Region  string
+	Service string
+	// Credentials returns the credentials for each request, see
+	// StaticAWSCredentials and RefreshingAWSCredentials.
+	Credentials func() (*AWSCredentials, error)
+	// UnsignedPayload does not hash the body, but signs it as UNSIGNED-PAYLOAD,
+	// which S3 allows.
+	UnsignedPayload bool
+	// ChunkSize sends the body in signed chunks of the given size, using the
+	// aws-chunked content encoding of S3. 0 sends the body as usual.
+	ChunkSize int
+}
+
+// MiddlewareSigV4 generates a middleware function that signs the requests with
+// AWS Signature Version 4. The middleware should be the last one which changes
+// the requests.
+func MiddlewareSigV4(s *SigV4Signer) Middleware {
+	return func(ctx *Ctx) error {
+		if err := s.Sign(ctx.Request, time.Now()); err != nil {
+			return err
+		}
+		return ctx.Next()
+	}
+}
+
+// Sign sets the Authorization header of req, signed at the given time. With a
+// ChunkSize, the body is replaced with its signed chunks.
+func (s *SigV4Signer) Sign(req *Request, t time.Time) error {
+	creds, err := s.credentials()
+	if err != nil {
+		return err
+	}
+	t = t.UTC()
+
+	req.Header.Del(fasthttp.HeaderAuthorization)
+	req.Header.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	chunked := s.ChunkSize > 0
+	var payloadHash string
+	switch {
+	case chunked:
+		payloadHash = SigV4StreamingPayload
+		length := len(req.Body())
+		req.Header.Set(fasthttp.HeaderContentEncoding, "aws-chunked")
+		req.Header.Set("X-Amz-Decoded-Content-Length", strconv.Itoa(length))
+		req.Header.Set(fasthttp.HeaderContentLength, strconv.Itoa(sigV4ChunkedLength(length, s.ChunkSize)))
+	case s.UnsignedPayload:
+		payloadHash = SigV4UnsignedPayload
+	default:
+		payloadHash = sigV4Hash(req.Body())
+	}
+	if chunked || s.UnsignedPayload || s.Service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	canonical, signedHeaders := s.canonicalRequest(req, payloadHash, chunked)
+	scope := s.scope(t)
+	key := s.signingKey(creds, t)
+	signature := hex.EncodeToString(sigV4HMAC(key, s.stringToSign(t, scope, canonical)))
+
+	req.Header.Set(fasthttp.HeaderAuthorization, fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+
+	if chunked {
+		req.SetBody(s.chunkBody(req.Body(), key, t, scope, signature))
+	}
+	return nil
+}
+
+// Presign returns the URL of req with the signature in the query, which can be
+// used without further credentials until it expires. Only the host header is
+// signed, and the payload is unsigned.
+func (s *SigV4Signer) Presign(req *Request, expires time.Duration, t time.Time) (string, error) {
+	creds, err := s.credentials()
+	if err != nil {
+		return "", err
+	}
+	t = t.UTC()
+	scope := s.scope(t)
+
+	u := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(u)
+	req.URI().CopyTo(u)
+
+	query := u.QueryArgs()
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", t.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	canonical := strings.Join([]string{
+		strings.ToUpper(string(req.Header.Method())),
+		s.canonicalPath(u),
+		sigV4CanonicalQuery(query),
+		"host:" + canonicalHost(u) + "\n",
+		"host",
+		SigV4UnsignedPayload,
+	}, "\n")
+	signature := hex.EncodeToString(sigV4HMAC(s.signingKey(creds, t), s.stringToSign(t, scope, canonical)))
+
+	// the query is rebuilt, as fasthttp encodes it differently
+	return string(u.Scheme()) + "://" + string(u.Host()) + sigV4RequestPath(u) + "?" +
+		sigV4CanonicalQuery(query) + "&X-Amz-Signature=" + signature, nil
+}
+
+// canonicalRequest returns the canonical request and the signed headers, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html.
+func (s *SigV4Signer) canonicalRequest(req *Request, payloadHash string, signLength bool) (string, string) {
+	headers := map[string][]string{"host": {canonicalHost(req.URI())}}
+	req.Header.VisitAll(func(key, value []byte) {
+		name := strings.ToLower(string(key))
+		if name == "host" || sigV4IgnoredHeaders[name] {
+			return
+		}
+		headers[name] = append(headers[name], strings.Join(strings.Fields(string(value)), " "))
+	})
+	if signLength {
+		// fasthttp does not visit the content length
+		headers["content-length"] = []string{string(req.Header.Peek(fasthttp.HeaderContentLength))}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name)
+		canonicalHeaders.WriteByte(':')
+		canonicalHeaders.WriteString(strings.Join(headers[name], ","))
+		canonicalHeaders.WriteByte('\n')
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	return strings.Join([]string{
+		strings.ToUpper(string(req.Header.Method())),
+		s.canonicalPath(req.URI()),
+		sigV4CanonicalQuery(req.URI().QueryArgs()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n"), signedHeaders
+}
+
+// canonicalPath returns the URI encoded path. For all services but S3, the path
+// is encoded as it is sent, so that it is encoded twice.
+func (s *SigV4Signer) canonicalPath(u *fasthttp.URI) string {
+	if s.Service == "s3" {
+		return sigV4EscapePath(string(u.Path()))
+	}
+	return sigV4EscapePath(sigV4RequestPath(u))
+}
+
+// sigV4RequestPath returns the path of u as it is sent, which fasthttp encodes
+// in its own way.
+func sigV4RequestPath(u *fasthttp.URI) string {
+	path, _, _ := strings.Cut(string(u.RequestURI()), "?")
+	return path
+}
+
+// sigV4EscapePath URI encodes the segments of a path.
+func sigV4EscapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = escapeRFC3986(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// scope returns the credential scope of a signature at the given time.
+func (s *SigV4Signer) scope(t time.Time) string {
+	return t.Format(sigV4DateFormat) + "/" + s.Region + "/" + s.Service + "/aws4_request"
+}
+
+// stringToSign returns the string which is signed for a canonical request.
+func (s *SigV4Signer) stringToSign(t time.Time, scope, canonical string) string {
+	return sigV4Algorithm + "\n" + t.Format(sigV4TimeFormat) + "\n" + scope + "\n" + sigV4Hash([]byte(canonical))
+}
+
+// signingKey derives the signing key of the credentials for the day of t.
+func (s *SigV4Signer) signingKey(creds *AWSCredentials, t time.Time) []byte {
+	key := sigV4HMAC([]byte("AWS4"+creds.SecretAccessKey), t.Format(sigV4DateFormat))
+	key = sigV4HMAC(key, s.Region)
+	key = sigV4HMAC(key, s.Service)
+	return sigV4HMAC(key, "aws4_request")
+}
+
+// chunkBody encodes the body in signed chunks, each signature chaining to the
+// one before, starting with the signature of the request.
+func (s *SigV4Signer) chunkBody(body, key []byte, t time.Time, scope, signature string) []byte {
+	var b bytes.Buffer
+	b.Grow(sigV4ChunkedLength(len(body), s.ChunkSize))
+	for {
+		n := len(body)
+		if n > s.ChunkSize {
+			n = s.ChunkSize
+		}
+		chunk := body[:n]
+		body = body[n:]
+
+		stringToSign := strings.Join([]string{
+			sigV4Algorithm + "-PAYLOAD",
+			t.Format(sigV4TimeFormat),
+			scope,
+			signature,
+			sigV4EmptyHash,
+			sigV4Hash(chunk),
+		}, "\n")
+		signature = hex.EncodeToString(sigV4HMAC(key, stringToSign))
+
+		b.WriteString(strconv.FormatInt(int64(len(chunk)), 16))
+		b.WriteString(";chunk-signature=")
+		b.WriteString(signature)
+		b.WriteString("\r\n")
+		b.Write(chunk)
+		b.WriteString("\r\n")
+		if len(chunk) == 0 {
+			return b.Bytes()
+		}
+	}
+}
+
+// sigV4ChunkedLength returns the length of a body of the given length encoded
+// in signed chunks.
+func sigV4ChunkedLength(length, chunkSize int) int {
+	// hex length, ";chunk-signature=", 64 hex digits signature and two CRLFs
+	chunkLength := func(n int) int {
+		return len(strconv.FormatInt(int64(n), 16)) + 17 + 64 + 4 + n
+	}
+	total := (length / chunkSize) * chunkLength(chunkSize)
+	if rest := length % chunkSize; rest > 0 {
+		total += chunkLength(rest)
+	}
+	return total + chunkLength(0)
+}
+
+// canonicalHost returns the lower case host of the URI, without a default port.
+func canonicalHost(u *fasthttp.URI) string {
+	host := strings.ToLower(string(u.Host()))
+	switch string(u.Scheme()) {
+	case "http":
+		return strings.TrimSuffix(host, ":80")
+	case "https":
+		return strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// sigV4CanonicalQuery returns the query sorted by the encoded names and values.
+func sigV4CanonicalQuery(args *fasthttp.Args) string {
+	var params [][2]string
+	args.VisitAll(func(key, value []byte) {
+		params = append(params, [2]string{escapeRFC3986(string(key)), escapeRFC3986(string(value))})
+	})
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+
+	var b strings.Builder
+	for i, p := range params {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(p[0])
+		b.WriteByte('=')
+		b.WriteString(p[1])
+	}
+	return b.String()
+}
+
+func sigV4Hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func sigV4HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *SigV4Signer) credentials() (*AWSCredentials, error) {
+	if s.Credentials == nil {
+		return nil, errors.New("fastreq: SigV4Signer without credentials")
+	}
+	return s.Credentials()
+}
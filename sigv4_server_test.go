@@ -0,0 +1,64 @@
+package fastreq_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/wnanbei/fastreq"
+	"github.com/wnanbei/fastreq/fastreqtest"
+)
+
+func Test_MiddlewareSigV4(t *testing.T) {
+	s := &fastreq.SigV4Signer{
+		Region:      "us-east-1",
+		Service:     "service",
+		Credentials: fastreq.StaticAWSCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", ""),
+	}
+
+	// verify the signature by signing the signed parts of the received request again
+	verify := func(ctx *fasthttp.RequestCtx) {
+		req := fastreq.NewRequest(fastreq.HTTPMethod(ctx.Method()), "http://"+string(ctx.Host())+string(ctx.RequestURI()))
+		defer req.Release()
+		auth := string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+		_, signed, _ := strings.Cut(auth, "SignedHeaders=")
+		signed, _, _ = strings.Cut(signed, ",")
+		for _, name := range strings.Split(signed, ";") {
+			if name != "host" {
+				req.SetHeader(name, string(ctx.Request.Header.Peek(name)))
+			}
+		}
+		req.SetBody(ctx.PostBody())
+		date, err := time.Parse("20060102T150405Z", string(ctx.Request.Header.Peek("X-Amz-Date")))
+		require.NoError(t, err)
+		require.NoError(t, s.Sign(req, date))
+
+		if string(req.Header.Peek(fasthttp.HeaderAuthorization)) != auth {
+			ctx.SetStatusCode(fasthttp.StatusForbidden)
+		}
+	}
+	srv := fastreqtest.NewServer(t)
+	srv.On(fastreq.POST, "/path").WithQuery("a", "1").Once().Handle(verify)
+	srv.On(fastreq.POST, "/upload").Once().Handle(verify)
+
+	client := srv.Client()
+	client.SetSigV4(s)
+
+	resp, err := client.Post("http://make.fasthttp.great/path?b=2&a=1", fastreq.NewBody([]byte("body")),
+		fastreq.NewHeaders("Content-Type", "text/plain", "X-Custom", "value"))
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	require.Contains(t, string(resp.Request.Header.Peek(fasthttp.HeaderAuthorization)),
+		"SignedHeaders=content-type;host;x-amz-date;x-custom,")
+	resp.Release()
+
+	// the multipart body is signed as it is sent
+	mf := fastreq.NewMultipartForm("fastreq", "foo", "bar")
+	mf.AddFile("txt", "file.txt", []byte("fastreq"))
+	resp, err = client.Post("http://make.fasthttp.great/upload", mf)
+	require.NoError(t, err)
+	require.Equal(t, fasthttp.StatusOK, resp.StatusCode())
+	resp.Release()
+}
@@ -0,0 +1,237 @@
+package fastreq
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientCertificate is a client certificate for mutual TLS, loaded from files
+// which are reloaded once they change on disk. A new certificate is used for
+// the connections established after the change.
+type ClientCertificate struct {
+	files []string
+	load  func() (*tls.Certificate, error)
+
+	mu     sync.Mutex
+	cert   *tls.Certificate
+	stamps []fileStamp
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// LoadClientCertificate loads a client certificate and its private key from PEM
+// files. The certificate file may contain the intermediate certificates after
+// the certificate.
+func LoadClientCertificate(certFile, keyFile string) (*ClientCertificate, error) {
+	return newClientCertificate([]string{certFile, keyFile}, func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		return &cert, err
+	})
+}
+
+// LoadClientCertificatePKCS12 loads a client certificate, its private key and
+// the intermediate certificates from a PKCS #12 file.
+func LoadClientCertificatePKCS12(file, password string) (*ClientCertificate, error) {
+	return newClientCertificate([]string{file}, func() (*tls.Certificate, error) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+		if err != nil {
+			return nil, fmt.Errorf("fastreq: decode %s: %w", file, err)
+		}
+		cert := &tls.Certificate{PrivateKey: key, Leaf: leaf, Certificate: [][]byte{leaf.Raw}}
+		for _, c := range chain {
+			cert.Certificate = append(cert.Certificate, c.Raw)
+		}
+		return cert, nil
+	})
+}
+
+func newClientCertificate(files []string, load func() (*tls.Certificate, error)) (*ClientCertificate, error) {
+	c := &ClientCertificate{files: files, load: load}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the certificate from the files again. On error, the certificate
+// loaded before is kept.
+func (c *ClientCertificate) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reload(c.stat())
+}
+
+func (c *ClientCertificate) reload(stamps []fileStamp) error {
+	cert, err := c.load()
+	if err != nil {
+		return err
+	}
+	c.cert = cert
+	c.stamps = stamps
+	return nil
+}
+
+// stat returns the stamps of the files, zero for files which can't be read.
+func (c *ClientCertificate) stat() []fileStamp {
+	stamps := make([]fileStamp, len(c.files))
+	for i, file := range c.files {
+		if fi, err := os.Stat(file); err == nil {
+			stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// Certificate returns the current certificate, reloading it first if the files
+// changed. While the files can't be loaded, for example because only one of
+// them was replaced yet, the certificate loaded before is returned.
+func (c *ClientCertificate) Certificate() *tls.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stamps := c.stat()
+	for i := range stamps {
+		if stamps[i] != c.stamps[i] {
+			_ = c.reload(stamps)
+			break
+		}
+	}
+	return c.cert
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate.
+func (c *ClientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.Certificate(), nil
+}
+
+// LoadCertPool returns a pool with the certificates of the PEM files, in
+// addition to the system certificates if withSystem is set.
+func LoadCertPool(withSystem bool, files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if withSystem {
+		var err error
+		if pool, err = x509.SystemCertPool(); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("fastreq: no certificates in %s", file)
+		}
+	}
+	return pool, nil
+}
+
+// SPKIPin returns the pin of the public key of a certificate, the base64
+// encoded SHA-256 hash of its SubjectPublicKeyInfo, as used by HPKP.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PinMismatchError is returned for TLS connections to hosts with pinned
+// public keys, if no certificate of the chain has one of them.
+type PinMismatchError struct {
+	Host string
+	// Pins are the pins of the certificates presented by the host.
+	Pins []string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("fastreq: no pinned public key in the certificate chain of %s", e.Host)
+}
+
+// SetClientCertificate sets the client certificate for mutual TLS.
+func (c *Client) SetClientCertificate(cert *ClientCertificate) {
+	config := c.tlsConfig()
+	config.Certificates = nil
+	config.GetClientCertificate = cert.GetClientCertificate
+	c.resetTransports()
+}
+
+// SetRootCAs sets the certificate authorities the certificates of the servers
+// are verified with, see LoadCertPool.
+func (c *Client) SetRootCAs(pool *x509.CertPool) {
+	c.tlsConfig().RootCAs = pool
+	c.resetTransports()
+}
+
+// SetSPKIPins pins the public keys of a host, see SPKIPin. TLS connections to
+// the host fail with a *PinMismatchError unless a certificate of its chain has
+// one of the pinned keys. Without pins, the pins of the host are removed.
+//
+// The pins are verified by the VerifyConnection function of the TLS config,
+// which is replaced by SetTLSConfig.
+func (c *Client) SetSPKIPins(host string, pins ...string) {
+	c.pinsMu.Lock()
+	if len(pins) == 0 {
+		delete(c.pins, host)
+	} else {
+		if c.pins == nil {
+			c.pins = make(map[string][]string)
+		}
+		c.pins[host] = pins
+	}
+	c.pinsMu.Unlock()
+
+	c.tlsConfig().VerifyConnection = c.verifyPins
+	c.resetTransports()
+}
+
+// verifyPins checks the pinned public keys of a TLS connection.
+func (c *Client) verifyPins(cs tls.ConnectionState) error {
+	c.pinsMu.RLock()
+	pins := c.pins[cs.ServerName]
+	c.pinsMu.RUnlock()
+	if len(pins) == 0 {
+		return nil
+	}
+
+	// the verified chains include the root, which is not sent by the server
+	chains := cs.VerifiedChains
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+	err := &PinMismatchError{Host: cs.ServerName}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			pin := SPKIPin(cert)
+			for _, p := range pins {
+				if p == pin {
+					return nil
+				}
+			}
+			err.Pins = append(err.Pins, pin)
+		}
+	}
+	return err
+}
+
+// tlsConfig returns the TLS config of the Client, which is created if there is
+// none.
+func (c *Client) tlsConfig() *tls.Config {
+	if c.TLSConfig == nil {
+		c.TLSConfig = &tls.Config{} // #nosec G402
+	}
+	return c.TLSConfig
+}
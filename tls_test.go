@@ -0,0 +1,221 @@
+package fastreq
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testCert is a certificate with its key, signed by its parent.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, dnsNames ...string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+// write writes the certificate and its key as PEM files, returning their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(c.key)
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+// mtlsServer starts a TLS server for localhost which requires client
+// certificates of the CA, and responds with the common name of the client.
+func mtlsServer(t *testing.T, ca *testCert) *Client {
+	server := newTestCert(t, "server", ca, "localhost")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	ln := fasthttputil.NewInmemoryListener()
+	t.Cleanup(func() { _ = ln.Close() })
+	tlsLn := tls.NewListener(ln, &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.cert.Raw}, PrivateKey: server.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	})
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(ctx.TLSConnectionState().PeerCertificates[0].Subject.CommonName)
+		},
+	}
+	go func() {
+		err := s.Serve(tlsLn)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+	return client
+}
+
+func get(t *testing.T, client *Client) string {
+	resp, err := client.Get("https://localhost/")
+	require.NoError(t, err)
+	defer resp.Release()
+	return resp.BodyString()
+}
+
+func Test_TLS_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	client := mtlsServer(t, ca)
+
+	// the server is not trusted yet
+	_, err := client.Get("https://localhost/")
+	require.Error(t, err)
+
+	pool, err := LoadCertPool(false, caFile)
+	require.NoError(t, err)
+	client.SetRootCAs(pool)
+
+	// no client certificate
+	_, err = client.Get("https://localhost/")
+	require.Error(t, err)
+
+	certFile, keyFile := newTestCert(t, "a", ca).write(t, dir, "client")
+	cert, err := LoadClientCertificate(certFile, keyFile)
+	require.NoError(t, err)
+	client.SetClientCertificate(cert)
+	require.Equal(t, "a", get(t, client))
+
+	// rotated files are used for new connections
+	newTestCert(t, "b", ca).write(t, dir, "client")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	client.CloseIdleConnections()
+	require.Equal(t, "b", get(t, client))
+
+	// the certificate is kept while only one of the files is replaced
+	next := newTestCert(t, "c", ca)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: next.cert.Raw}), 0o600))
+	future = future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	client.CloseIdleConnections()
+	require.Equal(t, "b", get(t, client))
+	require.Error(t, cert.Reload())
+
+	_, err = LoadClientCertificate(certFile, filepath.Join(dir, "missing.key"))
+	require.Error(t, err)
+}
+
+func Test_TLS_ClientCertificatePKCS12(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	intermediate := newTestCert(t, "intermediate", ca)
+	intermediate.cert.IsCA = true
+	client := mtlsServer(t, ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client.SetRootCAs(pool)
+
+	leaf := newTestCert(t, "p12", ca)
+	data, err := pkcs12.Modern.Encode(leaf.key, leaf.cert, []*x509.Certificate{intermediate.cert}, "password")
+	require.NoError(t, err)
+	file := filepath.Join(dir, "client.p12")
+	require.NoError(t, os.WriteFile(file, data, 0o600))
+
+	cert, err := LoadClientCertificatePKCS12(file, "password")
+	require.NoError(t, err)
+	require.Len(t, cert.Certificate().Certificate, 2)
+	client.SetClientCertificate(cert)
+	require.Equal(t, "p12", get(t, client))
+
+	_, err = LoadClientCertificatePKCS12(file, "wrong")
+	require.Error(t, err)
+}
+
+func Test_TLS_SPKIPins(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil)
+	client := mtlsServer(t, ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client.SetRootCAs(pool)
+	cert, err := LoadClientCertificate(newTestCert(t, "a", ca).write(t, dir, "client"))
+	require.NoError(t, err)
+	client.SetClientCertificate(cert)
+
+	client.SetSPKIPins("localhost", "bm90IHRoZSBwaW4=", SPKIPin(ca.cert))
+	require.Equal(t, "a", get(t, client))
+
+	client.SetSPKIPins("other.host", "bm90IHRoZSBwaW4=")
+	require.Equal(t, "a", get(t, client))
+
+	client.SetSPKIPins("localhost", "bm90IHRoZSBwaW4=")
+	client.CloseIdleConnections()
+	_, err = client.Get("https://localhost/")
+	var pinErr *PinMismatchError
+	require.True(t, errors.As(err, &pinErr), err)
+	require.Equal(t, "localhost", pinErr.Host)
+	require.Contains(t, pinErr.Pins, SPKIPin(ca.cert))
+
+	client.SetSPKIPins("localhost")
+	require.Equal(t, "a", get(t, client))
+}
+
+func Test_TLS_LoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	caFile, _ := newTestCert(t, "ca", nil).write(t, dir, "ca")
+	_, keyFile := newTestCert(t, "other", nil).write(t, dir, "other")
+
+	pool, err := LoadCertPool(true, caFile)
+	require.NoError(t, err)
+	require.NotNil(t, pool)
+
+	_, err = LoadCertPool(false, keyFile)
+	require.Error(t, err)
+	_, err = LoadCertPool(false, filepath.Join(dir, "missing.crt"))
+	require.Error(t, err)
+}
@@ -0,0 +1,144 @@
+package fastreq
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpproxy"
+)
+
+// transportKey identifies the per-request settings which need a dedicated
+// fasthttp.Client, because fasthttp only supports them per client.
+type transportKey struct {
+	proxy    string
+	insecure bool
+	// profile is set for TLS connections with the ClientHello of a profile
+	profile *BrowserProfile
+}
+
+// transport returns the fasthttp.Client which sends req. Requests without own
+// transport settings are sent by the Client itself, the others by clones of it,
+// which are created on first use and cached.
+func (c *Client) transport(req *Request) (*fasthttp.Client, error) {
+	return c.transportFor(transportKey{proxy: req.proxy, insecure: req.insecureSkipVerify})
+}
+
+// transportFor returns the fasthttp.Client for the given transport settings.
+func (c *Client) transportFor(key transportKey) (*fasthttp.Client, error) {
+	if key == (transportKey{}) {
+		return c.Client, nil
+	}
+
+	c.transportsMu.Lock()
+	defer c.transportsMu.Unlock()
+
+	if t, ok := c.transports[key]; ok {
+		return t, nil
+	}
+
+	t := c.cloneTransport()
+	if key.proxy != "" {
+		dial, err := proxyDialer(key.proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Dial = dial
+	}
+	if key.insecure {
+		if t.TLSConfig == nil {
+			t.TLSConfig = &tls.Config{} // #nosec G402
+		} else {
+			t.TLSConfig = t.TLSConfig.Clone()
+		}
+		/* #nosec G402 */
+		t.TLSConfig.InsecureSkipVerify = true
+	}
+	if key.profile != nil {
+		t.Dial = key.profile.dialer(t.Dial, t.TLSConfig)
+	}
+
+	if c.transports == nil {
+		c.transports = make(map[transportKey]*fasthttp.Client)
+	}
+	c.transports[key] = t
+	return t, nil
+}
+
+// resetTransports drops the cached transports, so that they are recreated with
+// the current settings of the Client. The fasthttp.Client of the Client itself
+// is replaced as well, as fasthttp copies the settings to its per host clients.
+func (c *Client) resetTransports() {
+	c.transportsMu.Lock()
+	c.transports = nil
+	c.transportsMu.Unlock()
+
+	old := c.Client
+	c.Client = c.cloneTransport()
+	old.CloseIdleConnections()
+
+	if c.balancer != nil {
+		c.balancer.reset()
+	}
+}
+
+// cloneTransport returns a new fasthttp.Client with the settings of the Client.
+// The fasthttp.Client holds locks and connection pools, so rather than copying
+// it, every exported field is set on the new one.
+func (c *Client) cloneTransport() *fasthttp.Client {
+	return &fasthttp.Client{
+		Name:                          c.Name,
+		NoDefaultUserAgentHeader:      c.NoDefaultUserAgentHeader,
+		Dial:                          c.Dial,
+		DialDualStack:                 c.DialDualStack,
+		TLSConfig:                     c.TLSConfig,
+		MaxConnsPerHost:               c.MaxConnsPerHost,
+		MaxIdleConnDuration:           c.MaxIdleConnDuration,
+		MaxConnDuration:               c.MaxConnDuration,
+		MaxIdemponentCallAttempts:     c.MaxIdemponentCallAttempts,
+		ReadBufferSize:                c.ReadBufferSize,
+		WriteBufferSize:               c.WriteBufferSize,
+		ReadTimeout:                   c.ReadTimeout,
+		WriteTimeout:                  c.WriteTimeout,
+		MaxResponseBodySize:           c.MaxResponseBodySize,
+		DisableHeaderNamesNormalizing: c.DisableHeaderNamesNormalizing,
+		DisablePathNormalizing:        c.DisablePathNormalizing,
+		MaxConnWaitTimeout:            c.MaxConnWaitTimeout,
+		RetryIf:                       c.RetryIf,
+		ConnPoolStrategy:              c.ConnPoolStrategy,
+		StreamResponseBody:            c.StreamResponseBody,
+		ConfigureClient:               c.ConfigureClient,
+	}
+}
+
+// proxyDialer returns a dial function which connects through the proxy with the
+// given URL. Supported schemes are http, which is the default, and socks5.
+func proxyDialer(proxy string) (fasthttp.DialFunc, error) {
+	u, err := parseProxy(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http":
+		addr := u.Host
+		if u.User != nil {
+			password, _ := u.User.Password()
+			addr = u.User.Username() + ":" + password + "@" + addr
+		}
+		return fasthttpproxy.FasthttpHTTPDialer(addr), nil
+	case "socks5", "socks5h":
+		return fasthttpproxy.FasthttpSocksDialer(u.String()), nil
+	}
+	return nil, fmt.Errorf("fastreq: unsupported proxy scheme %q", u.Scheme)
+}
+
+// parseProxy parses the URL of a proxy, with http as the default scheme.
+func parseProxy(proxy string) (*url.URL, error) {
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	return url.Parse(proxy)
+}
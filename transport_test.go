@@ -0,0 +1,156 @@
+package fastreq
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_Request_InsecureSkipVerify(t *testing.T) {
+	cert, key, err := fasthttp.GenerateTestCertificate("make.fasthttp.great")
+	require.NoError(t, err)
+
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString("secure")
+		},
+	}
+	go func() {
+		err := s.ServeTLSEmbed(ln, cert, key)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	_, err = client.Get("https://make.fasthttp.great/")
+	require.Error(t, err)
+
+	resp, err := client.Get("https://make.fasthttp.great/", NewInsecureSkipVerify())
+	require.NoError(t, err)
+	require.Equal(t, "secure", string(resp.Body()))
+	resp.Release()
+
+	// the transport is cached and the Client's own settings are untouched
+	req := NewRequest(GET, "https://make.fasthttp.great/")
+	defer req.Release()
+	req.insecureSkipVerify = true
+	t1, err := client.transport(req)
+	require.NoError(t, err)
+	t2, err := client.transport(req)
+	require.NoError(t, err)
+	require.Same(t, t1, t2)
+	require.NotSame(t, client.Client, t1)
+	require.Nil(t, client.TLSConfig)
+
+	client.SkipInsecureVerify(true)
+	t3, err := client.transport(req)
+	require.NoError(t, err)
+	require.NotSame(t, t1, t3)
+}
+
+func Test_Request_Proxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	connects := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				line, err := br.ReadString('\n')
+				if err != nil {
+					return
+				}
+				var auth string
+				for {
+					h, err := br.ReadString('\n')
+					if err != nil || h == "\r\n" {
+						break
+					}
+					if strings.HasPrefix(h, "Proxy-Authorization: ") {
+						auth = strings.TrimSpace(strings.TrimPrefix(h, "Proxy-Authorization: "))
+					}
+				}
+				connects <- strings.TrimSpace(line) + " " + auth
+				_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+				_ = fasthttp.ServeConn(conn, func(ctx *fasthttp.RequestCtx) {
+					ctx.SetBodyString("proxied " + string(ctx.Host()))
+				})
+			}()
+		}
+	}()
+
+	client := NewClient()
+	resp, err := client.Get("http://make.fasthttp.great/", NewProxy("user:pass@"+ln.Addr().String()))
+	require.NoError(t, err)
+	require.Equal(t, "proxied make.fasthttp.great", string(resp.Body()))
+	require.Equal(t, "CONNECT make.fasthttp.great:80 HTTP/1.1 Basic dXNlcjpwYXNz", <-connects)
+	resp.Release()
+
+	_, err = client.Get("http://make.fasthttp.great/", NewProxy("ftp://"+ln.Addr().String()))
+	require.ErrorContains(t, err, "unsupported proxy scheme")
+}
+
+func Test_Client_CloneTransport(t *testing.T) {
+	client := NewClient()
+	client.StreamResponseBody = true
+	client.SetHTTPProxy("127.0.0.1:8080")
+	require.True(t, client.StreamResponseBody)
+
+	lb, err := NewLoadBalancer(&LBConfig{Upstreams: []Upstream{{Addr: "10.0.0.1:80"}}})
+	require.NoError(t, err)
+	defer lb.Close()
+	client.SetLoadBalancer(lb)
+	req := NewRequest(GET, "http://make.fasthttp.great/")
+	defer req.Release()
+	hc, err := lb.upstreams[0].hostClient(client, req)
+	require.NoError(t, err)
+	require.True(t, hc.StreamResponseBody)
+
+	// every exported setting is copied to the new transports
+	v := reflect.ValueOf(NewClient().Client).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if !v.Type().Field(i).IsExported() || !f.IsZero() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			f.SetInt(1)
+		case reflect.String:
+			f.SetString("fastreq")
+		case reflect.Ptr:
+			f.Set(reflect.New(f.Type().Elem()))
+		case reflect.Func:
+			f.Set(reflect.MakeFunc(f.Type(), nil))
+		default:
+			t.Fatalf("unexpected field %s", v.Type().Field(i).Name)
+		}
+	}
+	clone := reflect.ValueOf((&Client{Client: v.Addr().Interface().(*fasthttp.Client)}).cloneTransport()).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if name := v.Type().Field(i).Name; v.Type().Field(i).IsExported() {
+			require.False(t, clone.Field(i).IsZero(), name)
+		}
+	}
+}
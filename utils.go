@@ -1,7 +1,9 @@
 package fastreq
 
 import (
+	"encoding/base64"
 	"reflect"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -29,3 +31,20 @@ func unsafeS2B(s string) (b []byte) {
 	bh.Len = sh.Len
 	return b
 }
+
+// encodeText returns body as text together with its encoding, which is "base64"
+// if body is not valid UTF-8 and empty otherwise.
+func encodeText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// decodeText reverses encodeText.
+func decodeText(text, encoding string) ([]byte, error) {
+	if encoding == "base64" {
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return []byte(text), nil
+}
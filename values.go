@@ -0,0 +1,68 @@
+package fastreq
+
+// Keys of the values stored by fastreq itself.
+const (
+	// ValueRetries is the number of times the request was retried, stored as int.
+	ValueRetries = "fastreq.retries"
+	// ValueCoalesced is true if the response was shared with an identical request
+	// by MiddlewareCoalesce, stored as bool.
+	ValueCoalesced = "fastreq.coalesced"
+	// ValueHedge is the attempt of MiddlewareHedge which answered first, 0 for
+	// the original request and 1 for the first hedge, stored as int.
+	ValueHedge = "fastreq.hedge"
+	// ValueUpstream is the address of the upstream the request was sent to by a
+	// LoadBalancer, stored as string.
+	ValueUpstream = "fastreq.upstream"
+	// ValueProxy is the URL of the proxy the request was sent through, with its
+	// password redacted, stored as string. It is not set for proxies configured
+	// by SetEnvHTTPProxy.
+	ValueProxy = "fastreq.proxy"
+)
+
+// Valuer is implemented by Ctx and Response, which both hold request-scoped values.
+type Valuer interface {
+	Value(key string) any
+}
+
+// ValueOf returns the value stored under the given key as type T.
+// The boolean is false if there is no such value or it is not of type T.
+func ValueOf[T any](v Valuer, key string) (T, bool) {
+	value, ok := v.Value(key).(T)
+	return value, ok
+}
+
+// keyValue is a single request-scoped value. Requests usually carry only a few
+// values, so they are kept in a slice instead of a map.
+type keyValue struct {
+	key   string
+	value any
+}
+
+// setValue sets the value of key in values and returns the updated slice.
+func setValue(values []keyValue, key string, value any) []keyValue {
+	for i := range values {
+		if values[i].key == key {
+			values[i].value = value
+			return values
+		}
+	}
+	return append(values, keyValue{key: key, value: value})
+}
+
+// getValue returns the value of key in values, or nil if there is none.
+func getValue(values []keyValue, key string) any {
+	for i := range values {
+		if values[i].key == key {
+			return values[i].value
+		}
+	}
+	return nil
+}
+
+// resetValues drops all values while keeping the allocated slice.
+func resetValues(values []keyValue) []keyValue {
+	for i := range values {
+		values[i] = keyValue{}
+	}
+	return values[:0]
+}
@@ -0,0 +1,87 @@
+package fastreq
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func Test_Ctx_Values(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	client.Dial = func(addr string) (net.Conn, error) {
+		return ln.Dial()
+	}
+
+	client.UseMiddleware("first", func(ctx *Ctx) error {
+		ctx.SetValue("user", "fastreq")
+		ctx.SetValue("count", 1)
+		return ctx.Next()
+	})
+	client.UseMiddleware("second", func(ctx *Ctx) error {
+		user, ok := ValueOf[string](ctx, "user")
+		require.True(t, ok)
+		require.Equal(t, "fastreq", user)
+
+		count, _ := ValueOf[int](ctx, "count")
+		ctx.SetValue("count", count+1)
+		return ctx.Next()
+	})
+
+	resp, err := client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	require.Equal(t, "fastreq", resp.Value("user"))
+	require.Equal(t, 2, resp.Value("count"))
+	require.Nil(t, resp.Value("missing"))
+
+	_, ok := ValueOf[string](resp, "count")
+	require.False(t, ok)
+
+	cp := resp.Copy()
+	require.Equal(t, 2, cp.Value("count"))
+	Release(resp, cp)
+}
+
+func Test_Ctx_Values_Retries(t *testing.T) {
+	ln := fasthttputil.NewInmemoryListener()
+	s := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {},
+	}
+	go func() {
+		err := s.Serve(ln)
+		if err != nil {
+			return
+		}
+	}()
+
+	client := NewClient()
+	dials := 0
+	client.Dial = func(addr string) (net.Conn, error) {
+		dials++
+		if dials == 1 {
+			c1, c2 := net.Pipe()
+			_ = c2.Close()
+			return c1, nil
+		}
+		return ln.Dial()
+	}
+
+	resp, err := client.Get("http://make.fasthttp.great")
+	require.NoError(t, err)
+	retries, ok := ValueOf[int](resp, ValueRetries)
+	require.True(t, ok)
+	require.Equal(t, 1, retries)
+}